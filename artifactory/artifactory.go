@@ -1,11 +1,15 @@
 package artifactory
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
+	"path/filepath"
 	"time"
 
 	"github.com/edgetx/cloudbuild/buildlogs"
@@ -22,14 +26,48 @@ import (
 var (
 	ErrNoArtifactStorage = errors.New("missing artifact storage")
 	ErrBuildNotFound     = errors.New("build not found")
+	// ErrBuildCancelled is the cause of a build context cancelled on request.
+	ErrBuildCancelled      = errors.New("build cancelled")
+	ErrBuildNotCancellable = errors.New("build is not pending")
+	ErrTooManyQueuedJobs   = errors.New("too many queued jobs")
+	// ErrLeaseLost is the cause of a build context cancelled because the job
+	// was requeued or reserved by another worker meanwhile.
+	ErrLeaseLost = errors.New("job lease lost")
+	// ErrWorkerStopping is the cause of a build context cancelled because
+	// the worker stops, the job is requeued.
+	ErrWorkerStopping = errors.New("worker stopping")
 )
 
+// QueuedJobsRetryAfter is suggested to clients having too many queued jobs.
+const QueuedJobsRetryAfter = time.Minute
+
 type Artifactory struct {
 	BuildJobsRepository BuildJobsRepository
 	ArtifactStorage     storage.Handler
 	SourceRepository    string
 	BuildContainerImage string
 	PrefixURL           *url.URL
+	// SigningKey signs the build manifests when set.
+	SigningKey     ed25519.PrivateKey
+	ChecksumBLAKE3 bool
+	// DownloadMode selects how artifact download URLs are built,
+	// see DownloadModePublic, DownloadModePresigned and DownloadModeSigned.
+	DownloadMode   string
+	DownloadSecret []byte
+	DownloadExpiry time.Duration
+	// FileNameTemplate names the downloaded files, see ArtifactFileName.
+	FileNameTemplate string
+	// MaxQueuedPerIP caps the jobs waiting for build per anonymous
+	// requester IP, 0 means no limit.
+	MaxQueuedPerIP int
+	// WebhooksRepository manages the webhook subscriptions and deliveries,
+	// the job status changes are queued by the BuildJobsRepository.
+	WebhooksRepository WebhooksRepository
+	// CallbacksEnabled accepts callback URLs on build requests, the
+	// callbacks being signed with the webhook secret.
+	CallbacksEnabled bool
+	// RetryPolicy decides which failed jobs are built again, and when.
+	RetryPolicy RetryPolicy
 }
 
 func New(
@@ -45,6 +83,7 @@ func New(
 		BuildContainerImage: buildContainerImage,
 		SourceRepository:    sourceRepository,
 		PrefixURL:           prefixURL,
+		RetryPolicy:         DefaultRetryPolicy,
 	}
 }
 
@@ -61,13 +100,30 @@ func NewFromConfig(ctx context.Context, c *config.CloudbuildOpts) (*Artifactory,
 	if err != nil {
 		return nil, fmt.Errorf("cannot parse PREFIX_URL: %w", err)
 	}
-	return New(
+	art := New(
 		buildJobsRepository,
 		artifactStorage,
 		c.BuildImage,
 		c.SourceRepository,
 		prefixURL,
-	), nil
+	)
+	art.ChecksumBLAKE3 = c.ChecksumBLAKE3
+	art.DownloadMode = c.DownloadMode
+	art.DownloadSecret = []byte(c.DownloadSecret)
+	art.DownloadExpiry = time.Duration(c.DownloadURLExpiry) * time.Second
+	art.FileNameTemplate = c.ArtifactNameTemplate
+	art.MaxQueuedPerIP = int(c.MaxQueuedJobsPerIP)
+	art.CallbacksEnabled = c.WebhookSecret != ""
+	webhooksRepository := NewWebhooksDBRepository(buildJobsRepository.db)
+	buildJobsRepository.Outbox = webhooksRepository
+	art.WebhooksRepository = webhooksRepository
+	if c.ManifestSigningKey != "" {
+		art.SigningKey, err = LoadSigningKey(c.ManifestSigningKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return art, nil
 }
 
 func (artifactory *Artifactory) ListJobs(query *JobQuery) (*database.Pagination, error) {
@@ -76,16 +132,120 @@ func (artifactory *Artifactory) ListJobs(query *JobQuery) (*database.Pagination,
 		return nil, err
 	}
 
-	res.Rows, err = BuildJobsDtoFromInterface(res.Rows, artifactory.PrefixURL)
+	res.Rows, err = BuildJobsDtoFromInterface(res.Rows, artifactory.DownloadURL)
 	return res, err
 }
 
-func (artifactory *Artifactory) DeleteJob(id string) error {
+func (artifactory *Artifactory) DeleteJob(ctx context.Context, id string) error {
 	uid, err := uuid.FromString(id)
 	if err != nil {
 		return err
 	}
-	return artifactory.BuildJobsRepository.Delete(uid)
+	job, err := artifactory.BuildJobsRepository.FindByID(uid)
+	if err != nil {
+		return err
+	}
+	if job == nil {
+		return ErrBuildNotFound
+	}
+	return artifactory.removeJob(ctx, job)
+}
+
+// CancelJob cancels a queued or running build. The worker running it
+// notices the cancellation and stops the build.
+func (artifactory *Artifactory) CancelJob(requesterIP string, id string) (*BuildJobDto, error) {
+	uid, err := uuid.FromString(id)
+	if err != nil {
+		return nil, ErrBuildNotFound
+	}
+	job, err := artifactory.BuildJobsRepository.FindByID(uid)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrBuildNotFound
+	}
+	cancelled, err := artifactory.BuildJobsRepository.CancelJob(uid, requesterIP)
+	if err != nil {
+		return nil, err
+	}
+	if !cancelled {
+		return nil, ErrBuildNotCancellable
+	}
+	job, err = artifactory.BuildJobsRepository.FindByID(uid)
+	if err != nil {
+		return nil, err
+	}
+	return BuildJobDtoFromModel(job, artifactory.DownloadURL)
+}
+
+// IsCancelled returns true once the job has been cancelled.
+func (artifactory *Artifactory) IsCancelled(jobID uuid.UUID) (bool, error) {
+	status, err := artifactory.BuildJobsRepository.GetStatus(jobID)
+	if err != nil {
+		return false, err
+	}
+	return status == BuildCancelled, nil
+}
+
+// CheckLease returns ErrBuildCancelled once the job being built is cancelled,
+// and ErrLeaseLost if the worker building it does not own it anymore.
+func (artifactory *Artifactory) CheckLease(job *BuildJobModel) error {
+	status, workerID, err := artifactory.BuildJobsRepository.GetOwner(job.ID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case status == BuildCancelled:
+		return ErrBuildCancelled
+	case status != BuildInProgress || workerID != job.WorkerID:
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// requeue hands a job back to the queue without counting the attempt.
+func (artifactory *Artifactory) requeue(job *BuildJobModel, reason string) error {
+	requeued, err := artifactory.BuildJobsRepository.RequeueJob(job, reason)
+	if err != nil || !requeued {
+		return err
+	}
+	log.Infof("job %s requeued: %s", job.ID, reason)
+	job.Status = WaitingForBuild
+	return nil
+}
+
+// RequeueOrphanedJobs requeues the jobs of the workers that are gone.
+func (artifactory *Artifactory) RequeueOrphanedJobs() error {
+	jobs, err := artifactory.BuildJobsRepository.ListOrphanedJobs()
+	if err != nil {
+		return err
+	}
+	for i := range *jobs {
+		job := &(*jobs)[i]
+		reason := fmt.Sprintf("worker %s (%s) lost", job.WorkerID, job.WorkerHostname)
+		if err := artifactory.requeue(job, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RequeueWorkerJobs requeues the jobs left by a previous process of the
+// worker workerID, which restarted before being considered gone.
+func (artifactory *Artifactory) RequeueWorkerJobs(workerID string) error {
+	jobs, err := artifactory.BuildJobsRepository.ListWorkerJobs(workerID)
+	if err != nil {
+		return err
+	}
+	for i := range *jobs {
+		job := &(*jobs)[i]
+		reason := fmt.Sprintf("worker %s (%s) restarted", job.WorkerID, job.WorkerHostname)
+		if err := artifactory.requeue(job, reason); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (artifactory *Artifactory) GetBuild(request *BuildRequest) (*BuildJobDto, error) {
@@ -97,7 +257,7 @@ func (artifactory *Artifactory) GetBuild(request *BuildRequest) (*BuildJobDto, e
 		return nil, ErrBuildNotFound
 	}
 
-	return BuildJobDtoFromModel(buildJob, artifactory.PrefixURL)
+	return BuildJobDtoFromModel(buildJob, artifactory.DownloadURL)
 }
 
 func (artifactory *Artifactory) GetLogs(jobID string) (*[]AuditLogDto, error) {
@@ -120,37 +280,82 @@ func (artifactory *Artifactory) GetLogs(jobID string) (*[]AuditLogDto, error) {
 }
 
 func (artifactory *Artifactory) restartFailedJob(
-	requesterIP string, job *BuildJobModel,
+	requesterIP string, job *BuildJobModel, callbackURL string,
 ) (*BuildJobDto, error) {
+	from := job.Status
 	job.AuditLogs = append(job.AuditLogs, AuditLogModel{
 		RequestIP: requesterIP,
-		From:      BuildError,
+		From:      from,
 		To:        WaitingForBuild,
 	})
+	job.NextAttemptAt = time.Now()
+	if from == BuildError {
+		retryAt := job.BuildEndedAt.Add(artifactory.RetryPolicy.Backoff(job.BuildAttempts))
+		if retryAt.After(job.NextAttemptAt) {
+			job.NextAttemptAt = retryAt
+		}
+	}
 	job.Status = WaitingForBuild
+	job.ErrorType, job.ErrorExcerpt = NoBuildError, ""
+	// the callback of the first requester is kept, so that other clients
+	// requesting the same build cannot redirect its notifications
+	if job.CallbackURL == "" {
+		job.CallbackURL = callbackURL
+	}
 
-	err := artifactory.BuildJobsRepository.Save(job)
+	err := artifactory.BuildJobsRepository.SaveTransition(job, from)
 	if err != nil {
 		return nil, err
 	}
 
-	return BuildJobDtoFromModel(job, artifactory.PrefixURL)
+	return BuildJobDtoFromModel(job, artifactory.DownloadURL)
+}
+
+// checkQueueQuota rejects anonymous requesters having too many queued jobs.
+func (artifactory *Artifactory) checkQueueQuota(requester Requester) error {
+	if artifactory.MaxQueuedPerIP <= 0 || requester.Authenticated() {
+		return nil
+	}
+	queued, err := artifactory.BuildJobsRepository.CountQueuedJobs(requester.Key())
+	if err != nil {
+		return fmt.Errorf("failed to count queued jobs: %w", err)
+	}
+	if queued >= int64(artifactory.MaxQueuedPerIP) {
+		return ErrTooManyQueuedJobs
+	}
+	return nil
 }
 
 func (artifactory *Artifactory) CreateBuildJob(
-	requesterIP string, request *BuildRequest,
+	requester Requester, request *BuildRequest,
 ) (*BuildJobDto, error) {
+	if request.Priority != 0 && !requester.Authenticated() {
+		return nil, ErrPriorityNotAllowed
+	}
+	if request.CallbackURL != "" && !artifactory.CallbacksEnabled {
+		return nil, ErrCallbacksDisabled
+	}
+	requesterIP := requester.IP
 	job, err := artifactory.BuildJobsRepository.Get(request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check for existing build: %w", err)
 	}
 
 	if job != nil {
-		// restart failed build until MaxBuildAttemps
-		if job.Status == BuildError && job.BuildAttempts < MaxBuildAttempts {
-			return artifactory.restartFailedJob(requesterIP, job)
+		// restart failed build if the retry policy allows it
+		// a cancelled build is started again when requested
+		if (job.Status == BuildError && artifactory.RetryPolicy.CanRestart(job)) ||
+			job.Status == BuildCancelled {
+			if err := artifactory.checkQueueQuota(requester); err != nil {
+				return nil, err
+			}
+			return artifactory.restartFailedJob(requesterIP, job, request.CallbackURL)
 		}
-		return BuildJobDtoFromModel(job, artifactory.PrefixURL)
+		return BuildJobDtoFromModel(job, artifactory.DownloadURL)
+	}
+
+	if err := artifactory.checkQueueQuota(requester); err != nil {
+		return nil, err
 	}
 
 	buildFlags, err := request.GetBuildFlags()
@@ -165,6 +370,14 @@ func (artifactory *Artifactory) CreateBuildJob(
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal build flags: %w", err)
 	}
+	artifactRulesJSON, err := json.Marshal(request.GetArtifactRules())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal artifact rules: %w", err)
+	}
+	requirementsJSON, err := json.Marshal(request.GetRequirements())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal requirements: %w", err)
+	}
 
 	buildContainer := request.GetBuildContainerImage()
 	if len(buildContainer) == 0 {
@@ -178,8 +391,13 @@ func (artifactory *Artifactory) CreateBuildJob(
 		Target:         request.Target,
 		Flags:          optFlagsJSON,
 		BuildFlags:     buildFlagsJSON,
+		ArtifactRules:  artifactRulesJSON,
 		ContainerImage: buildContainer,
 		BuildFlagsHash: request.HashTargetAndFlags(),
+		Priority:       request.Priority,
+		Requester:      requester.Key(),
+		CallbackURL:    request.CallbackURL,
+		Requirements:   requirementsJSON,
 		AuditLogs: []AuditLogModel{
 			{
 				RequestIP: requesterIP,
@@ -192,7 +410,7 @@ func (artifactory *Artifactory) CreateBuildJob(
 		return nil, err
 	}
 
-	return BuildJobDtoFromModel(job, artifactory.PrefixURL)
+	return BuildJobDtoFromModel(job, artifactory.DownloadURL)
 }
 
 func (artifactory *Artifactory) Build(
@@ -203,85 +421,261 @@ func (artifactory *Artifactory) Build(
 	builder firmware.Builder,
 ) (*BuildJobModel, error) {
 	now := time.Now()
+	// the job is only updated at the end if this worker still owns it
+	workerID := build.WorkerID
 	build.BuildAttempts += 1
 	build.BuildStartedAt = now
+	build.ErrorType, build.ErrorExcerpt = NoBuildError, ""
 	build.AuditLogs = append(build.AuditLogs, AuditLogModel{
-		From:      WaitingForBuild,
-		To:        BuildInProgress,
-		CreatedAt: now,
+		WorkerID:       build.WorkerID,
+		WorkerHostname: build.WorkerHostname,
+		From:           WaitingForBuild,
+		To:             BuildInProgress,
+		CreatedAt:      now,
 	})
-	onBuildFailure := func(err error, build *BuildJobModel) (*BuildJobModel, error) {
+	observeBuildStart(build)
+	// publish the remaining output before the job leaves BuildInProgress,
+	// so that live log readers get everything.
+	flushLogs := func() {
+		if err := recorder.Flush(); err != nil {
+			log.Warnf("failed to publish build logs: %s", err)
+		}
+	}
+	onBuildFailure := func(err error, build *BuildJobModel, class string) (*BuildJobModel, error) {
+		flushLogs()
+		class = errorClass(ctx, class)
+		defer func() { observeBuildEnd(build, class) }()
+		switch cause := context.Cause(ctx); {
+		case errors.Is(cause, ErrBuildCancelled):
+			// the job status and audit log were updated on cancellation
+			build.Status = BuildCancelled
+			return build, ErrBuildCancelled
+		case errors.Is(cause, ErrLeaseLost):
+			// the job belongs to someone else now
+			return build, ErrLeaseLost
+		case errors.Is(cause, ErrWorkerStopping):
+			build.BuildAttempts -= 1
+			if requeueErr := artifactory.requeue(build, "worker stopping"); requeueErr != nil {
+				return build, fmt.Errorf("failed to requeue job: %w", requeueErr)
+			}
+			return build, ErrWorkerStopping
+		}
 		build.BuildEndedAt = time.Now()
 		build.Status = BuildError
+		build.ErrorType, build.ErrorExcerpt = classifyFailure(ctx, err, class, recorder.Logs())
+		auditLog := AuditLogModel{
+			WorkerID:       build.WorkerID,
+			WorkerHostname: build.WorkerHostname,
+			From:           BuildInProgress,
+			To:             BuildError,
+			CreatedAt:      time.Now(),
+			StdOut:         recorder.Logs(),
+		}
+		if artifactory.RetryPolicy.ShouldRetry(build) {
+			delay := artifactory.RetryPolicy.Backoff(build.BuildAttempts)
+			auditLog.Reason = artifactory.RetryPolicy.retryReason(build, delay)
+			auditLog.To = WaitingForBuild
+			log.Infof("job %s %s", build.ID, auditLog.Reason)
+			build.Status = WaitingForBuild
+			build.NextAttemptAt = build.BuildEndedAt.Add(delay)
+			build.WorkerID, build.WorkerHostname = "", ""
+		}
+		build.AuditLogs = append(build.AuditLogs, auditLog)
 
-		build.AuditLogs = append(build.AuditLogs, AuditLogModel{
-			From:      BuildInProgress,
-			To:        BuildError,
-			CreatedAt: time.Now(),
-			StdOut:    recorder.Logs(),
-		})
-
-		revertErr := artifactory.BuildJobsRepository.Save(build)
+		ended, revertErr := artifactory.BuildJobsRepository.EndBuild(build, workerID)
 		if revertErr != nil {
 			return build, fmt.Errorf(
 				"failed to process build: %w and failed to update job: %w",
 				err, revertErr)
 		}
+		if !ended {
+			class = ErrorClassLeaseLost
+			return build, ErrLeaseLost
+		}
 		return build, err
 	}
 
+	phaseStart := time.Now()
 	err := sources.Download(ctx, artifactory.SourceRepository, build.CommitHash)
+	observePhase(PhaseSourceFetch, phaseStart)
 	if err != nil {
-		return onBuildFailure(err, build)
+		return onBuildFailure(err, build, ErrorClassSource)
 	}
 
 	var flags []firmware.BuildFlag
 	err = json.Unmarshal([]byte(build.BuildFlags.String()), &flags)
 	if err != nil {
-		return onBuildFailure(err, build)
+		return onBuildFailure(err, build, ErrorClassInternal)
 	}
 
-	firmwareBin, err := builder.Build(ctx, build.ContainerImage, build.Target, build.CommitRef, flags)
+	var rules []firmware.ArtifactRule
+	if build.ArtifactRules != nil {
+		err = json.Unmarshal([]byte(build.ArtifactRules.String()), &rules)
+		if err != nil {
+			return onBuildFailure(err, build, ErrorClassInternal)
+		}
+	}
+
+	phaseStart = time.Now()
+	artifacts, err := builder.Build(ctx, build.ContainerImage, build.Target, build.CommitRef, flags, rules)
+	observePhase(PhaseContainer, phaseStart)
 	if err != nil {
-		return onBuildFailure(err, build)
+		return onBuildFailure(err, build, ErrorClassBuild)
 	}
 
-	fileName := fmt.Sprintf("%s-%s", build.CommitHash, build.BuildFlagsHash)
-	err = artifactory.ArtifactStorage.Upload(ctx, firmwareBin, fileName)
+	phaseStart = time.Now()
+
+	artifactModels := make([]ArtifactModel, 0, len(artifacts)+2)
+	for i := range artifacts {
+		artifactModel, err := artifactory.uploadArtifact(ctx, build, &artifacts[i])
+		if err != nil {
+			return onBuildFailure(err, build, ErrorClassUpload)
+		}
+		artifactModels = append(artifactModels, *artifactModel)
+	}
+
+	manifestModels, err := artifactory.publishManifest(ctx, build, artifactModels)
 	if err != nil {
-		return onBuildFailure(err, build)
+		return onBuildFailure(err, build, ErrorClassUpload)
 	}
+	artifactModels = append(artifactModels, manifestModels...)
+	observePhase(PhaseUpload, phaseStart)
 
+	if ctx.Err() != nil {
+		return onBuildFailure(context.Cause(ctx), build, ErrorClassInternal)
+	}
+	flushLogs()
 	build.Status = BuildSuccess
-	build.Artifacts = append(build.Artifacts, ArtifactModel{
-		Slug:     "firmware",
-		Filename: fileName,
-		Size:     (int64)(len(firmwareBin)),
-	})
+	build.Artifacts = append(build.Artifacts, artifactModels...)
 	build.AuditLogs = append(build.AuditLogs, AuditLogModel{
-		From:      BuildInProgress,
-		To:        BuildSuccess,
-		CreatedAt: time.Now(),
-		StdOut:    recorder.Logs(),
+		WorkerID:       build.WorkerID,
+		WorkerHostname: build.WorkerHostname,
+		From:           BuildInProgress,
+		To:             BuildSuccess,
+		CreatedAt:      time.Now(),
+		StdOut:         recorder.Logs(),
 	})
 	build.BuildEndedAt = time.Now()
 
-	err = artifactory.BuildJobsRepository.Save(build)
+	ended, err := artifactory.BuildJobsRepository.EndBuild(build, workerID)
 	if err != nil {
-		return onBuildFailure(err, build)
+		return onBuildFailure(err, build, ErrorClassInternal)
 	}
+	if !ended {
+		observeBuildEnd(build, ErrorClassLeaseLost)
+		return build, ErrLeaseLost
+	}
+	observeBuildEnd(build, ErrorClassNone)
 
 	return build, nil
 }
 
-func (artifactory *Artifactory) ReservePendingBuild() (*BuildJobModel, error) {
-	return artifactory.BuildJobsRepository.ReservePendingBuild()
+// upload stores data and returns the artifact model with its checksums.
+func (artifactory *Artifactory) upload(
+	ctx context.Context,
+	data io.Reader,
+	size int64,
+	contentType string,
+	slug string,
+	fileName string,
+) (*ArtifactModel, error) {
+	checksums := newChecksummer(artifactory.ChecksumBLAKE3)
+	err := artifactory.ArtifactStorage.Upload(
+		ctx, checksums.Reader(data), size, contentType, fileName,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload %s artifact: %w", slug, err)
+	}
+	return &ArtifactModel{
+		Slug:     slug,
+		Filename: fileName,
+		Size:     size,
+		SHA256:   checksums.SHA256(),
+		BLAKE3:   checksums.BLAKE3(),
+	}, nil
+}
+
+func (artifactory *Artifactory) uploadArtifact(
+	ctx context.Context, build *BuildJobModel, artifact *firmware.Artifact,
+) (*ArtifactModel, error) {
+	file, err := artifact.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s artifact: %w", artifact.Slug, err)
+	}
+	defer file.Close()
+
+	return artifactory.upload(
+		ctx, file, artifact.Size, artifact.ContentType(),
+		artifact.Slug, artifactFileName(build, artifact.Slug, filepath.Ext(artifact.Filename)),
+	)
+}
+
+// publishManifest stores the manifest of the build artifacts and,
+// if a signing key is configured, its detached signature.
+func (artifactory *Artifactory) publishManifest(
+	ctx context.Context, build *BuildJobModel, artifacts []ArtifactModel,
+) ([]ArtifactModel, error) {
+	manifest, err := json.MarshalIndent(NewManifest(build, artifacts), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	manifestFileName := artifactFileName(build, ManifestArtifact, ".json")
+	manifestModel, err := artifactory.upload(
+		ctx, bytes.NewReader(manifest), int64(len(manifest)),
+		"application/json", ManifestArtifact, manifestFileName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	models := []ArtifactModel{*manifestModel}
+
+	if artifactory.SigningKey != nil {
+		signature := SignManifest(artifactory.SigningKey, manifest)
+		signatureModel, err := artifactory.upload(
+			ctx, bytes.NewReader(signature), int64(len(signature)),
+			"text/plain", ManifestSignatureArtifact, manifestFileName+".sig",
+		)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, *signatureModel)
+	}
+	return models, nil
+}
+
+// SigningPublicKey returns the key verifying the build manifests, if any.
+func (artifactory *Artifactory) SigningPublicKey() ed25519.PublicKey {
+	if artifactory.SigningKey == nil {
+		return nil
+	}
+	publicKey, _ := artifactory.SigningKey.Public().(ed25519.PublicKey)
+	return publicKey
+}
+
+// artifactFileName returns the storage object name of an artifact.
+// The firmware keeps the historical name without slug suffix.
+// The extension is kept, as radios need to tell UF2 from raw binaries.
+func artifactFileName(build *BuildJobModel, slug, ext string) string {
+	fileName := fmt.Sprintf("%s-%s", build.CommitHash, build.BuildFlagsHash)
+	if slug != firmware.FirmwareArtifact {
+		fileName += "-" + slug
+	}
+	return fileName + ext
+}
+
+// ReservePendingBuild reserves the next job the worker can build,
+// any job when worker is nil.
+func (artifactory *Artifactory) ReservePendingBuild(worker *BuildWorker) (*BuildJobModel, error) {
+	return artifactory.BuildJobsRepository.ReservePendingBuild(worker)
 }
 
 func (artifactory *Artifactory) RunGarbageCollector() {
 	jobsRepo := artifactory.BuildJobsRepository
 	for {
 		_ = jobsRepo.TimeoutBuilds(MaxBuildDuration)
+		// live logs are only needed while building
+		_ = jobsRepo.DeleteLogChunks(MaxBuildDuration)
 		time.Sleep(time.Second * 1)
 	}
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -14,9 +15,12 @@ import (
 	"github.com/edgetx/cloudbuild/buildlogs"
 	"github.com/edgetx/cloudbuild/config"
 	"github.com/edgetx/cloudbuild/database"
+	"github.com/edgetx/cloudbuild/firmware"
+	"github.com/edgetx/cloudbuild/source"
 	"github.com/edgetx/cloudbuild/storage"
 	"github.com/edgetx/cloudbuild/targets"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	uuid "github.com/satori/go.uuid"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -99,7 +103,7 @@ func newArtifactory(db *gorm.DB, handler storage.Handler) *artifactory.Artifacto
 	if handler == nil {
 		mck := &MockStorage{}
 		mck.
-			On("Upload", mock.Anything, mock.Anything, mock.Anything).
+			On("Upload", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 			Return(nil)
 		handler = mck
 	}
@@ -118,6 +122,22 @@ func newArtifactory(db *gorm.DB, handler storage.Handler) *artifactory.Artifacto
 	return artifactory.New(repo, handler, buildImage, sourceRepository, &url.URL{})
 }
 
+func firmwareArtifacts(t *testing.T, data string) []firmware.Artifact {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "firmware.bin")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return []firmware.Artifact{
+		{
+			Slug:     firmware.FirmwareArtifact,
+			Filename: "firmware.bin",
+			Path:     path,
+			Size:     int64(len(data)),
+		},
+	}
+}
+
 func createBuildModel(
 	db *gorm.DB,
 	status artifactory.BuildStatus,
@@ -154,7 +174,7 @@ func TestCreateBuildJob(t *testing.T) {
 	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
 	art := newArtifactory(testDB, nil)
 
-	job, err := art.CreateBuildJob("127.0.0.1", request)
+	job, err := art.CreateBuildJob(artifactory.Requester{IP: "127.0.0.1"}, request)
 	t.Logf("job: %+v err: %s", job, err)
 
 	assert.Nil(t, err)
@@ -170,7 +190,7 @@ func TestCreatesBuildJobWhenBuildExistsInErrorState(t *testing.T) {
 	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
 	art := newArtifactory(testDB, nil)
 
-	job, err := art.CreateBuildJob("127.0.0.1", request)
+	job, err := art.CreateBuildJob(artifactory.Requester{IP: "127.0.0.1"}, request)
 	assert.Nil(t, err)
 
 	repository := artifactory.NewBuildJobsDBRepository(testDB)
@@ -181,7 +201,7 @@ func TestCreatesBuildJobWhenBuildExistsInErrorState(t *testing.T) {
 	model.BuildAttempts = artifactory.MaxBuildAttempts
 	assert.Nil(t, repository.Save(model))
 
-	job, err = art.CreateBuildJob("127.0.0.1", request)
+	job, err = art.CreateBuildJob(artifactory.Requester{IP: "127.0.0.1"}, request)
 	assert.Nil(t, err)
 	assert.NotNil(t, job)
 	assert.Equal(t, model.ID, uuid.Must(uuid.FromString(job.ID)))
@@ -266,15 +286,197 @@ func TestGetBuildWhenBuildIsInError(t *testing.T) {
 func TestReservePendingBuildWhenNoneAvailable(t *testing.T) {
 	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
 	art := newArtifactory(testDB, nil)
-	model, err := art.ReservePendingBuild()
+	model, err := art.ReservePendingBuild(nil)
 	assert.Nil(t, err)
 	assert.Nil(t, model)
 }
 
+func createQueuedJob(
+	t *testing.T, requester string, priority int, createdAt time.Time,
+) *artifactory.BuildJobModel {
+	t.Helper()
+	repository := artifactory.NewBuildJobsDBRepository(testDB)
+	job, err := repository.Create(artifactory.BuildJobModel{
+		Status:    artifactory.WaitingForBuild,
+		Requester: requester,
+		Priority:  priority,
+		CreatedAt: createdAt,
+	})
+	assert.Nil(t, err)
+	return job
+}
+
+func TestReservePendingBuildOrder(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	art := newArtifactory(testDB, nil)
+	now := time.Now()
+	flood1 := createQueuedJob(t, "ip:1", 0, now.Add(-4*time.Minute))
+	flood2 := createQueuedJob(t, "ip:1", 0, now.Add(-3*time.Minute))
+	other := createQueuedJob(t, "ip:2", 0, now.Add(-2*time.Minute))
+	urgent := createQueuedJob(t, "token:release", 10, now.Add(-time.Minute))
+
+	// priority first, then the requester with the fewest builds started
+	// recently (fair share), then the oldest job: once flood1 is started,
+	// other goes before the older flood2
+	for _, expected := range []*artifactory.BuildJobModel{urgent, flood1, other, flood2} {
+		job, err := art.ReservePendingBuild(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, expected.ID, job.ID)
+	}
+}
+
+func TestReservePendingBuildMatchesCapabilities(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	art := newArtifactory(testDB, nil)
+	repository := artifactory.NewBuildJobsDBRepository(testDB)
+	now := time.Now()
+	createJob := func(image, requirements string, createdAt time.Time) *artifactory.BuildJobModel {
+		job, err := repository.Create(artifactory.BuildJobModel{
+			Status:         artifactory.WaitingForBuild,
+			CommitRef:      "v2.10.0",
+			ContainerImage: image,
+			Requirements:   []byte(requirements),
+			CreatedAt:      createdAt,
+		})
+		assert.Nil(t, err)
+		return job
+	}
+	amd64Only := createJob("builder:2.10", `{"platforms":["amd64"]}`, now.Add(-4*time.Minute))
+	large := createJob("builder:2.10", `{"min_memory_mb":8192}`, now.Add(-3*time.Minute))
+	unconstrained := createJob("builder:2.10", `{}`, now.Add(-2*time.Minute))
+	cached := createJob("builder:2.9", `{}`, now.Add(-time.Minute))
+
+	worker := &artifactory.BuildWorker{
+		ID:       uuid.NewV4().String(),
+		Hostname: "arm-builder",
+		Capabilities: &artifactory.WorkerCapabilities{
+			Arch:     "arm64",
+			MemoryMB: 4096,
+			Images:   []string{"builder:2.9"},
+		},
+	}
+	for _, expected := range []*artifactory.BuildJobModel{cached, unconstrained} {
+		job, err := art.ReservePendingBuild(worker)
+		assert.Nil(t, err)
+		assert.Equal(t, expected.ID, job.ID)
+		assert.Equal(t, worker.ID, job.WorkerID)
+		assert.Equal(t, "arm-builder", job.WorkerHostname)
+	}
+	job, err := art.ReservePendingBuild(worker)
+	assert.Nil(t, err)
+	assert.Nil(t, job)
+
+	// jobs nobody else can build are left to capable workers
+	for _, expected := range []*artifactory.BuildJobModel{amd64Only, large} {
+		job, err := art.ReservePendingBuild(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, expected.ID, job.ID)
+	}
+}
+
+func TestReservePendingBuildBeyondFirstCandidates(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	art := newArtifactory(testDB, nil)
+	repository := artifactory.NewBuildJobsDBRepository(testDB)
+	now := time.Now()
+	// more jobs the worker cannot build than it looks at at once
+	for i := 0; i < 120; i++ {
+		_, err := repository.Create(artifactory.BuildJobModel{
+			Status:       artifactory.WaitingForBuild,
+			CommitRef:    "v2.10.0",
+			Requirements: []byte(`{"platforms":["amd64"]}`),
+			CreatedAt:    now.Add(-time.Hour + time.Duration(i)*time.Second),
+		})
+		assert.Nil(t, err)
+	}
+	buildable, err := repository.Create(artifactory.BuildJobModel{
+		Status:    artifactory.WaitingForBuild,
+		CommitRef: "v2.10.0",
+		CreatedAt: now,
+	})
+	assert.Nil(t, err)
+
+	worker := &artifactory.BuildWorker{
+		ID:           uuid.NewV4().String(),
+		Hostname:     "arm-builder",
+		Capabilities: &artifactory.WorkerCapabilities{Arch: "arm64"},
+	}
+	job, err := art.ReservePendingBuild(worker)
+	assert.Nil(t, err)
+	if assert.NotNil(t, job) {
+		assert.Equal(t, buildable.ID, job.ID)
+	}
+	job, err = art.ReservePendingBuild(worker)
+	assert.Nil(t, err)
+	assert.Nil(t, job)
+}
+
+func TestPriorityRequiresAuthentication(t *testing.T) {
+	art := newArtifactory(testDB, nil)
+	req := artifactory.NewBuildRequestWithParams(commitRef, target, flags)
+	req.Priority = 1
+	_, err := art.CreateBuildJob(artifactory.Requester{IP: "127.0.0.1"}, req)
+	assert.ErrorIs(t, err, artifactory.ErrPriorityNotAllowed)
+}
+
+func TestCallbackRequiresSecret(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	art := newArtifactory(testDB, nil)
+	req := artifactory.NewBuildRequestWithParams(commitRef, target, flags)
+	req.CallbackURL = "https://example.com/callback"
+
+	_, err := art.CreateBuildJob(artifactory.Requester{IP: "127.0.0.1"}, req)
+	assert.ErrorIs(t, err, artifactory.ErrCallbacksDisabled)
+
+	art.CallbacksEnabled = true
+	job, err := art.CreateBuildJob(artifactory.Requester{IP: "127.0.0.1"}, req)
+	assert.Nil(t, err)
+	assert.Equal(t, artifactory.WaitingForBuild, job.Status)
+}
+
+func TestRestartKeepsCallback(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	art := newArtifactory(testDB, nil)
+	art.CallbacksEnabled = true
+	repository := artifactory.NewBuildJobsDBRepository(testDB)
+	req := artifactory.NewBuildRequestWithParams(commitRef, target, flags)
+	req.CallbackURL = "https://example.com/first"
+	job, err := art.CreateBuildJob(artifactory.Requester{IP: "127.0.0.1"}, req)
+	assert.Nil(t, err)
+	_, err = art.CancelJob("127.0.0.1", job.ID)
+	assert.Nil(t, err)
+
+	// another client restarting the same build
+	req.CallbackURL = "https://example.org/other"
+	job, err = art.CreateBuildJob(artifactory.Requester{IP: "127.0.0.2"}, req)
+	assert.Nil(t, err)
+	assert.Equal(t, artifactory.WaitingForBuild, job.Status)
+	model, err := repository.FindByID(uuid.FromStringOrNil(job.ID))
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/first", model.CallbackURL)
+}
+
+func TestCreateBuildJobQueueQuota(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	art := newArtifactory(testDB, nil)
+	art.MaxQueuedPerIP = 1
+	createQueuedJob(t, "ip:127.0.0.1", 0, time.Now())
+
+	_, err := art.CreateBuildJob(artifactory.Requester{IP: "127.0.0.1"}, request)
+	assert.ErrorIs(t, err, artifactory.ErrTooManyQueuedJobs)
+
+	// authenticated requesters are not limited
+	job, err := art.CreateBuildJob(
+		artifactory.Requester{IP: "127.0.0.1", AccessKey: "key"}, request,
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, artifactory.WaitingForBuild, job.Status)
+}
+
 func TestBuildWhenFailingToDownload(t *testing.T) {
 	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
 	art := newArtifactory(testDB, nil)
-	model1, err := createBuildModel(testDB, artifactory.WaitingForBuild, request)
+	model1, err := createBuildModel(testDB, artifactory.BuildInProgress, request)
 	assert.Nil(t, err)
 
 	ctx := context.Background()
@@ -289,14 +491,22 @@ func TestBuildWhenFailingToDownload(t *testing.T) {
 	assert.Error(t, err, "failed to download")
 	downloader.AssertNumberOfCalls(t, "Download", 1)
 	assert.Equal(t, model1.ID.String(), model2.ID.String())
-	assert.Equal(t, artifactory.BuildError, model2.Status)
 	assert.Equal(t, int64(1), model2.BuildAttempts)
+	assert.Equal(t, artifactory.GitFetchError, model2.ErrorType)
+	assert.Equal(t, "failed to download", model2.ErrorExcerpt)
+
+	// fetching the sources may work next time
+	assert.Equal(t, artifactory.WaitingForBuild, model2.Status)
+	assert.True(t, model2.NextAttemptAt.After(time.Now()))
+	model3, err := art.ReservePendingBuild(nil)
+	assert.Nil(t, model3)
+	assert.Nil(t, err)
 }
 
 func TestBuildWhenFailingToBuild(t *testing.T) {
 	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
 	art := newArtifactory(testDB, nil)
-	model1, err := createBuildModel(testDB, artifactory.WaitingForBuild, request)
+	model1, err := createBuildModel(testDB, artifactory.BuildInProgress, request)
 	assert.Nil(t, err)
 
 	ctx := context.Background()
@@ -318,15 +528,374 @@ func TestBuildWhenFailingToBuild(t *testing.T) {
 	assert.Equal(t, int64(1), model2.BuildAttempts)
 }
 
+func TestBuildOutcomeMetrics(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	reg := prometheus.NewRegistry()
+	artifactory.RegisterBuildMetrics(reg)
+	art := newArtifactory(testDB, nil)
+	model, err := createBuildModel(testDB, artifactory.BuildInProgress, request)
+	assert.Nil(t, err)
+
+	downloader := &MockDownloader{}
+	downloader.
+		On("Download", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil)
+	builder := &MockFirmwareBuilder{}
+	builder.
+		On("Build", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, errors.New("failed to build"))
+	_, err = art.Build(context.Background(), model, buildlogs.NewRecorder(), downloader, builder)
+	assert.Error(t, err)
+
+	// the metrics are shared by all the builds of the process
+	outcomes, phases := gatherBuildMetrics(t, reg)
+	assert.Contains(t, outcomes, map[string]string{
+		"target":      model.Target,
+		"release":     model.CommitRef,
+		"outcome":     "failure",
+		"error_class": artifactory.ErrorClassBuild,
+	})
+	assert.True(t, phases[artifactory.PhaseSourceFetch])
+	assert.True(t, phases[artifactory.PhaseContainer])
+}
+
+func gatherBuildMetrics(t *testing.T, reg *prometheus.Registry) ([]map[string]string, map[string]bool) {
+	families, err := reg.Gather()
+	assert.Nil(t, err)
+	var outcomes []map[string]string
+	phases := map[string]bool{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			switch family.GetName() {
+			case "build_outcome_total":
+				outcomes = append(outcomes, labels)
+			case "build_phase_duration_seconds":
+				phases[labels["phase"]] = true
+			}
+		}
+	}
+	return outcomes, phases
+}
+
+func TestCancelJob(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	art := newArtifactory(testDB, nil)
+	model, err := createBuildModel(testDB, artifactory.BuildInProgress, request)
+	assert.Nil(t, err)
+
+	job, err := art.CancelJob("127.0.0.1", model.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, artifactory.BuildCancelled, job.Status)
+
+	cancelled, err := art.IsCancelled(model.ID)
+	assert.Nil(t, err)
+	assert.True(t, cancelled)
+
+	logs, err := art.GetLogs(model.ID.String())
+	assert.Nil(t, err)
+	assert.Len(t, *logs, 1)
+	assert.Equal(t, artifactory.BuildInProgress, (*logs)[0].From)
+	assert.Equal(t, artifactory.BuildCancelled, (*logs)[0].To)
+
+	_, err = art.CancelJob("127.0.0.1", model.ID.String())
+	assert.ErrorIs(t, err, artifactory.ErrBuildNotCancellable)
+	_, err = art.CancelJob("127.0.0.1", uuid.NewV4().String())
+	assert.ErrorIs(t, err, artifactory.ErrBuildNotFound)
+}
+
+func TestCancelQueuedJob(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	art := newArtifactory(testDB, nil)
+	model, err := createBuildModel(testDB, artifactory.WaitingForBuild, request)
+	assert.Nil(t, err)
+
+	_, err = art.CancelJob("127.0.0.1", model.ID.String())
+	assert.Nil(t, err)
+
+	logs, err := art.GetLogs(model.ID.String())
+	assert.Nil(t, err)
+	assert.Len(t, *logs, 1)
+	assert.Equal(t, artifactory.WaitingForBuild, (*logs)[0].From)
+	assert.Equal(t, artifactory.BuildCancelled, (*logs)[0].To)
+
+	jobs, err := art.ListJobs(&artifactory.JobQuery{Status: "cancelled"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), jobs.TotalRows)
+	jobs, err = art.ListJobs(&artifactory.JobQuery{Status: "queued"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), jobs.TotalRows)
+}
+
+// failingOutbox cannot queue notifications.
+type failingOutbox struct{}
+
+func (failingOutbox) EnqueueStatusChange(
+	tx *gorm.DB, job *artifactory.BuildJobModel, from, to artifactory.BuildStatus,
+) error {
+	return errors.New("outbox unavailable")
+}
+
+func TestStatusChangesQueueWebhooks(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	art := newArtifactory(testDB, nil)
+	webhooks := artifactory.NewWebhooksDBRepository(testDB)
+	art.BuildJobsRepository.(*artifactory.BuildJobsDBRepository).Outbox = webhooks
+	art.WebhooksRepository = webhooks
+	_, err := art.CreateWebhook("https://example.com/hook", nil)
+	assert.Nil(t, err)
+
+	job, err := art.CreateBuildJob(artifactory.Requester{IP: "127.0.0.1"}, request)
+	assert.Nil(t, err)
+	_, err = art.ReservePendingBuild(nil)
+	assert.Nil(t, err)
+	_, err = art.CancelJob("127.0.0.1", job.ID)
+	assert.Nil(t, err)
+
+	deliveries, err := art.ListWebhookDeliveries(&artifactory.WebhookDeliveryQuery{BuildJobID: job.ID})
+	assert.Nil(t, err)
+	assert.Len(t, *deliveries, 3)
+}
+
+func TestStatusChangeRolledBackWithoutOutbox(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	art := newArtifactory(testDB, nil)
+	model, err := createBuildModel(testDB, artifactory.BuildInProgress, request)
+	assert.Nil(t, err)
+
+	// the status change and its notifications are written together, or not at all
+	art.BuildJobsRepository.(*artifactory.BuildJobsDBRepository).Outbox = failingOutbox{}
+	_, err = art.CancelJob("127.0.0.1", model.ID.String())
+	assert.NotNil(t, err)
+	status, err := art.BuildJobsRepository.GetStatus(model.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, artifactory.BuildInProgress, status)
+	logs, err := art.GetLogs(model.ID.String())
+	assert.Nil(t, err)
+	assert.Empty(t, *logs)
+}
+
+func TestBuildWhenCancelled(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	art := newArtifactory(testDB, nil)
+	model1, err := createBuildModel(testDB, artifactory.BuildInProgress, request)
+	assert.Nil(t, err)
+	_, err = art.CancelJob("127.0.0.1", model1.ID.String())
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	recorder := buildlogs.NewRecorder()
+	downloader := &MockDownloader{}
+	downloader.
+		On("Download", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil)
+	builder := &MockFirmwareBuilder{}
+	builder.
+		On("Build", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) { cancel(artifactory.ErrBuildCancelled) }).
+		Return(nil, context.Canceled)
+	model2, err := art.Build(ctx, model1, recorder, downloader, builder)
+	assert.ErrorIs(t, err, artifactory.ErrBuildCancelled)
+	assert.Equal(t, artifactory.BuildCancelled, model2.Status)
+
+	// the cancellation is not overwritten by the worker
+	cancelled, err := art.IsCancelled(model1.ID)
+	assert.Nil(t, err)
+	assert.True(t, cancelled)
+}
+
+func TestBuildWhenWorkerStopping(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	reg := prometheus.NewRegistry()
+	artifactory.RegisterBuildMetrics(reg)
+	art := newArtifactory(testDB, nil)
+	_, err := createBuildModel(testDB, artifactory.WaitingForBuild, request)
+	assert.Nil(t, err)
+	worker := &artifactory.BuildWorker{ID: uuid.NewV4().String(), Hostname: "builder"}
+	job, err := art.ReservePendingBuild(worker)
+	assert.Nil(t, err)
+	assert.Nil(t, art.CheckLease(job))
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	downloader := &MockDownloader{}
+	downloader.
+		On("Download", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) { cancel(artifactory.ErrWorkerStopping) }).
+		Return(context.Canceled)
+	builder := &MockFirmwareBuilder{}
+	_, err = art.Build(ctx, job, buildlogs.NewRecorder(), downloader, builder)
+	assert.ErrorIs(t, err, artifactory.ErrWorkerStopping)
+
+	// the job is back in the queue, without consuming an attempt
+	requeued, err := art.ReservePendingBuild(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, job.ID, requeued.ID)
+	assert.Equal(t, int64(0), requeued.BuildAttempts)
+	assert.Equal(t, "", requeued.WorkerID)
+	assert.False(t, requeued.NextAttemptAt.Before(job.BuildStartedAt))
+
+	// the interrupted build is not counted as a failure
+	outcomes, _ := gatherBuildMetrics(t, reg)
+	assert.Contains(t, outcomes, map[string]string{
+		"target":      job.Target,
+		"release":     job.CommitRef,
+		"outcome":     artifactory.ErrorClassWorkerStopped,
+		"error_class": artifactory.ErrorClassWorkerStopped,
+	})
+
+	// the first worker lost the job
+	assert.ErrorIs(t, art.CheckLease(job), artifactory.ErrLeaseLost)
+}
+
+func TestBuildEndedAfterLeaseLost(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	reg := prometheus.NewRegistry()
+	artifactory.RegisterBuildMetrics(reg)
+	art := newArtifactory(testDB, nil)
+	repository := artifactory.NewBuildJobsDBRepository(testDB)
+	_, err := createBuildModel(testDB, artifactory.WaitingForBuild, request)
+	assert.Nil(t, err)
+	worker := &artifactory.BuildWorker{ID: uuid.NewV4().String(), Hostname: "builder"}
+	job, err := art.ReservePendingBuild(worker)
+	assert.Nil(t, err)
+
+	downloader := &MockDownloader{}
+	downloader.
+		On("Download", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil)
+	builder := &MockFirmwareBuilder{}
+	builder.
+		On("Build", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) {
+			// the worker is considered gone while it is still building
+			requeued, err := repository.RequeueJob(job, "worker lost")
+			assert.Nil(t, err)
+			assert.True(t, requeued)
+		}).
+		Return(firmwareArtifacts(t, "edgetx"), nil)
+	_, err = art.Build(context.Background(), job, buildlogs.NewRecorder(), downloader, builder)
+	assert.ErrorIs(t, err, artifactory.ErrLeaseLost)
+
+	// the requeued job is left untouched
+	status, workerID, err := repository.GetOwner(job.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, artifactory.WaitingForBuild, status)
+	assert.Equal(t, "", workerID)
+	logs, err := art.GetLogs(job.ID.String())
+	assert.Nil(t, err)
+	for _, auditLog := range *logs {
+		assert.NotEqual(t, artifactory.BuildSuccess, auditLog.To)
+	}
+	outcomes, _ := gatherBuildMetrics(t, reg)
+	assert.Contains(t, outcomes, map[string]string{
+		"target":      job.Target,
+		"release":     job.CommitRef,
+		"outcome":     artifactory.ErrorClassLeaseLost,
+		"error_class": artifactory.ErrorClassLeaseLost,
+	})
+}
+
+func TestRequeueJobRequiresOwner(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	repository := artifactory.NewBuildJobsDBRepository(testDB)
+	_, err := createBuildModel(testDB, artifactory.WaitingForBuild, request)
+	assert.Nil(t, err)
+	worker := &artifactory.BuildWorker{ID: uuid.NewV4().String(), Hostname: "builder"}
+	job, err := repository.ReservePendingBuild(worker)
+	assert.Nil(t, err)
+
+	other := *job
+	other.WorkerID = uuid.NewV4().String()
+	requeued, err := repository.RequeueJob(&other, "worker lost")
+	assert.Nil(t, err)
+	assert.False(t, requeued)
+
+	requeued, err = repository.RequeueJob(job, "worker lost")
+	assert.Nil(t, err)
+	assert.True(t, requeued)
+	status, workerID, err := repository.GetOwner(job.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, artifactory.WaitingForBuild, status)
+	assert.Equal(t, "", workerID)
+}
+
+func TestRequeueJobsOfRestartedWorker(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	art := newArtifactory(testDB, nil)
+	_, err := createBuildModel(testDB, artifactory.WaitingForBuild, request)
+	assert.Nil(t, err)
+	worker := &artifactory.BuildWorker{ID: uuid.NewV4().String(), Hostname: "builder"}
+	job, err := art.ReservePendingBuild(worker)
+	assert.Nil(t, err)
+
+	// another worker keeps its jobs
+	assert.Nil(t, art.RequeueWorkerJobs(uuid.NewV4().String()))
+	assert.Nil(t, art.CheckLease(job))
+
+	assert.Nil(t, art.RequeueWorkerJobs(worker.ID))
+	requeued, err := art.ReservePendingBuild(nil)
+	assert.Nil(t, err)
+	if assert.NotNil(t, requeued) {
+		assert.Equal(t, job.ID, requeued.ID)
+		assert.Equal(t, int64(0), requeued.BuildAttempts)
+	}
+}
+
+func TestHangingBuildsUseAttempts(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	art := newArtifactory(testDB, nil)
+	// restarted right away
+	art.RetryPolicy = artifactory.RetryPolicy{MaxAttempts: artifactory.MaxBuildAttempts}
+	repository := artifactory.NewBuildJobsDBRepository(testDB)
+	_, err := createBuildModel(testDB, artifactory.WaitingForBuild, request)
+	assert.Nil(t, err)
+	worker := &artifactory.BuildWorker{ID: uuid.NewV4().String(), Hostname: "builder"}
+
+	for attempt := int64(1); attempt <= artifactory.MaxBuildAttempts; attempt++ {
+		job, err := art.ReservePendingBuild(worker)
+		assert.Nil(t, err)
+		if !assert.NotNil(t, job) {
+			return
+		}
+		// the worker hangs until the build times out
+		err = testDB.Model(job).Update("build_started_at", time.Now().Add(-2*artifactory.MaxBuildDuration)).Error
+		assert.Nil(t, err)
+		assert.Nil(t, repository.TimeoutBuilds(artifactory.MaxBuildDuration))
+
+		timedOut, err := repository.FindByID(job.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, artifactory.BuildError, timedOut.Status)
+		assert.Equal(t, artifactory.TimeoutError, timedOut.ErrorType)
+		assert.Equal(t, attempt, timedOut.BuildAttempts)
+		logs, err := art.GetLogs(job.ID.String())
+		assert.Nil(t, err)
+		last := (*logs)[len(*logs)-1]
+		assert.Equal(t, artifactory.BuildInProgress, last.From)
+		assert.Equal(t, artifactory.BuildError, last.To)
+		assert.Equal(t, worker.ID, last.WorkerID)
+
+		_, err = art.CreateBuildJob(artifactory.Requester{IP: "127.0.0.1"}, request)
+		assert.Nil(t, err)
+	}
+
+	// the job is not restarted after too many attempts
+	job, err := art.ReservePendingBuild(worker)
+	assert.Nil(t, err)
+	assert.Nil(t, job)
+}
+
 func TestBuildWhenFailingToUpload(t *testing.T) {
 	uploader := &MockStorage{}
 	uploader.
-		On("Upload", mock.Anything, mock.Anything, mock.Anything).
+		On("Upload", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 		Return(errors.New("failed to upload"))
 
 	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
 	art := newArtifactory(testDB, uploader)
-	model1, err := createBuildModel(testDB, artifactory.WaitingForBuild, request)
+	model1, err := createBuildModel(testDB, artifactory.BuildInProgress, request)
 	assert.Nil(t, err)
 
 	ctx := context.Background()
@@ -338,19 +907,154 @@ func TestBuildWhenFailingToUpload(t *testing.T) {
 	builder := &MockFirmwareBuilder{}
 	builder.
 		On("Build", mock.Anything, mock.Anything, mock.Anything).
-		Return([]byte("test"), nil)
+		Return(firmwareArtifacts(t, "test"), nil)
 	model2, err := art.Build(ctx, model1, recorder, downloader, builder)
 	assert.Error(t, err, "failed to upload")
 
 	assert.Equal(t, model1.ID.String(), model2.ID.String())
-	assert.Equal(t, artifactory.BuildError, model2.Status)
+	assert.Equal(t, artifactory.WaitingForBuild, model2.Status)
 	assert.Equal(t, int64(1), model2.BuildAttempts)
+	assert.Equal(t, artifactory.StorageUploadError, model2.ErrorType)
+}
+
+func TestBuildFailureClassification(t *testing.T) {
+	tests := []struct {
+		name        string
+		logs        string
+		downloadErr error
+		buildErr    error
+		errorType   artifactory.BuildErrorType
+		excerpt     string
+		status      artifactory.BuildStatus
+	}{
+		{
+			name:        "git fetch",
+			logs:        "fatal: unable to access 'https://github.com/EdgeTX/edgetx.git/'\n",
+			downloadErr: errors.New("exit status 128"),
+			errorType:   artifactory.GitFetchError,
+			excerpt:     "fatal: unable to access 'https://github.com/EdgeTX/edgetx.git/'",
+			status:      artifactory.WaitingForBuild,
+		},
+		{
+			name:        "submodule",
+			downloadErr: fmt.Errorf("%w: exit status 1", source.ErrSubmodules),
+			errorType:   artifactory.SubmoduleError,
+			excerpt:     "failed to fetch git submodules: exit status 1",
+			status:      artifactory.WaitingForBuild,
+		},
+		{
+			name:      "image pull",
+			logs:      "Trying to pull ghcr.io/edgetx/edgetx-builder...\nError: manifest unknown\n",
+			buildErr:  fmt.Errorf("%w: exit status 125", firmware.ErrImagePull),
+			errorType: artifactory.ImagePullError,
+			excerpt:   "Error: manifest unknown",
+			status:    artifactory.WaitingForBuild,
+		},
+		{
+			name:      "cmake",
+			logs:      "-- Configuring\nCMake Error at CMakeLists.txt:12 (message):\n",
+			buildErr:  errors.New("exit status 1"),
+			errorType: artifactory.CMakeConfigureError,
+			excerpt:   "CMake Error at CMakeLists.txt:12 (message):",
+			status:    artifactory.BuildError,
+		},
+		{
+			name: "compiler",
+			logs: "[ 10%] Building CXX object main.cpp.o\n" +
+				"radio/src/main.cpp:42:3: error: 'foo' was not declared in this scope\n" +
+				"radio/src/main.cpp:43:3: error: 'bar' was not declared in this scope\n" +
+				"make: *** [all] Error 2\n",
+			buildErr:  errors.New("exit status 2"),
+			errorType: artifactory.CompilerError,
+			excerpt:   "radio/src/main.cpp:42:3: error: 'foo' was not declared in this scope",
+			status:    artifactory.BuildError,
+		},
+		{
+			name: "colored compiler output",
+			logs: "\x1b[32m[ 10%] Building CXX object main.cpp.o\x1b[0m\r\n" +
+				"\x1b[01m\x1b[Kradio/src/main.cpp:42:3:\x1b[m\x1b[K \x1b[01;31m\x1b[Kerror: \x1b[m\x1b[K" +
+				"'\x1b[01m\x1b[Kfoo\x1b[m\x1b[K' was not declared in this scope\r\n" +
+				"make: *** [all] Error 2\r\n",
+			buildErr:  errors.New("exit status 2"),
+			errorType: artifactory.CompilerError,
+			excerpt:   "radio/src/main.cpp:42:3: error: 'foo' was not declared in this scope",
+			status:    artifactory.BuildError,
+		},
+		{
+			name: "progress overwritten",
+			logs: "Cloning into 'edgetx'...\nReceiving objects:  10% (1/10)\r" +
+				"fatal: early EOF\rReceiving objects:  20% (2/10)\n",
+			downloadErr: errors.New("exit status 128"),
+			errorType:   artifactory.GitFetchError,
+			excerpt:     "fatal: early EOF",
+			status:      artifactory.WaitingForBuild,
+		},
+		{
+			name: "flash overflow",
+			logs: "arm-none-eabi/bin/ld: firmware.elf section `.text' will not fit in region `FLASH'\n" +
+				"arm-none-eabi/bin/ld: region `FLASH' overflowed by 1024 bytes\n" +
+				"collect2: error: ld returned 1 exit status\n",
+			buildErr:  errors.New("exit status 2"),
+			errorType: artifactory.LinkerError,
+			excerpt:   "arm-none-eabi/bin/ld: firmware.elf section `.text' will not fit in region `FLASH'",
+			status:    artifactory.BuildError,
+		},
+		{
+			name:      "artifact missing",
+			buildErr:  fmt.Errorf("%w: firmware", firmware.ErrArtifactNotFound),
+			errorType: artifactory.ArtifactMissingError,
+			excerpt:   "cannot find build artifact: firmware",
+			status:    artifactory.BuildError,
+		},
+		{
+			name:      "unknown",
+			logs:      "Segmentation fault\n",
+			buildErr:  errors.New("exit status 139"),
+			errorType: artifactory.UnknownError,
+			excerpt:   "exit status 139",
+			status:    artifactory.BuildError,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+			art := newArtifactory(testDB, nil)
+			model, err := createBuildModel(testDB, artifactory.BuildInProgress, request)
+			assert.Nil(t, err)
+
+			recorder := buildlogs.NewRecorder()
+			recorder.AddStdOut(test.logs)
+			downloader := &MockDownloader{}
+			downloader.
+				On("Download", mock.Anything, mock.Anything, mock.Anything).
+				Return(test.downloadErr)
+			builder := &MockFirmwareBuilder{}
+			builder.
+				On("Build", mock.Anything, mock.Anything, mock.Anything).
+				Return(nil, test.buildErr)
+			_, err = art.Build(context.Background(), model, recorder, downloader, builder)
+			assert.NotNil(t, err)
+
+			job, err := art.GetBuild(request)
+			assert.Nil(t, err)
+			assert.Equal(t, test.status, job.Status)
+			assert.Equal(t, test.errorType, job.ErrorType)
+			assert.Equal(t, test.excerpt, job.ErrorExcerpt)
+
+			jobs, err := art.ListJobs(&artifactory.JobQuery{ErrorType: string(test.errorType)})
+			assert.Nil(t, err)
+			assert.Equal(t, int64(1), jobs.TotalRows)
+			jobs, err = art.ListJobs(&artifactory.JobQuery{ErrorType: string(artifactory.TimeoutError)})
+			assert.Nil(t, err)
+			assert.Equal(t, int64(0), jobs.TotalRows)
+		})
+	}
 }
 
 func TestSuccessfulBuildJobFlow(t *testing.T) {
 	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
 	art := newArtifactory(testDB, nil)
-	model1, err := createBuildModel(testDB, artifactory.WaitingForBuild, request)
+	model1, err := createBuildModel(testDB, artifactory.BuildInProgress, request)
 	assert.Nil(t, err)
 
 	ctx := context.Background()
@@ -362,7 +1066,7 @@ func TestSuccessfulBuildJobFlow(t *testing.T) {
 	builder := &MockFirmwareBuilder{}
 	builder.
 		On("Build", mock.Anything, mock.Anything, mock.Anything).
-		Return([]byte("edgetx"), nil)
+		Return(firmwareArtifacts(t, "edgetx"), nil)
 	model2, err := art.Build(ctx, model1, recorder, downloader, builder)
 	assert.Nil(t, err)
 
@@ -370,15 +1074,21 @@ func TestSuccessfulBuildJobFlow(t *testing.T) {
 	assert.Equal(t, artifactory.BuildSuccess, model2.Status)
 	assert.Equal(t, int64(1), model2.BuildAttempts)
 	assert.Equal(t,
-		fmt.Sprintf("%s-%s", model2.CommitHash, model2.BuildFlagsHash),
+		fmt.Sprintf("%s-%s.bin", model2.CommitHash, model2.BuildFlagsHash),
 		model2.Artifacts[0].Filename,
 	)
+	// sha256("edgetx")
+	assert.Equal(t,
+		"ef3b4ee059d5090902018cbb3af0f5f14314d202a4edd491f2b3efd15a430fe7",
+		model2.Artifacts[0].SHA256,
+	)
+	assert.Equal(t, artifactory.ManifestArtifact, model2.Artifacts[1].Slug)
 }
 
 func TestJobGoesToErrorAfterTooManyFailures(t *testing.T) {
 	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
 	art := newArtifactory(testDB, nil)
-	model1, err := createBuildModel(testDB, artifactory.WaitingForBuild, request)
+	model1, err := createBuildModel(testDB, artifactory.BuildInProgress, request)
 	assert.Nil(t, err)
 
 	model1.BuildAttempts = 10
@@ -406,17 +1116,18 @@ func TestJobGoesToErrorAfterTooManyFailures(t *testing.T) {
 func TestBackoffDurationForFailedBuild(t *testing.T) {
 	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
 	art := newArtifactory(testDB, nil)
-	model1, err := createBuildModel(testDB, artifactory.WaitingForBuild, request)
+	model1, err := createBuildModel(testDB, artifactory.BuildInProgress, request)
 	assert.Nil(t, err)
 
 	model1.BuildAttempts = 1
 	model1.BuildEndedAt = time.Now()
+	model1.NextAttemptAt = time.Now().Add(time.Minute)
 
 	repository := artifactory.NewBuildJobsDBRepository(testDB)
 	err = repository.Save(model1)
 	assert.Nil(t, err)
 
-	model2, err := art.ReservePendingBuild()
+	model2, err := art.ReservePendingBuild(nil)
 	assert.Nil(t, model2)
 	assert.Nil(t, err)
 
@@ -425,6 +1136,158 @@ func TestBackoffDurationForFailedBuild(t *testing.T) {
 	assert.Equal(t, model1.BuildAttempts, model3.BuildAttempts)
 }
 
+func TestTransientFailureIsRetried(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	art := newArtifactory(testDB, nil)
+	art.RetryPolicy = artifactory.RetryPolicy{MaxAttempts: 2}
+	_, err := createBuildModel(testDB, artifactory.WaitingForBuild, request)
+	assert.Nil(t, err)
+
+	downloader := &MockDownloader{}
+	downloader.
+		On("Download", mock.Anything, mock.Anything, mock.Anything).
+		Return(errors.New("connection reset by peer"))
+	builder := &MockFirmwareBuilder{}
+	for attempt := 1; attempt <= 2; attempt++ {
+		job, err := art.ReservePendingBuild(nil)
+		assert.Nil(t, err)
+		assert.NotNil(t, job)
+		_, err = art.Build(context.Background(), job, buildlogs.NewRecorder(), downloader, builder)
+		assert.NotNil(t, err)
+	}
+
+	job, err := art.GetBuild(request)
+	assert.Nil(t, err)
+	assert.Equal(t, artifactory.BuildError, job.Status)
+	assert.Equal(t, int64(2), job.BuildAttempts)
+	logs, err := art.GetLogs(job.ID)
+	assert.Nil(t, err)
+	reasons := make([]string, 0)
+	for _, auditLog := range *logs {
+		if auditLog.Reason != "" {
+			reasons = append(reasons, auditLog.Reason)
+		}
+	}
+	assert.Equal(t, []string{
+		"retrying in 0s after GIT_FETCH failure (attempt 1 of 2): connection reset by peer",
+	}, reasons)
+}
+
+func TestDeterministicFailureIsNotRestarted(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	art := newArtifactory(testDB, nil)
+	model, err := createBuildModel(testDB, artifactory.BuildError, request)
+	assert.Nil(t, err)
+	model.BuildAttempts = 1
+	model.BuildEndedAt = time.Now()
+	model.ErrorType = artifactory.CompilerError
+	repository := artifactory.NewBuildJobsDBRepository(testDB)
+	assert.Nil(t, repository.Save(model))
+
+	job, err := art.CreateBuildJob(artifactory.Requester{IP: "127.0.0.1"}, request)
+	assert.Nil(t, err)
+	assert.Equal(t, artifactory.BuildError, job.Status)
+
+	// unlike a failure which may not happen again
+	model.ErrorType = artifactory.UnknownError
+	assert.Nil(t, repository.Save(model))
+	job, err = art.CreateBuildJob(artifactory.Requester{IP: "127.0.0.1"}, request)
+	assert.Nil(t, err)
+	assert.Equal(t, artifactory.WaitingForBuild, job.Status)
+	assert.Empty(t, job.ErrorType)
+	assert.NotNil(t, job.NextAttemptAt)
+}
+
+func TestDeleteJobRemovesStoredArtifacts(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	storageMock := &MockStorage{}
+	storageMock.On("Delete", mock.Anything, "firmware").Return(nil)
+	art := newArtifactory(testDB, storageMock)
+	model, err := createBuildModel(testDB, artifactory.BuildSuccess, request)
+	assert.Nil(t, err)
+
+	err = art.DeleteJob(context.Background(), model.ID.String())
+	assert.Nil(t, err)
+	storageMock.AssertNumberOfCalls(t, "Delete", 1)
+
+	repository := artifactory.NewBuildJobsDBRepository(testDB)
+	deleted, err := repository.FindByID(model.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, deleted)
+}
+
+func TestCollectExpiredJobs(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	storageMock := &MockStorage{}
+	storageMock.On("Delete", mock.Anything, mock.Anything).Return(nil)
+	art := newArtifactory(testDB, storageMock)
+	model, err := createBuildModel(testDB, artifactory.BuildSuccess, request)
+	assert.Nil(t, err)
+
+	model.CreatedAt = time.Now().Add(-48 * time.Hour)
+	repository := artifactory.NewBuildJobsDBRepository(testDB)
+	assert.Nil(t, repository.Save(model))
+
+	// release builds are kept forever
+	removed, err := art.CollectExpiredJobs(context.Background(), artifactory.RetentionPolicy{
+		Nightly: time.Hour,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, removed)
+
+	removed, err = art.CollectExpiredJobs(context.Background(), artifactory.RetentionPolicy{
+		Release: 24 * time.Hour,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+	storageMock.AssertCalled(t, "Delete", mock.Anything, "firmware")
+}
+
+func TestCollectOrphans(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	old := time.Now().Add(-24 * time.Hour)
+	orphan := commitHash + "-" + strings.Repeat("0", 64) + ".bin"
+	storageMock := &MockStorage{}
+	storageMock.On("List", mock.Anything).Return([]storage.ObjectInfo{
+		{Name: "firmware", ModifiedAt: old},
+		{Name: orphan, ModifiedAt: old},
+		{Name: orphan + ".sig", ModifiedAt: time.Now()},
+		{Name: commitHash + "-" + strings.Repeat("1", 64), ModifiedAt: time.Time{}},
+		{Name: "unrelated.txt", ModifiedAt: old},
+	}, nil)
+	storageMock.On("Delete", mock.Anything, orphan).Return(nil)
+	art := newArtifactory(testDB, storageMock)
+	_, err := createBuildModel(testDB, artifactory.BuildSuccess, request)
+	assert.Nil(t, err)
+
+	removed, err := art.CollectOrphans(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+	storageMock.AssertNumberOfCalls(t, "Delete", 1)
+}
+
+func TestOpenArtifactFile(t *testing.T) {
+	resetDB(testCfg.DatabaseDSN) //nolint:errcheck
+	storageMock := &MockStorage{}
+	storageMock.On("Open", mock.Anything, "firmware").Return(&storage.Object{
+		ReadSeekCloser: &nopSeekCloser{strings.NewReader("bob")},
+		ObjectInfo:     storage.ObjectInfo{Name: "firmware", Size: 3},
+	}, nil)
+	art := newArtifactory(testDB, storageMock)
+	model, err := createBuildModel(testDB, artifactory.BuildSuccess, request)
+	assert.Nil(t, err)
+
+	download, err := art.OpenArtifactFile(context.Background(), "firmware")
+	assert.Nil(t, err)
+	defer download.Close()
+	expected := fmt.Sprintf("edgetx-%s-%s-%s", commitRef, target, model.BuildFlagsHash[:8])
+	assert.Equal(t, expected, download.FileName)
+	assert.Equal(t, "application/octet-stream", download.ContentType)
+
+	_, err = art.OpenArtifactFile(context.Background(), "missing")
+	assert.ErrorIs(t, err, artifactory.ErrArtifactNotFound)
+}
+
 func TestMain(m *testing.M) {
 	v := viper.New()
 	v.Set("config-path", "./../test_config.yaml")
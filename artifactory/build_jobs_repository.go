@@ -2,6 +2,7 @@ package artifactory
 
 import (
 	"database/sql"
+	"fmt"
 	"strings"
 	"time"
 
@@ -21,15 +22,34 @@ type BuildJobsRepository interface {
 	Delete(id uuid.UUID) error
 	FindByID(ID uuid.UUID) (*BuildJobModel, error)
 	GetLogs(ID uuid.UUID) (*[]AuditLogModel, error)
+	AppendLogChunk(ID uuid.UUID, data string) error
+	GetLogChunks(ID uuid.UUID, afterSeq int64) (*[]LogChunkModel, error)
+	DeleteLogChunks(olderThan time.Duration) error
+	ListExpiredJobs(nightly bool, createdBefore time.Time, limit int) (*[]BuildJobModel, error)
+	ListArtifactFilenames() ([]string, error)
+	FindArtifactByID(ID uuid.UUID) (*ArtifactModel, error)
+	FindArtifactByFilename(fileName string) (*ArtifactModel, error)
 	Create(model BuildJobModel) (*BuildJobModel, error)
 	Save(model *BuildJobModel) error
-	ReservePendingBuild() (*BuildJobModel, error)
+	SaveTransition(model *BuildJobModel, from BuildStatus) error
+	EndBuild(model *BuildJobModel, workerID string) (bool, error)
+	CancelJob(ID uuid.UUID, requestIP string) (bool, error)
+	GetStatus(ID uuid.UUID) (BuildStatus, error)
+	GetOwner(ID uuid.UUID) (BuildStatus, string, error)
+	RequeueJob(job *BuildJobModel, reason string) (bool, error)
+	ListOrphanedJobs() (*[]BuildJobModel, error)
+	ListWorkerJobs(workerID string) (*[]BuildJobModel, error)
+	CountQueuedJobs(requester string) (int64, error)
+	ReservePendingBuild(worker *BuildWorker) (*BuildJobModel, error)
 	TimeoutBuilds(timeout time.Duration) error
 	UpdateMetrics(queued, building, failed prometheus.Gauge)
 }
 
 type BuildJobsDBRepository struct {
 	db *gorm.DB
+	// Outbox queues the notifications of the status changes,
+	// none are queued when nil.
+	Outbox JobOutbox
 }
 
 func NewBuildJobsDBRepository(db *gorm.DB) *BuildJobsDBRepository {
@@ -93,12 +113,39 @@ func (repository *BuildJobsDBRepository) GetLogs(id uuid.UUID) (*[]AuditLogModel
 	return &logs, nil
 }
 
+func (repository *BuildJobsDBRepository) AppendLogChunk(id uuid.UUID, data string) error {
+	return repository.db.Create(&LogChunkModel{
+		BuildJobID: id.String(),
+		Data:       data,
+	}).Error
+}
+
+func (repository *BuildJobsDBRepository) GetLogChunks(
+	id uuid.UUID, afterSeq int64,
+) (*[]LogChunkModel, error) {
+	chunks := make([]LogChunkModel, 0)
+	err := repository.db.Where(
+		"build_job_id = ? AND seq > ?", id.String(), afterSeq,
+	).Order("seq").Find(&chunks).Error
+	if err != nil {
+		return nil, err
+	}
+	return &chunks, nil
+}
+
+func (repository *BuildJobsDBRepository) DeleteLogChunks(olderThan time.Duration) error {
+	return repository.db.Where(
+		"created_at < ?", time.Now().Add(-1*olderThan),
+	).Delete(&LogChunkModel{}).Error
+}
+
 var statusLookup = map[string]interface{}{
 	"all":         "",
 	"success":     string(BuildSuccess),
 	"error":       string(BuildError),
 	"queued":      string(WaitingForBuild),
 	"building":    string(BuildInProgress),
+	"cancelled":   string(BuildCancelled),
 	"in-progress": []string{string(WaitingForBuild), string(BuildInProgress)},
 }
 
@@ -126,6 +173,10 @@ func jobQueryClause(query *JobQuery) func(db *gorm.DB) *gorm.DB {
 			shas := strings.Split(query.NotSha, ",")
 			db = db.Where("commit_hash NOT IN(?)", shas)
 		}
+		if query.ErrorType != "" {
+			errorTypes := strings.Split(query.ErrorType, ",")
+			db = db.Where("error_type IN(?)", errorTypes)
+		}
 		return db
 	}
 }
@@ -152,66 +203,217 @@ func (repository *BuildJobsDBRepository) Delete(id uuid.UUID) error {
 	return repository.db.Select(clause.Associations).Delete(&BuildJobModel{ID: id}).Error
 }
 
+func (repository *BuildJobsDBRepository) ListExpiredJobs(
+	nightly bool, createdBefore time.Time, limit int,
+) (*[]BuildJobModel, error) {
+	var jobs []BuildJobModel
+	tx := repository.db.Preload("Artifacts").Where(
+		"status NOT IN (?) AND created_at < ?",
+		[]BuildStatus{WaitingForBuild, BuildInProgress},
+		createdBefore,
+	)
+	if nightly {
+		tx = tx.Where("commit_ref = ?", NightlyRef)
+	} else {
+		tx = tx.Where("commit_ref <> ?", NightlyRef)
+	}
+	err := tx.Order("created_at").Limit(limit).Find(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+	return &jobs, nil
+}
+
+func (repository *BuildJobsDBRepository) ListArtifactFilenames() ([]string, error) {
+	var fileNames []string
+	err := repository.db.Model(&ArtifactModel{}).Pluck("filename", &fileNames).Error
+	return fileNames, err
+}
+
+func (repository *BuildJobsDBRepository) FindArtifactByID(id uuid.UUID) (*ArtifactModel, error) {
+	return repository.findArtifact(&ArtifactModel{ID: id})
+}
+
+func (repository *BuildJobsDBRepository) FindArtifactByFilename(fileName string) (*ArtifactModel, error) {
+	return repository.findArtifact(&ArtifactModel{Filename: fileName})
+}
+
+func (repository *BuildJobsDBRepository) findArtifact(query *ArtifactModel) (*ArtifactModel, error) {
+	var artifact ArtifactModel
+	err := repository.db.Where(query).Preload("BuildJob").First(&artifact).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &artifact, nil
+}
+
+// notify queues the notifications of a status change in tx.
+func (repository *BuildJobsDBRepository) notify(
+	tx *gorm.DB, job *BuildJobModel, from, to BuildStatus,
+) error {
+	if repository.Outbox == nil {
+		return nil
+	}
+	if err := repository.Outbox.EnqueueStatusChange(tx, job, from, to); err != nil {
+		return errors.Wrap(err, "failed to queue status change notifications")
+	}
+	return nil
+}
+
 func (repository *BuildJobsDBRepository) Create(model BuildJobModel) (*BuildJobModel, error) {
-	err := repository.db.Session(
-		&gorm.Session{FullSaveAssociations: true},
-	).Create(&model).Error
+	err := repository.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Session(
+			&gorm.Session{FullSaveAssociations: true},
+		).Create(&model).Error
+		if err != nil {
+			return err
+		}
+		return repository.notify(tx, &model, VoidStatus, model.Status)
+	})
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create build job")
 	}
 	return &model, nil
 }
 
+// TimeoutBuilds fails the builds started more than timeout ago. The attempt
+// is counted here, as the worker cannot save it anymore (see EndBuild).
 func (repository *BuildJobsDBRepository) TimeoutBuilds(timeout time.Duration) error {
-	return repository.db.Exec(
-		`
-			UPDATE build_jobs
-			SET status = @newStatus
-			WHERE status = @currentStatus AND build_started_at < @buildStartedAt
-		`,
-		sql.Named("currentStatus", BuildInProgress),
-		sql.Named("newStatus", BuildError),
-		sql.Named("buildStartedAt", time.Now().Add(-1*timeout)),
-	).Error
-}
-
-func (repository *BuildJobsDBRepository) ReservePendingBuild() (*BuildJobModel, error) {
 	var jobs []BuildJobModel
-	backoffDuration := time.Minute
-	err := repository.db.Raw(
-		`
-			UPDATE build_jobs
-			SET status = @newStatus, build_started_at = @buildStartedAt
-			WHERE id = (
-				SELECT id FROM build_jobs
-				WHERE status = @currentStatus AND build_ended_at < @minBuildEndedAt
-				LIMIT 1
-				FOR UPDATE SKIP LOCKED
-			)
-			RETURNING id
-		`,
-		sql.Named("newStatus", BuildInProgress),
-		sql.Named("buildStartedAt", time.Now()),
-		sql.Named("currentStatus", WaitingForBuild),
-		sql.Named("minBuildEndedAt", time.Now().Add(backoffDuration*-1)),
-	).Scan(&jobs).Error
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to reserve job for build")
-	}
-
-	if len(jobs) == 0 {
-		return nil, nil
+	err := repository.db.Where(
+		"status = ? AND build_started_at < ?", BuildInProgress, time.Now().Add(-1*timeout),
+	).Find(&jobs).Error
+	if err != nil {
+		return err
 	}
+	for i := range jobs {
+		job := &jobs[i]
+		reason := fmt.Sprintf("no build result after %s", timeout)
+		err := repository.db.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&BuildJobModel{}).
+				Where("id = ? AND status = ? AND worker_id = ?", job.ID, BuildInProgress, job.WorkerID).
+				Updates(map[string]interface{}{
+					"status":         BuildError,
+					"build_attempts": gorm.Expr("build_attempts + 1"),
+					"build_ended_at": time.Now(),
+					"error_type":     TimeoutError,
+					"error_excerpt":  reason,
+				})
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			err := tx.Create(&AuditLogModel{
+				BuildJobID:     job.ID.String(),
+				WorkerID:       job.WorkerID,
+				WorkerHostname: job.WorkerHostname,
+				From:           BuildInProgress,
+				To:             BuildError,
+				Reason:         reason,
+			}).Error
+			if err != nil {
+				return err
+			}
+			return repository.notify(tx, job, BuildInProgress, BuildError)
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to time out build")
+		}
+	}
+	return nil
+}
 
-	var buildJob BuildJobModel
-	err = repository.db.Where(&BuildJobModel{
-		ID: jobs[0].ID,
-	}).Preload("Artifacts").First(&buildJob).Error
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to find reserved job")
+// ReservePendingBuild picks the next job to build: highest priority first,
+// then the requester with the fewest builds started within FairShareWindow
+// (so that one client cannot monopolize the workers), then the oldest job.
+// Only the jobs the worker can build are considered, see WorkerCapabilities:
+// the queue is read by pages of reserveCandidates jobs until one is found.
+func (repository *BuildJobsDBRepository) ReservePendingBuild(
+	worker *BuildWorker,
+) (*BuildJobModel, error) {
+	var workerID, workerHostname string
+	if worker != nil {
+		workerID, workerHostname = worker.ID, worker.Hostname
 	}
+	now := time.Now()
+	for offset := 0; ; offset += reserveCandidates {
+		var queued []BuildJobModel
+		err := repository.db.Raw(
+			`
+				SELECT * FROM build_jobs AS job
+				WHERE status = @currentStatus AND next_attempt_at <= @now
+				ORDER BY
+					priority DESC,
+					(
+						SELECT count(*) FROM build_jobs AS started
+						WHERE started.requester = job.requester
+						AND started.build_started_at > @fairShareSince
+					) ASC,
+					created_at ASC,
+					id ASC
+				LIMIT @limit OFFSET @offset
+			`,
+			sql.Named("currentStatus", WaitingForBuild),
+			sql.Named("now", now),
+			sql.Named("fairShareSince", now.Add(-FairShareWindow)),
+			sql.Named("limit", reserveCandidates),
+			sql.Named("offset", offset),
+		).Scan(&queued).Error
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list jobs waiting for build")
+		}
 
-	return &buildJob, nil
+		for _, candidate := range worker.capabilities().pickOrder(queued) {
+			buildJob, err := repository.reserve(candidate.ID, workerID, workerHostname)
+			if err != nil {
+				return nil, err
+			}
+			if buildJob != nil {
+				return buildJob, nil
+			}
+		}
+		if len(queued) < reserveCandidates {
+			return nil, nil
+		}
+	}
+}
+
+// reserve starts the build of a queued job, it returns nil if
+// another worker reserved it meanwhile.
+func (repository *BuildJobsDBRepository) reserve(
+	id uuid.UUID, workerID, workerHostname string,
+) (*BuildJobModel, error) {
+	var buildJob *BuildJobModel
+	err := repository.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&BuildJobModel{}).
+			Where("id = ? AND status = ?", id, WaitingForBuild).
+			Updates(map[string]interface{}{
+				"status":           BuildInProgress,
+				"build_started_at": time.Now(),
+				"worker_id":        workerID,
+				"worker_hostname":  workerHostname,
+			})
+		if res.Error != nil {
+			return errors.Wrap(res.Error, "failed to reserve job for build")
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+
+		var job BuildJobModel
+		err := tx.Where(&BuildJobModel{ID: id}).Preload("Artifacts").First(&job).Error
+		if err != nil {
+			return errors.Wrap(err, "failed to find reserved job")
+		}
+		buildJob = &job
+		return repository.notify(tx, buildJob, WaitingForBuild, BuildInProgress)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buildJob, nil
 }
 
 func (repository *BuildJobsDBRepository) Save(model *BuildJobModel) error {
@@ -220,6 +422,173 @@ func (repository *BuildJobsDBRepository) Save(model *BuildJobModel) error {
 	).Save(model).Error
 }
 
+// SaveTransition saves a job whose status changed from from, and queues
+// the notifications of the change in the same transaction.
+func (repository *BuildJobsDBRepository) SaveTransition(model *BuildJobModel, from BuildStatus) error {
+	return repository.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Session(
+			&gorm.Session{FullSaveAssociations: true},
+		).Save(model).Error
+		if err != nil {
+			return err
+		}
+		return repository.notify(tx, model, from, model.Status)
+	})
+}
+
+// EndBuild saves a job whose build by workerID ended, and queues the
+// notifications of its new status in the same transaction. It returns false,
+// without saving anything, if the job is not being built by workerID anymore
+// (cancelled, requeued or timed out meanwhile).
+func (repository *BuildJobsDBRepository) EndBuild(model *BuildJobModel, workerID string) (bool, error) {
+	ended := false
+	err := repository.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&BuildJobModel{}).
+			Where("id = ? AND status = ? AND worker_id = ?", model.ID, BuildInProgress, workerID).
+			Update("status", model.Status)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		ended = true
+		err := tx.Session(
+			&gorm.Session{FullSaveAssociations: true},
+		).Save(model).Error
+		if err != nil {
+			return err
+		}
+		return repository.notify(tx, model, BuildInProgress, model.Status)
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "failed to end build")
+	}
+	return ended, nil
+}
+
+// CancelJob moves a pending job to BuildCancelled and records the transition.
+// It returns false if the job is not pending (anymore).
+func (repository *BuildJobsDBRepository) CancelJob(id uuid.UUID, requestIP string) (bool, error) {
+	cancelled := false
+	err := repository.db.Transaction(func(tx *gorm.DB) error {
+		var job BuildJobModel
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(&BuildJobModel{ID: id}).First(&job).Error
+		if err != nil {
+			return err
+		}
+		if !job.Status.IsPending() {
+			return nil
+		}
+		// Updates assigns the new status to job
+		from := job.Status
+		now := time.Now()
+		err = tx.Model(&job).Updates(map[string]interface{}{
+			"status":         BuildCancelled,
+			"build_ended_at": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		cancelled = true
+		err = tx.Create(&AuditLogModel{
+			BuildJobID: id.String(),
+			RequestIP:  requestIP,
+			From:       from,
+			To:         BuildCancelled,
+			CreatedAt:  now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return repository.notify(tx, &job, from, BuildCancelled)
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "failed to cancel job")
+	}
+	return cancelled, nil
+}
+
+func (repository *BuildJobsDBRepository) GetStatus(id uuid.UUID) (BuildStatus, error) {
+	var job BuildJobModel
+	err := repository.db.Select("status").Where(&BuildJobModel{ID: id}).First(&job).Error
+	if err != nil {
+		return VoidStatus, err
+	}
+	return job.Status, nil
+}
+
+// GetOwner returns the status of a job and the ID of the worker building it.
+func (repository *BuildJobsDBRepository) GetOwner(id uuid.UUID) (BuildStatus, string, error) {
+	var job BuildJobModel
+	err := repository.db.Select("status", "worker_id").Where(&BuildJobModel{ID: id}).First(&job).Error
+	if err != nil {
+		return VoidStatus, "", err
+	}
+	return job.Status, job.WorkerID, nil
+}
+
+// RequeueJob moves a job being built by job.WorkerID back to WaitingForBuild
+// and records why. It returns false if the worker does not own the job.
+func (repository *BuildJobsDBRepository) RequeueJob(job *BuildJobModel, reason string) (bool, error) {
+	requeued := false
+	err := repository.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&BuildJobModel{}).
+			Where("id = ? AND status = ? AND worker_id = ?", job.ID, BuildInProgress, job.WorkerID).
+			Updates(map[string]interface{}{
+				"status":          WaitingForBuild,
+				"worker_id":       "",
+				"worker_hostname": "",
+				"next_attempt_at": time.Now(),
+			})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		requeued = true
+		err := tx.Create(&AuditLogModel{
+			BuildJobID:     job.ID.String(),
+			WorkerID:       job.WorkerID,
+			WorkerHostname: job.WorkerHostname,
+			From:           BuildInProgress,
+			To:             WaitingForBuild,
+			Reason:         reason,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return repository.notify(tx, job, BuildInProgress, WaitingForBuild)
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "failed to requeue job")
+	}
+	return requeued, nil
+}
+
+// ListOrphanedJobs returns the jobs being built by workers that are gone.
+func (repository *BuildJobsDBRepository) ListOrphanedJobs() (*[]BuildJobModel, error) {
+	var jobs []BuildJobModel
+	err := repository.db.Where(
+		`status = ? AND worker_id <> '' AND NOT EXISTS (
+			SELECT 1 FROM workers WHERE CAST(workers.id AS TEXT) = build_jobs.worker_id
+		)`,
+		BuildInProgress,
+	).Find(&jobs).Error
+	return &jobs, err
+}
+
+// ListWorkerJobs returns the jobs being built by the worker workerID.
+func (repository *BuildJobsDBRepository) ListWorkerJobs(workerID string) (*[]BuildJobModel, error) {
+	var jobs []BuildJobModel
+	err := repository.db.Where("status = ? AND worker_id = ?", BuildInProgress, workerID).
+		Find(&jobs).Error
+	return &jobs, err
+}
+
+func (repository *BuildJobsDBRepository) CountQueuedJobs(requester string) (int64, error) {
+	var count int64
+	err := repository.db.Scopes(countRequestsByStatus(WaitingForBuild)).
+		Where("requester = ?", requester).Count(&count).Error
+	return count, err
+}
+
 func countRequestsByStatus(status interface{}) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		return db.Model(&BuildJobModel{}).Where(
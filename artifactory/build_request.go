@@ -16,6 +16,7 @@ var (
 	ErrReleaseNotSupported    = errors.New("release not supported")
 	ErrTargetNotSupported     = errors.New("target not supported")
 	ErrOptionFlagNotSupported = errors.New("option flag not supported")
+	ErrPriorityNotAllowed     = errors.New("only authenticated requests can set a priority")
 )
 
 type OptionFlag struct {
@@ -24,10 +25,15 @@ type OptionFlag struct {
 }
 
 type BuildRequest struct {
-	Release string              `json:"release"`
-	Target  string              `json:"target"`
-	Flags   []OptionFlag        `json:"flags"`
-	defs    *targets.TargetsDef `json:"-"`
+	Release string       `json:"release"`
+	Target  string       `json:"target"`
+	Flags   []OptionFlag `json:"flags"`
+	// Priority jobs are built first, it does not change the build hash.
+	Priority int `json:"priority,omitempty"`
+	// CallbackURL is notified of the job status changes,
+	// it does not change the build hash.
+	CallbackURL string              `json:"callback_url,omitempty"`
+	defs        *targets.TargetsDef `json:"-"`
 }
 
 type BuildRequestError struct {
@@ -79,6 +85,14 @@ func (req *BuildRequest) Validate() error {
 			}
 		}
 	}
+	if req.CallbackURL != "" {
+		if err := ValidateWebhookURL(req.CallbackURL); err != nil {
+			return &BuildRequestError{
+				Err:  ErrInvalidWebhookURL,
+				What: req.CallbackURL,
+			}
+		}
+	}
 	return nil
 }
 
@@ -130,10 +144,30 @@ func (req *BuildRequest) GetBuildFlags() (*[]firmware.BuildFlag, error) {
 	return &buildFlags, nil
 }
 
+func (req *BuildRequest) GetArtifactRules() []firmware.ArtifactRule {
+	rules := make([]firmware.ArtifactRule, 0)
+	for _, rule := range req.defs.GetTargetArtifacts(req.Target) {
+		rules = append(rules, firmware.ArtifactRule{
+			Slug:     rule.Slug,
+			Patterns: rule.Patterns,
+			Optional: rule.Optional,
+		})
+	}
+	return rules
+}
+
 func (req *BuildRequest) GetBuildContainerImage() string {
 	return req.defs.GetBuildContainer(req.Release)
 }
 
+// GetRequirements returns what a worker needs to build the request.
+func (req *BuildRequest) GetRequirements() JobRequirements {
+	return JobRequirements{
+		Platforms:   req.defs.GetReleasePlatforms(req.Release),
+		MinMemoryMB: req.defs.GetTargetMinMemory(req.Target),
+	}
+}
+
 func (req *BuildRequest) GetCommitHash() string {
 	return req.defs.GetCommitHashByRef(req.Release)
 }
@@ -0,0 +1,44 @@
+package artifactory
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+
+	"lukechampine.com/blake3"
+)
+
+// checksummer computes artifact checksums while the data is being uploaded.
+type checksummer struct {
+	sha256 hash.Hash
+	blake3 hash.Hash
+}
+
+func newChecksummer(withBlake3 bool) *checksummer {
+	c := &checksummer{
+		sha256: sha256.New(),
+	}
+	if withBlake3 {
+		c.blake3 = blake3.New(32, nil)
+	}
+	return c
+}
+
+func (c *checksummer) Reader(r io.Reader) io.Reader {
+	if c.blake3 != nil {
+		return io.TeeReader(r, io.MultiWriter(c.sha256, c.blake3))
+	}
+	return io.TeeReader(r, c.sha256)
+}
+
+func (c *checksummer) SHA256() string {
+	return hex.EncodeToString(c.sha256.Sum(nil))
+}
+
+func (c *checksummer) BLAKE3() string {
+	if c.blake3 == nil {
+		return ""
+	}
+	return hex.EncodeToString(c.blake3.Sum(nil))
+}
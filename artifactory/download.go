@@ -0,0 +1,171 @@
+package artifactory
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/edgetx/cloudbuild/config"
+	"github.com/edgetx/cloudbuild/storage"
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DownloadModePublic    = config.DownloadModePublic
+	DownloadModePresigned = config.DownloadModePresigned
+	DownloadModeSigned    = config.DownloadModeSigned
+)
+
+var (
+	ErrBadDownloadMode  = errors.New("unsupported download mode")
+	ErrBadDownloadSig   = errors.New("invalid download signature")
+	ErrDownloadExpired  = errors.New("download link expired")
+	ErrArtifactNotFound = errors.New("artifact not found")
+)
+
+// ValidateDownloadMode checks that artifact download URLs can be
+// issued with the configured mode and storage.
+func (artifactory *Artifactory) ValidateDownloadMode() error {
+	switch artifactory.DownloadMode {
+	case "", DownloadModePublic:
+		return nil
+	case DownloadModePresigned:
+		if _, ok := artifactory.ArtifactStorage.(storage.Presigner); !ok {
+			return fmt.Errorf("%w: storage cannot presign URLs", ErrBadDownloadMode)
+		}
+		return nil
+	case DownloadModeSigned:
+		if len(artifactory.DownloadSecret) == 0 {
+			return fmt.Errorf("%w: missing download secret", ErrBadDownloadMode)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrBadDownloadMode, artifactory.DownloadMode)
+	}
+}
+
+func (artifactory *Artifactory) downloadSignature(artifactID string, expires int64) string {
+	mac := hmac.New(sha256.New, artifactory.DownloadSecret)
+	fmt.Fprintf(mac, "%s\n%d", artifactID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DownloadURL returns the URL at which the artifact of build can be downloaded.
+func (artifactory *Artifactory) DownloadURL(build *BuildJobModel, artifact *ArtifactModel) string {
+	switch artifactory.DownloadMode {
+	case DownloadModePresigned:
+		presigner, _ := artifactory.ArtifactStorage.(storage.Presigner)
+		downloadURL, err := presigner.PresignURL(
+			context.Background(), artifact.Filename,
+			ArtifactFileName(artifactory.FileNameTemplate, build, artifact),
+			artifactory.DownloadExpiry,
+		)
+		if err != nil {
+			log.Errorf("failed to presign %s: %s", artifact.Filename, err)
+			return ""
+		}
+		return downloadURL
+	case DownloadModeSigned:
+		id := artifact.ID.String()
+		expires := time.Now().Add(artifactory.DownloadExpiry).Unix()
+		downloadURL := artifactory.PrefixURL.JoinPath("api", "artifacts", id, "download")
+		downloadURL.RawQuery = url.Values{
+			"expires":   {strconv.FormatInt(expires, 10)},
+			"signature": {artifactory.downloadSignature(id, expires)},
+		}.Encode()
+		return downloadURL.String()
+	default:
+		return artifactory.PrefixURL.JoinPath(artifact.Filename).String()
+	}
+}
+
+// PublicDownloads tells whether artifacts may be downloaded
+// without a time-limited URL.
+func (artifactory *Artifactory) PublicDownloads() bool {
+	return artifactory.DownloadMode == "" || artifactory.DownloadMode == DownloadModePublic
+}
+
+// VerifyDownload checks the signature and expiry of a signed download URL.
+func (artifactory *Artifactory) VerifyDownload(artifactID, expires, signature string) error {
+	if len(artifactory.DownloadSecret) == 0 {
+		return ErrBadDownloadSig
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrBadDownloadSig
+	}
+	expected := artifactory.downloadSignature(artifactID, expiresAt)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrBadDownloadSig
+	}
+	if time.Now().Unix() > expiresAt {
+		return ErrDownloadExpired
+	}
+	return nil
+}
+
+// ArtifactDownload is a stored artifact ready to be served.
+type ArtifactDownload struct {
+	*storage.Object
+	// FileName is the name offered to the user when saving the file.
+	FileName string
+}
+
+// OpenArtifact opens the stored content of the artifact with artifactID.
+func (artifactory *Artifactory) OpenArtifact(
+	ctx context.Context, artifactID string,
+) (*ArtifactDownload, error) {
+	uid, err := uuid.FromString(artifactID)
+	if err != nil {
+		return nil, ErrArtifactNotFound
+	}
+	artifact, err := artifactory.BuildJobsRepository.FindArtifactByID(uid)
+	if err != nil {
+		return nil, err
+	}
+	return artifactory.openArtifact(ctx, artifact)
+}
+
+// OpenArtifactFile opens the stored content of the artifact
+// stored as fileName.
+func (artifactory *Artifactory) OpenArtifactFile(
+	ctx context.Context, fileName string,
+) (*ArtifactDownload, error) {
+	artifact, err := artifactory.BuildJobsRepository.FindArtifactByFilename(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return artifactory.openArtifact(ctx, artifact)
+}
+
+func (artifactory *Artifactory) openArtifact(
+	ctx context.Context, artifact *ArtifactModel,
+) (*ArtifactDownload, error) {
+	if artifact == nil {
+		return nil, ErrArtifactNotFound
+	}
+	object, err := artifactory.ArtifactStorage.Open(ctx, artifact.Filename)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return nil, ErrArtifactNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if artifact.SHA256 != "" {
+		object.ETag = fmt.Sprintf("%q", artifact.SHA256)
+	}
+	if object.ContentType == "" {
+		object.ContentType = "application/octet-stream"
+	}
+	return &ArtifactDownload{
+		Object:   object,
+		FileName: ArtifactFileName(artifactory.FileNameTemplate, &artifact.BuildJob, artifact),
+	}, nil
+}
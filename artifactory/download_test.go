@@ -0,0 +1,56 @@
+package artifactory_test
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/edgetx/cloudbuild/artifactory"
+	"github.com/edgetx/cloudbuild/storage"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublicDownloadURL(t *testing.T) {
+	prefixURL, _ := url.Parse("https://bucket.example.com/firmwares")
+	art := artifactory.New(nil, storage.NewLocalStorage(t.TempDir()), "", "", prefixURL)
+	assert.Nil(t, art.ValidateDownloadMode())
+
+	artifact := &artifactory.ArtifactModel{Filename: "abcd.bin"}
+	assert.Equal(t, "https://bucket.example.com/firmwares/abcd.bin", art.DownloadURL(&artifactory.BuildJobModel{}, artifact))
+}
+
+func TestSignedDownloadURL(t *testing.T) {
+	prefixURL, _ := url.Parse("https://cloudbuild.example.com")
+	art := artifactory.New(nil, storage.NewLocalStorage(t.TempDir()), "", "", prefixURL)
+	art.DownloadMode = artifactory.DownloadModeSigned
+	assert.ErrorIs(t, art.ValidateDownloadMode(), artifactory.ErrBadDownloadMode)
+
+	art.DownloadSecret = []byte("secret")
+	art.DownloadExpiry = time.Hour
+	assert.Nil(t, art.ValidateDownloadMode())
+
+	artifact := &artifactory.ArtifactModel{ID: uuid.NewV4(), Filename: "abcd.bin"}
+	downloadURL, err := url.Parse(art.DownloadURL(&artifactory.BuildJobModel{}, artifact))
+	assert.Nil(t, err)
+	assert.Equal(t, "/api/artifacts/"+artifact.ID.String()+"/download", downloadURL.Path)
+
+	id := artifact.ID.String()
+	expires := downloadURL.Query().Get("expires")
+	signature := downloadURL.Query().Get("signature")
+	assert.Nil(t, art.VerifyDownload(id, expires, signature))
+	assert.ErrorIs(t, art.VerifyDownload(uuid.NewV4().String(), expires, signature),
+		artifactory.ErrBadDownloadSig)
+	assert.ErrorIs(t, art.VerifyDownload(id, expires+"0", signature),
+		artifactory.ErrBadDownloadSig)
+
+	art.DownloadExpiry = -time.Minute
+	expired, _ := url.Parse(art.DownloadURL(&artifactory.BuildJobModel{}, artifact))
+	assert.ErrorIs(t, art.VerifyDownload(
+		id, expired.Query().Get("expires"), expired.Query().Get("signature"),
+	), artifactory.ErrDownloadExpired)
+
+	past := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	assert.ErrorIs(t, art.VerifyDownload(id, past, signature), artifactory.ErrBadDownloadSig)
+}
@@ -19,6 +19,13 @@ type BuildJobDto struct {
 	AuditLogs      []AuditLogDto        `json:"build_logs,omitempty"`
 	ContainerImage string               `json:"container_image"`
 	BuildFlagsHash string               `json:"build_flags_hash"`
+	Priority       int                  `json:"priority"`
+	Requirements   *JobRequirements     `json:"requirements,omitempty"`
+	WorkerID       string               `json:"worker_id,omitempty"`
+	WorkerHostname string               `json:"worker_hostname,omitempty"`
+	ErrorType      BuildErrorType       `json:"error_type,omitempty"`
+	ErrorExcerpt   string               `json:"error_excerpt,omitempty"`
+	NextAttemptAt  *time.Time           `json:"next_attempt_at,omitempty"`
 	BuildStartedAt time.Time            `json:"build_started_at"`
 	BuildEndedAt   time.Time            `json:"build_ended_at"`
 	CreatedAt      time.Time            `json:"created_at"`
@@ -30,15 +37,59 @@ type ArtifactDto struct {
 	Slug        string    `json:"slug"`
 	DownloadURL string    `json:"download_url"`
 	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256,omitempty"`
+	BLAKE3      string    `json:"blake3,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 type AuditLogDto struct {
-	ID        string      `json:"id"`
-	From      BuildStatus `json:"from"`
-	To        BuildStatus `json:"to"`
-	StdOut    string      `json:"std_out"`
-	CreatedAt time.Time   `json:"created_at"`
-	UpdatedAt time.Time   `json:"updated_at"`
+	ID             string      `json:"id"`
+	From           BuildStatus `json:"from"`
+	To             BuildStatus `json:"to"`
+	WorkerID       string      `json:"worker_id,omitempty"`
+	WorkerHostname string      `json:"worker_hostname,omitempty"`
+	Reason         string      `json:"reason,omitempty"`
+	StdOut         string      `json:"std_out"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+}
+
+type LogChunkDto struct {
+	Seq       int64     `json:"seq"`
+	Data      string    `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LiveLogsDto struct {
+	Status BuildStatus   `json:"status"`
+	Chunks []LogChunkDto `json:"chunks"`
+}
+
+type WebhookSubscriptionDto struct {
+	ID        string        `json:"id"`
+	URL       string        `json:"url"`
+	Secret    string        `json:"secret,omitempty"`
+	Statuses  []BuildStatus `json:"statuses"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+type WebhookAttemptDto struct {
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookDeliveryDto struct {
+	ID             string                `json:"id"`
+	SubscriptionID string                `json:"subscription_id,omitempty"`
+	BuildJobID     string                `json:"job_id"`
+	URL            string                `json:"url"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       []WebhookAttemptDto   `json:"attempts"`
+	NextAttemptAt  time.Time             `json:"next_attempt_at"`
+	DeliveredAt    time.Time             `json:"delivered_at"`
+	CreatedAt      time.Time             `json:"created_at"`
 }
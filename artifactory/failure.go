@@ -0,0 +1,100 @@
+package artifactory
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/edgetx/cloudbuild/firmware"
+	"github.com/edgetx/cloudbuild/source"
+)
+
+// maxErrorExcerpt bounds the excerpt stored with a failed build.
+const maxErrorExcerpt = 300
+
+type failurePattern struct {
+	errorType BuildErrorType
+	pattern   *regexp.Regexp
+}
+
+// buildFailurePatterns recognize the lines of the build output explaining
+// a failure. The first matching line of the output is the excerpt.
+var buildFailurePatterns = []failurePattern{
+	{CMakeConfigureError, regexp.MustCompile(`^CMake Error|Configuring incomplete, errors occurred`)},
+	{LinkerError, regexp.MustCompile(
+		"region `?\\w+'? overflowed by|will not fit in region|undefined reference to|" +
+			`multiple definition of|ld returned \d+ exit status`,
+	)},
+	{CompilerError, regexp.MustCompile(`^\S+:\d+(:\d+)?: (fatal )?error: `)},
+}
+
+var (
+	gitFailurePattern       = regexp.MustCompile(`^(fatal|error): `)
+	containerFailurePattern = regexp.MustCompile(`^Error\b`)
+	// ansiSequence matches the color and cursor control sequences (CSI)
+	// of the compilers and tools writing to a terminal.
+	ansiSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+)
+
+// classifyFailure returns the type of a build failure in the phase of class,
+// with an excerpt of the logs or of the error explaining it.
+func classifyFailure(ctx context.Context, err error, class string, logs string) (BuildErrorType, string) {
+	if errorClass(ctx, class) == ErrorClassTimeout || errors.Is(err, context.DeadlineExceeded) {
+		return TimeoutError, excerpt(err.Error())
+	}
+	switch class {
+	case ErrorClassSource:
+		errorType := GitFetchError
+		if errors.Is(err, source.ErrSubmodules) {
+			errorType = SubmoduleError
+		}
+		// after a mirror failure, the last error is the one of the direct fetch
+		return errorType, lastMatch(logs, gitFailurePattern, err)
+	case ErrorClassBuild:
+		switch {
+		case errors.Is(err, firmware.ErrImagePull):
+			return ImagePullError, lastMatch(logs, containerFailurePattern, err)
+		case errors.Is(err, firmware.ErrArtifactNotFound):
+			return ArtifactMissingError, excerpt(err.Error())
+		}
+		for _, line := range outputLines(logs) {
+			for _, failure := range buildFailurePatterns {
+				if failure.pattern.MatchString(line) {
+					return failure.errorType, excerpt(line)
+				}
+			}
+		}
+	case ErrorClassUpload:
+		return StorageUploadError, excerpt(err.Error())
+	}
+	return UnknownError, excerpt(err.Error())
+}
+
+// lastMatch returns the last line of logs matching pattern, or err if none does.
+func lastMatch(logs string, pattern *regexp.Regexp, err error) string {
+	lines := outputLines(logs)
+	for i := len(lines) - 1; i >= 0; i-- {
+		if pattern.MatchString(lines[i]) {
+			return excerpt(lines[i])
+		}
+	}
+	return excerpt(err.Error())
+}
+
+// outputLines splits the build output in lines without control sequences,
+// the lines overwritten with a carriage return (e.g. progress) included.
+func outputLines(logs string) []string {
+	logs = ansiSequence.ReplaceAllString(logs, "")
+	return strings.FieldsFunc(logs, func(r rune) bool {
+		return r == '\n' || r == '\r'
+	})
+}
+
+func excerpt(text string) string {
+	text = strings.TrimSpace(ansiSequence.ReplaceAllString(text, ""))
+	if runes := []rune(text); len(runes) > maxErrorExcerpt {
+		return string(runes[:maxErrorExcerpt-1]) + "…"
+	}
+	return text
+}
@@ -0,0 +1,69 @@
+package artifactory
+
+import (
+	"path"
+	"strings"
+
+	"github.com/edgetx/cloudbuild/firmware"
+)
+
+// DefaultFileNameTemplate is used when no template is configured.
+const DefaultFileNameTemplate = "edgetx-{release}-{target}-{flags_short}.{ext}"
+
+// flagsShortLength is the number of build flags hash characters
+// used by {flags_short}.
+const flagsShortLength = 8
+
+// fileNameSanitizer keeps the rendered name a single path element.
+var fileNameSanitizer = strings.NewReplacer("/", "_", "\\", "_", "\"", "_")
+
+// ArtifactFileName renders the name under which an artifact is offered
+// for download. The template supports the following placeholders:
+//
+//	{target}       target name (e.g. tx16s)
+//	{release}      release or branch (e.g. v2.10.5 or nightly)
+//	{commit}       short commit hash
+//	{flags_hash}   hash of the target and build flags
+//	{flags_short}  first characters of the flags hash
+//	{slug}         artifact slug (e.g. firmware, elf)
+//	{ext}          original extension without dot (e.g. uf2 or bin)
+//
+// Unless {slug} is used, artifacts other than the firmware get their slug
+// appended to the name, so that all artifacts of a build have distinct names.
+func ArtifactFileName(template string, build *BuildJobModel, artifact *ArtifactModel) string {
+	if template == "" {
+		template = DefaultFileNameTemplate
+	}
+	ext := strings.TrimPrefix(path.Ext(artifact.Filename), ".")
+	if ext == "" {
+		// e.g. artifacts stored before extensions were kept
+		template = strings.ReplaceAll(template, ".{ext}", "")
+	}
+	if !strings.Contains(template, "{slug}") &&
+		artifact.Slug != "" && artifact.Slug != firmware.FirmwareArtifact {
+		if strings.HasSuffix(template, ".{ext}") {
+			template = strings.TrimSuffix(template, ".{ext}") + "-{slug}.{ext}"
+		} else {
+			template += "-{slug}"
+		}
+	}
+
+	commit := build.CommitHash
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+	flagsShort := build.BuildFlagsHash
+	if len(flagsShort) > flagsShortLength {
+		flagsShort = flagsShort[:flagsShortLength]
+	}
+	name := strings.NewReplacer(
+		"{target}", build.Target,
+		"{release}", build.CommitRef,
+		"{commit}", commit,
+		"{flags_hash}", build.BuildFlagsHash,
+		"{flags_short}", flagsShort,
+		"{slug}", artifact.Slug,
+		"{ext}", ext,
+	).Replace(template)
+	return fileNameSanitizer.Replace(name)
+}
@@ -0,0 +1,37 @@
+package artifactory_test
+
+import (
+	"testing"
+
+	"github.com/edgetx/cloudbuild/artifactory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArtifactFileName(t *testing.T) {
+	build := &artifactory.BuildJobModel{
+		CommitHash:     "3ca63cbb9bb7fe14c22e0349b668900f125e2d09",
+		CommitRef:      "v2.10.5",
+		Target:         "tx16s",
+		BuildFlagsHash: "1a2b3c4d5e6f",
+	}
+	firmware := &artifactory.ArtifactModel{Slug: "firmware", Filename: "3ca63cbb-1a2b3c4d5e6f.uf2"}
+	elf := &artifactory.ArtifactModel{Slug: "elf", Filename: "3ca63cbb-1a2b3c4d5e6f-elf.elf"}
+	legacy := &artifactory.ArtifactModel{Slug: "firmware", Filename: "3ca63cbb-1a2b3c4d5e6f"}
+
+	assert.Equal(t, "edgetx-v2.10.5-tx16s-1a2b3c4d.uf2",
+		artifactory.ArtifactFileName("", build, firmware))
+	assert.Equal(t, "edgetx-v2.10.5-tx16s-1a2b3c4d-elf.elf",
+		artifactory.ArtifactFileName("", build, elf))
+	assert.Equal(t, "edgetx-v2.10.5-tx16s-1a2b3c4d",
+		artifactory.ArtifactFileName("", build, legacy))
+
+	template := "{target}-{release}-{commit}.{ext}"
+	assert.Equal(t, "tx16s-v2.10.5-3ca63cb.uf2",
+		artifactory.ArtifactFileName(template, build, firmware))
+	assert.Equal(t, "elf_tx16s.elf",
+		artifactory.ArtifactFileName("{slug}_{target}.{ext}", build, elf))
+
+	build.CommitRef = "feature/branch"
+	assert.Equal(t, "tx16s-feature_branch.uf2",
+		artifactory.ArtifactFileName("{target}-{release}.{ext}", build, firmware))
+}
@@ -11,6 +11,8 @@ type JobQuery struct {
 	Target  string `form:"target"`
 	Sha     string `form:"sha"`
 	NotSha  string `form:"not-sha"`
+	// ErrorType lists BuildErrorType values, comma separated.
+	ErrorType string `form:"error-type"`
 }
 
 func (q *JobQuery) Validate() error {
@@ -26,13 +28,13 @@ func (q *JobQuery) Validate() error {
 	}
 }
 
-func (q *JobQuery) GetSort() interface{} {
+func (q *JobQuery) GetSort(dialect database.Dialect) interface{} {
 	if q.Sort == "duration" {
-		sort := "(build_ended_at - build_started_at)"
+		sort := dialect.Duration("build_started_at", "build_ended_at")
 		if q.SortDesc {
 			sort += " desc"
 		}
 		return sort
 	}
-	return q.Pagination.GetSort()
+	return q.Pagination.GetSort(dialect)
 }
@@ -0,0 +1,54 @@
+package artifactory
+
+import (
+	"github.com/edgetx/cloudbuild/buildlogs"
+	uuid "github.com/satori/go.uuid"
+)
+
+type logChunkSink struct {
+	repository BuildJobsRepository
+	jobID      uuid.UUID
+}
+
+func (sink *logChunkSink) Append(data string) error {
+	return sink.repository.AppendLogChunk(sink.jobID, data)
+}
+
+// NewLogSink returns a sink publishing build output for the API to read
+// while the job is building.
+func (artifactory *Artifactory) NewLogSink(jobID uuid.UUID) buildlogs.Sink {
+	return &logChunkSink{
+		repository: artifactory.BuildJobsRepository,
+		jobID:      jobID,
+	}
+}
+
+func (artifactory *Artifactory) GetLiveLogs(jobID string, afterSeq int64) (*LiveLogsDto, error) {
+	uid, err := uuid.FromString(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := artifactory.BuildJobsRepository.FindByID(uid)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrBuildNotFound
+	}
+
+	chunks, err := artifactory.BuildJobsRepository.GetLogChunks(uid, afterSeq)
+	if err != nil {
+		return nil, err
+	}
+
+	liveLogs := LiveLogsDto{
+		Status: job.Status,
+		Chunks: make([]LogChunkDto, 0, len(*chunks)),
+	}
+	for i := range *chunks {
+		liveLogs.Chunks = append(liveLogs.Chunks, LogChunkDtoFromModel(&(*chunks)[i]))
+	}
+
+	return &liveLogs, nil
+}
@@ -0,0 +1,106 @@
+package artifactory
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	ManifestArtifact          = "manifest"
+	ManifestSignatureArtifact = "manifest-sig"
+)
+
+var (
+	ErrInvalidSigningKey = errors.New("invalid manifest signing key")
+)
+
+// Manifest lists the artifacts of a build job with their checksums.
+type Manifest struct {
+	JobID          string          `json:"job_id"`
+	Release        string          `json:"release"`
+	CommitHash     string          `json:"commit_hash"`
+	Target         string          `json:"target"`
+	Flags          json.RawMessage `json:"flags"`
+	BuildFlagsHash string          `json:"build_flags_hash"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Artifacts      []ManifestEntry `json:"artifacts"`
+}
+
+type ManifestEntry struct {
+	Slug     string `json:"slug"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+	BLAKE3   string `json:"blake3,omitempty"`
+}
+
+func NewManifest(build *BuildJobModel, artifacts []ArtifactModel) *Manifest {
+	manifest := &Manifest{
+		JobID:          build.ID.String(),
+		Release:        build.CommitRef,
+		CommitHash:     build.CommitHash,
+		Target:         build.Target,
+		Flags:          json.RawMessage(build.Flags),
+		BuildFlagsHash: build.BuildFlagsHash,
+		CreatedAt:      time.Now().UTC(),
+		Artifacts:      make([]ManifestEntry, 0, len(artifacts)),
+	}
+	if len(manifest.Flags) == 0 {
+		manifest.Flags = json.RawMessage("[]")
+	}
+	for i := range artifacts {
+		art := &artifacts[i]
+		manifest.Artifacts = append(manifest.Artifacts, ManifestEntry{
+			Slug:     art.Slug,
+			Filename: art.Filename,
+			Size:     art.Size,
+			SHA256:   art.SHA256,
+			BLAKE3:   art.BLAKE3,
+		})
+	}
+	return manifest
+}
+
+// SignManifest returns the base64 encoded Ed25519 signature of data.
+func SignManifest(key ed25519.PrivateKey, data []byte) []byte {
+	signature := ed25519.Sign(key, data)
+	return []byte(base64.StdEncoding.EncodeToString(signature))
+}
+
+// VerifyManifest checks a signature produced by SignManifest.
+func VerifyManifest(key ed25519.PublicKey, data, signature []byte) bool {
+	raw, err := base64.StdEncoding.DecodeString(string(signature))
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(key, data, raw)
+}
+
+// LoadSigningKey reads a PEM encoded PKCS #8 Ed25519 private key,
+// as generated by "openssl genpkey -algorithm ed25519".
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM data", ErrInvalidSigningKey)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSigningKey, err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an Ed25519 key", ErrInvalidSigningKey)
+	}
+	return edKey, nil
+}
@@ -0,0 +1,40 @@
+package artifactory_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/edgetx/cloudbuild/artifactory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestSignature(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.Nil(t, err)
+	keyPath := filepath.Join(t.TempDir(), "manifest.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	assert.Nil(t, os.WriteFile(keyPath, keyPEM, 0o600))
+
+	signingKey, err := artifactory.LoadSigningKey(keyPath)
+	assert.Nil(t, err)
+
+	manifest := []byte(`{"artifacts":[]}`)
+	signature := artifactory.SignManifest(signingKey, manifest)
+	assert.True(t, artifactory.VerifyManifest(publicKey, manifest, signature))
+	assert.False(t, artifactory.VerifyManifest(publicKey, []byte(`{}`), signature))
+}
+
+func TestLoadSigningKeyRejectsGarbage(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "manifest.pem")
+	assert.Nil(t, os.WriteFile(keyPath, []byte("not a key"), 0o600))
+	_, err := artifactory.LoadSigningKey(keyPath)
+	assert.ErrorIs(t, err, artifactory.ErrInvalidSigningKey)
+}
@@ -2,7 +2,7 @@ package artifactory
 
 import (
 	"encoding/json"
-	"net/url"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -13,7 +13,10 @@ var (
 	ErrTypeError = errors.New("wrong type returned")
 )
 
-func BuildJobDtoFromModel(model *BuildJobModel, prefixURL *url.URL) (*BuildJobDto, error) {
+// DownloadURLFunc returns the download URL of a stored artifact.
+type DownloadURLFunc func(build *BuildJobModel, art *ArtifactModel) string
+
+func BuildJobDtoFromModel(model *BuildJobModel, downloadURL DownloadURLFunc) (*BuildJobDto, error) {
 	var optFlags []OptionFlag
 	if model.Flags != nil {
 		if err := json.Unmarshal([]byte(model.Flags.String()), &optFlags); err != nil {
@@ -27,16 +30,25 @@ func BuildJobDtoFromModel(model *BuildJobModel, prefixURL *url.URL) (*BuildJobDt
 			return nil, err
 		}
 	}
+	var requirements *JobRequirements
+	if model.Requirements != nil {
+		if err := json.Unmarshal(model.Requirements, &requirements); err != nil {
+			return nil, err
+		}
+	}
 	artifacts := make([]ArtifactDto, 0)
 	for i := range model.Artifacts {
 		art := &model.Artifacts[i]
-		downloadURL := prefixURL.JoinPath(art.Filename).String()
-		artifacts = append(artifacts, ArtifactDtoFromModel(art, downloadURL))
+		artifacts = append(artifacts, ArtifactDtoFromModel(art, downloadURL(model, art)))
 	}
 	auditLogs := make([]AuditLogDto, 0)
 	for i := range model.AuditLogs {
 		auditLogs = append(auditLogs, AuditLogDtoFromModel(&model.AuditLogs[i]))
 	}
+	var nextAttemptAt *time.Time
+	if model.Status == WaitingForBuild && model.NextAttemptAt.After(time.Now()) {
+		nextAttemptAt = &model.NextAttemptAt
+	}
 	return &BuildJobDto{
 		ID:             model.ID.String(),
 		Status:         model.Status,
@@ -50,6 +62,13 @@ func BuildJobDtoFromModel(model *BuildJobModel, prefixURL *url.URL) (*BuildJobDt
 		AuditLogs:      auditLogs,
 		ContainerImage: model.ContainerImage,
 		BuildFlagsHash: model.BuildFlagsHash,
+		Priority:       model.Priority,
+		Requirements:   requirements,
+		WorkerID:       model.WorkerID,
+		WorkerHostname: model.WorkerHostname,
+		ErrorType:      model.ErrorType,
+		ErrorExcerpt:   model.ErrorExcerpt,
+		NextAttemptAt:  nextAttemptAt,
 		BuildStartedAt: model.BuildStartedAt,
 		BuildEndedAt:   model.BuildEndedAt,
 		CreatedAt:      model.CreatedAt,
@@ -57,7 +76,9 @@ func BuildJobDtoFromModel(model *BuildJobModel, prefixURL *url.URL) (*BuildJobDt
 	}, nil
 }
 
-func BuildJobsDtoFromInterface(input interface{}, prefixURL *url.URL) (*[]BuildJobDto, error) {
+func BuildJobsDtoFromInterface(
+	input interface{}, downloadURL DownloadURLFunc,
+) (*[]BuildJobDto, error) {
 	jobs, ok := input.(*[]BuildJobModel)
 	if !ok {
 		return nil, ErrTypeError
@@ -65,7 +86,7 @@ func BuildJobsDtoFromInterface(input interface{}, prefixURL *url.URL) (*[]BuildJ
 
 	resJobs := make([]BuildJobDto, len(*jobs))
 	for i := range *jobs {
-		j, err := BuildJobDtoFromModel(&(*jobs)[i], prefixURL)
+		j, err := BuildJobDtoFromModel(&(*jobs)[i], downloadURL)
 		if err != nil {
 			return nil, err
 		}
@@ -80,6 +101,8 @@ func ArtifactDtoFromModel(model *ArtifactModel, downloadURL string) ArtifactDto
 		Slug:        model.Slug,
 		DownloadURL: downloadURL,
 		Size:        model.Size,
+		SHA256:      model.SHA256,
+		BLAKE3:      model.BLAKE3,
 		CreatedAt:   model.CreatedAt,
 		UpdatedAt:   model.UpdatedAt,
 	}
@@ -87,11 +110,60 @@ func ArtifactDtoFromModel(model *ArtifactModel, downloadURL string) ArtifactDto
 
 func AuditLogDtoFromModel(model *AuditLogModel) AuditLogDto {
 	return AuditLogDto{
+		ID:             model.ID.String(),
+		From:           model.From,
+		To:             model.To,
+		WorkerID:       model.WorkerID,
+		WorkerHostname: model.WorkerHostname,
+		Reason:         model.Reason,
+		StdOut:         model.StdOut,
+		CreatedAt:      model.CreatedAt,
+		UpdatedAt:      model.UpdatedAt,
+	}
+}
+
+func LogChunkDtoFromModel(model *LogChunkModel) LogChunkDto {
+	return LogChunkDto{
+		Seq:       model.Seq,
+		Data:      model.Data,
+		CreatedAt: model.CreatedAt,
+	}
+}
+
+func WebhookSubscriptionDtoFromModel(model *WebhookSubscriptionModel) WebhookSubscriptionDto {
+	statuses := []BuildStatus{}
+	if model.Statuses != nil {
+		// statuses are validated on creation
+		_ = json.Unmarshal(model.Statuses, &statuses)
+	}
+	return WebhookSubscriptionDto{
 		ID:        model.ID.String(),
-		From:      model.From,
-		To:        model.To,
-		StdOut:    model.StdOut,
+		URL:       model.URL,
+		Statuses:  statuses,
 		CreatedAt: model.CreatedAt,
 		UpdatedAt: model.UpdatedAt,
 	}
 }
+
+func WebhookDeliveryDtoFromModel(model *WebhookDeliveryModel) WebhookDeliveryDto {
+	attempts := make([]WebhookAttemptDto, len(model.AttemptLogs))
+	for i, attempt := range model.AttemptLogs {
+		attempts[i] = WebhookAttemptDto{
+			StatusCode: attempt.StatusCode,
+			Error:      attempt.Error,
+			DurationMs: attempt.Duration.Milliseconds(),
+			CreatedAt:  attempt.CreatedAt,
+		}
+	}
+	return WebhookDeliveryDto{
+		ID:             model.ID.String(),
+		SubscriptionID: model.SubscriptionID,
+		BuildJobID:     model.BuildJobID,
+		URL:            model.URL,
+		Status:         model.Status,
+		Attempts:       attempts,
+		NextAttemptAt:  model.NextAttemptAt,
+		DeliveredAt:    model.DeliveredAt,
+		CreatedAt:      model.CreatedAt,
+	}
+}
@@ -0,0 +1,125 @@
+package artifactory
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Build phases, see metricBuildPhaseDuration.
+const (
+	PhaseSourceFetch = "source_fetch"
+	PhaseContainer   = "container"
+	PhaseUpload      = "upload"
+)
+
+// Error classes of the build outcomes.
+const (
+	ErrorClassNone          = "none"
+	ErrorClassCancelled     = "cancelled"
+	ErrorClassTimeout       = "timeout"
+	ErrorClassSource        = "source"
+	ErrorClassBuild         = "build"
+	ErrorClassUpload        = "upload"
+	ErrorClassInternal      = "internal"
+	ErrorClassLeaseLost     = "lease_lost"
+	ErrorClassWorkerStopped = "worker_stopped"
+)
+
+var (
+	metricBuildDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "build_duration_seconds",
+			Help:    "Duration of the builds, from start to end.",
+			Buckets: []float64{30, 60, 120, 180, 300, 450, 600, 900},
+		},
+		[]string{"target", "release"},
+	)
+	metricBuildQueueDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "build_queue_duration_seconds",
+			Help:    "Time spent by the jobs waiting for a worker.",
+			Buckets: []float64{1, 5, 15, 30, 60, 180, 600, 1800, 3600},
+		},
+		[]string{"target", "release"},
+	)
+	metricBuildPhaseDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "build_phase_duration_seconds",
+			Help:    "Duration of the build phases (source_fetch, container, upload).",
+			Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600},
+		},
+		[]string{"phase"},
+	)
+	metricBuildOutcome = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "build_outcome_total",
+			Help: "Number of finished builds by outcome and error class.",
+		},
+		[]string{"target", "release", "outcome", "error_class"},
+	)
+)
+
+// RegisterBuildMetrics registers the metrics of the builds run by this process.
+func RegisterBuildMetrics(r prometheus.Registerer) {
+	r.MustRegister(
+		metricBuildDuration,
+		metricBuildQueueDuration,
+		metricBuildPhaseDuration,
+		metricBuildOutcome,
+	)
+}
+
+// observePhase records the duration of a build phase started at start.
+func observePhase(phase string, start time.Time) {
+	metricBuildPhaseDuration.WithLabelValues(phase).Observe(time.Since(start).Seconds())
+}
+
+// observeBuildStart records the time the job waited since it was last queued:
+// its creation, or its last retry or requeue.
+func observeBuildStart(build *BuildJobModel) {
+	queuedAt := build.CreatedAt
+	if build.NextAttemptAt.After(queuedAt) {
+		queuedAt = build.NextAttemptAt
+	}
+	metricBuildQueueDuration.WithLabelValues(build.Target, build.CommitRef).Observe(
+		build.BuildStartedAt.Sub(queuedAt).Seconds(),
+	)
+}
+
+// errorClass refines the class of a failure in a build phase
+// with the cause of the build context.
+func errorClass(ctx context.Context, class string) string {
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, ErrBuildCancelled):
+		return ErrorClassCancelled
+	case errors.Is(cause, ErrLeaseLost):
+		return ErrorClassLeaseLost
+	case errors.Is(cause, ErrWorkerStopping):
+		return ErrorClassWorkerStopped
+	case errors.Is(cause, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	}
+	return class
+}
+
+// observeBuildEnd records the outcome of a build. Builds interrupted by
+// a cancellation, a lost lease or a stopping worker are not failures and
+// get their own outcome.
+func observeBuildEnd(build *BuildJobModel, class string) {
+	var outcome string
+	switch class {
+	case ErrorClassNone:
+		outcome = "success"
+	case ErrorClassCancelled, ErrorClassLeaseLost, ErrorClassWorkerStopped:
+		outcome = class
+	default:
+		outcome = "failure"
+	}
+	metricBuildOutcome.WithLabelValues(build.Target, build.CommitRef, outcome, class).Inc()
+	metricBuildDuration.WithLabelValues(build.Target, build.CommitRef).Observe(
+		time.Since(build.BuildStartedAt).Seconds(),
+	)
+}
@@ -0,0 +1,81 @@
+package artifactory
+
+import (
+	"github.com/edgetx/cloudbuild/database"
+	"gorm.io/gorm"
+)
+
+// the baseline migration creates the latest tables: the migrations below
+// only change what is missing.
+var buildErrorTypeMigration = database.Migration{
+	Version: 2,
+	Name:    "add build job error type and excerpt",
+	Up: func(tx *gorm.DB) error {
+		migrator := tx.Migrator()
+		for _, field := range []string{"ErrorType", "ErrorExcerpt"} {
+			if migrator.HasColumn(&BuildJobModel{}, field) {
+				continue
+			}
+			if err := migrator.AddColumn(&BuildJobModel{}, field); err != nil {
+				return err
+			}
+		}
+		if migrator.HasIndex(&BuildJobModel{}, "build_error_type_idx") {
+			return nil
+		}
+		return migrator.CreateIndex(&BuildJobModel{}, "build_error_type_idx")
+	},
+	Down: func(tx *gorm.DB) error {
+		migrator := tx.Migrator()
+		if err := migrator.DropIndex(&BuildJobModel{}, "build_error_type_idx"); err != nil {
+			return err
+		}
+		// unlike DropColumn on SQLite, this keeps the other indexes
+		for _, column := range []string{"error_type", "error_excerpt"} {
+			if err := tx.Exec("ALTER TABLE build_jobs DROP COLUMN " + column).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var retryPolicyMigration = database.Migration{
+	Version: 3,
+	Name:    "add build job next attempt and audit log reason",
+	Up: func(tx *gorm.DB) error {
+		migrator := tx.Migrator()
+		if !migrator.HasColumn(&BuildJobModel{}, "NextAttemptAt") {
+			if err := migrator.AddColumn(&BuildJobModel{}, "NextAttemptAt"); err != nil {
+				return err
+			}
+		}
+		// NULL would never be due: the queued jobs are due right away. The column
+		// may also have been added by the baseline of an unversioned database.
+		err := tx.Exec(
+			"UPDATE build_jobs SET next_attempt_at = COALESCE(build_ended_at, created_at) " +
+				"WHERE next_attempt_at IS NULL",
+		).Error
+		if err != nil {
+			return err
+		}
+		if migrator.HasColumn(&AuditLogModel{}, "Reason") {
+			return nil
+		}
+		return migrator.AddColumn(&AuditLogModel{}, "Reason")
+	},
+	Down: func(tx *gorm.DB) error {
+		err := tx.Exec("ALTER TABLE build_jobs DROP COLUMN next_attempt_at").Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec("ALTER TABLE audit_logs DROP COLUMN reason").Error
+	},
+}
+
+func init() {
+	database.RegisterMigrations(
+		buildErrorTypeMigration,
+		retryPolicyMigration,
+	)
+}
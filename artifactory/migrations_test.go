@@ -0,0 +1,60 @@
+package artifactory_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edgetx/cloudbuild/artifactory"
+	"github.com/edgetx/cloudbuild/database"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+)
+
+// unversionedBuildJob is the job model as it was before the schema was versioned.
+type unversionedBuildJob struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;"`
+	Status         artifactory.BuildStatus
+	BuildAttempts  int64
+	CommitHash     string
+	CommitRef      string
+	Target         string
+	Flags          datatypes.JSON
+	BuildFlags     datatypes.JSON
+	ContainerImage string
+	BuildFlagsHash string
+	BuildStartedAt time.Time
+	BuildEndedAt   time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (unversionedBuildJob) TableName() string {
+	return "build_jobs"
+}
+
+func TestMigrateUnversionedDatabaseWithQueuedJob(t *testing.T) {
+	dsn := database.SQLitePrefix + filepath.Join(t.TempDir(), "unversioned.db")
+	db, err := database.New(dsn)
+	assert.Nil(t, err)
+	assert.Nil(t, db.AutoMigrate(&unversionedBuildJob{}))
+	queued := unversionedBuildJob{
+		ID:        uuid.NewV4(),
+		Status:    artifactory.WaitingForBuild,
+		CommitRef: "v2.10.0",
+		Target:    "tx16s",
+		CreatedAt: time.Now().Add(-time.Hour),
+	}
+	assert.Nil(t, db.Create(&queued).Error)
+
+	assert.Nil(t, database.Migrate(dsn))
+
+	// the queued job is still built after the upgrade
+	repository := artifactory.NewBuildJobsDBRepository(db)
+	job, err := repository.ReservePendingBuild(nil)
+	assert.Nil(t, err)
+	if assert.NotNil(t, job) {
+		assert.Equal(t, queued.ID, job.ID)
+	}
+}
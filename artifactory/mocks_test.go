@@ -2,8 +2,10 @@ package artifactory_test
 
 import (
 	"context"
+	"io"
 
 	"github.com/edgetx/cloudbuild/firmware"
+	"github.com/edgetx/cloudbuild/storage"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -31,12 +33,13 @@ func (downloader *MockFirmwareBuilder) Build(
 	target string,
 	versionTag string,
 	flags []firmware.BuildFlag,
-) ([]byte, error) {
+	rules []firmware.ArtifactRule,
+) ([]firmware.Artifact, error) {
 	args := downloader.Called(ctx, buildContainer, flags)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	out, ok := args.Get(0).([]byte)
+	out, ok := args.Get(0).([]firmware.Artifact)
 	if !ok {
 		return nil, args.Error(1)
 	}
@@ -47,7 +50,44 @@ type MockStorage struct {
 	mock.Mock
 }
 
-func (storage *MockStorage) Upload(ctx context.Context, data []byte, fileName string) error {
-	args := storage.Called(ctx, data, fileName)
+func (mockStorage *MockStorage) Upload(
+	ctx context.Context, data io.Reader, size int64, contentType string, fileName string,
+) error {
+	// consume data like a real storage would
+	if _, err := io.Copy(io.Discard, data); err != nil {
+		return err
+	}
+	args := mockStorage.Called(ctx, data, size, contentType, fileName)
 	return args.Error(0)
 }
+
+func (mockStorage *MockStorage) Delete(ctx context.Context, fileName string) error {
+	args := mockStorage.Called(ctx, fileName)
+	return args.Error(0)
+}
+
+func (mockStorage *MockStorage) List(ctx context.Context) ([]storage.ObjectInfo, error) {
+	args := mockStorage.Called(ctx)
+	objects, ok := args.Get(0).([]storage.ObjectInfo)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return objects, args.Error(1)
+}
+
+func (mockStorage *MockStorage) Open(ctx context.Context, fileName string) (*storage.Object, error) {
+	args := mockStorage.Called(ctx, fileName)
+	object, ok := args.Get(0).(*storage.Object)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return object, args.Error(1)
+}
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error {
+	return nil
+}
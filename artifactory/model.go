@@ -17,13 +17,40 @@ const (
 	BuildInProgress BuildStatus = "BUILD_IN_PROGRESS"
 	BuildSuccess    BuildStatus = "BUILD_SUCCESS"
 	BuildError      BuildStatus = "BUILD_ERROR"
+	BuildCancelled  BuildStatus = "CANCELLED"
 )
 
+// IsPending returns true while the job is queued or building.
+func (status BuildStatus) IsPending() bool {
+	return status == WaitingForBuild || status == BuildInProgress
+}
+
+// BuildErrorType classifies the failure of a build.
 type BuildErrorType string
 
+const (
+	NoBuildError         BuildErrorType = ""
+	GitFetchError        BuildErrorType = "GIT_FETCH"
+	SubmoduleError       BuildErrorType = "SUBMODULE"
+	ImagePullError       BuildErrorType = "IMAGE_PULL"
+	CMakeConfigureError  BuildErrorType = "CMAKE_CONFIGURE"
+	CompilerError        BuildErrorType = "COMPILER"
+	LinkerError          BuildErrorType = "LINKER"
+	TimeoutError         BuildErrorType = "TIMEOUT"
+	ArtifactMissingError BuildErrorType = "ARTIFACT_MISSING"
+	StorageUploadError   BuildErrorType = "STORAGE_UPLOAD"
+	UnknownError         BuildErrorType = "UNKNOWN"
+)
+
 const (
 	MaxBuildAttempts = 3
 	MaxBuildDuration = time.Minute * 15
+	// FairShareWindow is how far back the builds of a requester are
+	// counted to share the workers between requesters.
+	FairShareWindow = time.Hour
+	// reserveCandidates is how many queued jobs a worker looks at
+	// at once to find one it can build.
+	reserveCandidates = 50
 )
 
 type BuildJobModel struct {
@@ -35,10 +62,22 @@ type BuildJobModel struct {
 	Target         string `gorm:"index:target_idx"`
 	Flags          datatypes.JSON
 	BuildFlags     datatypes.JSON
+	ArtifactRules  datatypes.JSON
 	ContainerImage string
-	BuildFlagsHash string          `gorm:"index:build_flags_hash_idx"`
+	BuildFlagsHash string `gorm:"index:build_flags_hash_idx"`
+	Priority       int    `gorm:"index:priority_idx;not null;default:0"`
+	Requester      string `gorm:"index:requester_idx"`
+	CallbackURL    string
+	Requirements   datatypes.JSON
+	WorkerID       string `gorm:"index:worker_id_idx"`
+	WorkerHostname string
+	ErrorType      BuildErrorType `gorm:"index:build_error_type_idx"`
+	ErrorExcerpt   string
+	// NextAttemptAt delays the build of a job waiting to be retried.
+	NextAttemptAt  time.Time
 	Artifacts      []ArtifactModel `gorm:"foreignKey:BuildJobID;constraint:OnDelete:CASCADE"`
 	AuditLogs      []AuditLogModel `gorm:"foreignKey:BuildJobID;constraint:OnDelete:CASCADE"`
+	LogChunks      []LogChunkModel `gorm:"foreignKey:BuildJobID;constraint:OnDelete:CASCADE"`
 	BuildStartedAt time.Time
 	BuildEndedAt   time.Time
 	CreatedAt      time.Time
@@ -61,6 +100,8 @@ type ArtifactModel struct {
 	BuildJob   BuildJobModel `gorm:"foreignKey:BuildJobID"`
 	Filename   string
 	Size       int64
+	SHA256     string `gorm:"column:sha256"`
+	BLAKE3     string `gorm:"column:blake3"`
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
 }
@@ -79,11 +120,16 @@ type AuditLogModel struct {
 	BuildJobID string
 	BuildJob   BuildJobModel `gorm:"foreignKey:BuildJobID"`
 	RequestIP  string
-	From       BuildStatus
-	To         BuildStatus
-	StdOut     string
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
+	// WorkerID and WorkerHostname identify the worker of a build transition.
+	WorkerID       string
+	WorkerHostname string
+	From           BuildStatus
+	To             BuildStatus
+	// Reason explains the transitions not requested by a user or a build result.
+	Reason    string
+	StdOut    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 func (AuditLogModel) TableName() string {
@@ -95,10 +141,100 @@ func (base *AuditLogModel) BeforeCreate(db *gorm.DB) error {
 	return nil
 }
 
+// LogChunkModel holds build output published while the build is running.
+type LogChunkModel struct {
+	Seq        int64         `gorm:"primaryKey;autoIncrement"`
+	BuildJobID string        `gorm:"index:log_chunk_build_job_idx"`
+	BuildJob   BuildJobModel `gorm:"foreignKey:BuildJobID"`
+	Data       string
+	CreatedAt  time.Time
+}
+
+func (LogChunkModel) TableName() string {
+	return "log_chunks"
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookPending   WebhookDeliveryStatus = "PENDING"
+	WebhookDelivered WebhookDeliveryStatus = "DELIVERED"
+	WebhookFailed    WebhookDeliveryStatus = "FAILED"
+)
+
+// WebhookSubscriptionModel receives the status changes of all jobs,
+// optionally restricted to some statuses.
+type WebhookSubscriptionModel struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	URL       string
+	Secret    string
+	Statuses  datatypes.JSON
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (WebhookSubscriptionModel) TableName() string {
+	return "webhook_subscriptions"
+}
+
+func (base *WebhookSubscriptionModel) BeforeCreate(db *gorm.DB) error {
+	base.ID = uuid.NewV4()
+	return nil
+}
+
+// WebhookDeliveryModel is an outbox entry: a payload to be delivered to URL.
+// SubscriptionID is empty for the callback of a job.
+type WebhookDeliveryModel struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;"`
+	SubscriptionID string    `gorm:"index:webhook_delivery_subscription_idx"`
+	BuildJobID     string    `gorm:"index:webhook_delivery_build_job_idx"`
+	URL            string
+	Payload        datatypes.JSON
+	Status         WebhookDeliveryStatus `gorm:"index:webhook_delivery_status_idx"`
+	Attempts       int
+	NextAttemptAt  time.Time `gorm:"index:webhook_delivery_next_attempt_idx"`
+	DeliveredAt    time.Time
+	AttemptLogs    []WebhookAttemptModel `gorm:"foreignKey:DeliveryID;constraint:OnDelete:CASCADE"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (WebhookDeliveryModel) TableName() string {
+	return "webhook_deliveries"
+}
+
+func (base *WebhookDeliveryModel) BeforeCreate(db *gorm.DB) error {
+	base.ID = uuid.NewV4()
+	return nil
+}
+
+// WebhookAttemptModel records the outcome of one delivery attempt.
+type WebhookAttemptModel struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;"`
+	DeliveryID string    `gorm:"index:webhook_attempt_delivery_idx"`
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+	CreatedAt  time.Time
+}
+
+func (WebhookAttemptModel) TableName() string {
+	return "webhook_attempts"
+}
+
+func (base *WebhookAttemptModel) BeforeCreate(db *gorm.DB) error {
+	base.ID = uuid.NewV4()
+	return nil
+}
+
 func init() {
 	database.RegisterModels(
 		&BuildJobModel{},
 		&ArtifactModel{},
 		&AuditLogModel{},
+		&LogChunkModel{},
+		&WebhookSubscriptionModel{},
+		&WebhookDeliveryModel{},
+		&WebhookAttemptModel{},
 	)
 }
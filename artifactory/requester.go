@@ -0,0 +1,22 @@
+package artifactory
+
+// Requester identifies the client asking for a build.
+type Requester struct {
+	IP string
+	// AccessKey is set for authenticated requests.
+	AccessKey string
+}
+
+// Key groups the jobs of a client for fair-share scheduling:
+// authenticated clients are identified by their token, others by IP.
+func (requester Requester) Key() string {
+	if requester.AccessKey != "" {
+		return "token:" + requester.AccessKey
+	}
+	return "ip:" + requester.IP
+}
+
+// Authenticated returns true if the request carried a valid token.
+func (requester Requester) Authenticated() bool {
+	return requester.AccessKey != ""
+}
@@ -0,0 +1,155 @@
+package artifactory
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/edgetx/cloudbuild/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	NightlyRef         = "nightly"
+	RetentionInterval  = time.Hour
+	retentionBatchSize = 100
+	// stored objects younger than this may belong to a build
+	// which has not been saved yet.
+	orphanGracePeriod = 2 * MaxBuildDuration
+)
+
+// artifactObjectPattern matches the names given by artifactFileName:
+// the other stored objects are never considered orphans.
+var artifactObjectPattern = regexp.MustCompile(`^[0-9a-f]{40}-[0-9a-f]{64}([-.]|$)`)
+
+// RetentionPolicy defines how long finished jobs and their artifacts
+// are kept. A zero duration keeps them forever.
+type RetentionPolicy struct {
+	Nightly       time.Duration
+	Release       time.Duration
+	RemoveOrphans bool
+}
+
+func RetentionPolicyFromConfig(c *config.CloudbuildOpts) RetentionPolicy {
+	day := 24 * time.Hour
+	return RetentionPolicy{
+		Nightly:       time.Duration(c.RetentionNightlyDays) * day,
+		Release:       time.Duration(c.RetentionReleaseDays) * day,
+		RemoveOrphans: c.RetentionRemoveOrphans,
+	}
+}
+
+func (policy RetentionPolicy) Enabled() bool {
+	return policy.Nightly > 0 || policy.Release > 0 || policy.RemoveOrphans
+}
+
+// removeJob deletes the stored artifacts of the job, then the job itself.
+func (artifactory *Artifactory) removeJob(ctx context.Context, job *BuildJobModel) error {
+	for i := range job.Artifacts {
+		fileName := job.Artifacts[i].Filename
+		if err := artifactory.ArtifactStorage.Delete(ctx, fileName); err != nil {
+			return fmt.Errorf("failed to delete artifact %s: %w", fileName, err)
+		}
+	}
+	return artifactory.BuildJobsRepository.Delete(job.ID)
+}
+
+func (artifactory *Artifactory) collectExpiredJobs(
+	ctx context.Context, nightly bool, retention time.Duration,
+) (int, error) {
+	if retention <= 0 {
+		return 0, nil
+	}
+	removed := 0
+	createdBefore := time.Now().Add(-retention)
+	for {
+		jobs, err := artifactory.BuildJobsRepository.ListExpiredJobs(
+			nightly, createdBefore, retentionBatchSize,
+		)
+		if err != nil {
+			return removed, err
+		}
+		for i := range *jobs {
+			if err := artifactory.removeJob(ctx, &(*jobs)[i]); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+		if len(*jobs) < retentionBatchSize {
+			return removed, nil
+		}
+	}
+}
+
+// CollectExpiredJobs removes the jobs older than the policy allows.
+func (artifactory *Artifactory) CollectExpiredJobs(
+	ctx context.Context, policy RetentionPolicy,
+) (int, error) {
+	nightlies, err := artifactory.collectExpiredJobs(ctx, true, policy.Nightly)
+	if err != nil {
+		return nightlies, err
+	}
+	releases, err := artifactory.collectExpiredJobs(ctx, false, policy.Release)
+	return nightlies + releases, err
+}
+
+// CollectOrphans removes the stored artifact objects not referenced by any
+// artifact. The objects of unknown or recent age are kept, as their build
+// may still be uploading.
+func (artifactory *Artifactory) CollectOrphans(ctx context.Context) (int, error) {
+	objects, err := artifactory.ArtifactStorage.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	fileNames, err := artifactory.BuildJobsRepository.ListArtifactFilenames()
+	if err != nil {
+		return 0, err
+	}
+	known := make(map[string]struct{}, len(fileNames))
+	for _, fileName := range fileNames {
+		known[fileName] = struct{}{}
+	}
+
+	removed := 0
+	modifiedBefore := time.Now().Add(-orphanGracePeriod)
+	for _, object := range objects {
+		if !artifactObjectPattern.MatchString(object.Name) {
+			continue
+		}
+		if object.ModifiedAt.IsZero() || object.ModifiedAt.After(modifiedBefore) {
+			continue
+		}
+		if _, ok := known[object.Name]; ok {
+			continue
+		}
+		if err := artifactory.ArtifactStorage.Delete(ctx, object.Name); err != nil {
+			return removed, fmt.Errorf("failed to delete orphan %s: %w", object.Name, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (artifactory *Artifactory) RunRetentionCollector(policy RetentionPolicy) {
+	ctx := context.Background()
+	for {
+		removed, err := artifactory.CollectExpiredJobs(ctx, policy)
+		if err != nil {
+			log.Errorf("failed to remove expired jobs: %s", err)
+		}
+		if removed > 0 {
+			log.Infof("removed %d expired jobs", removed)
+		}
+		if policy.RemoveOrphans {
+			removed, err = artifactory.CollectOrphans(ctx)
+			if err != nil {
+				log.Errorf("failed to remove orphaned artifacts: %s", err)
+			}
+			if removed > 0 {
+				log.Infof("removed %d orphaned artifacts", removed)
+			}
+		}
+		time.Sleep(RetentionInterval)
+	}
+}
@@ -0,0 +1,73 @@
+package artifactory
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// transientErrors may not happen again: the jobs failing with them are
+// retried automatically.
+var transientErrors = map[BuildErrorType]bool{
+	GitFetchError:      true,
+	SubmoduleError:     true,
+	ImagePullError:     true,
+	StorageUploadError: true,
+}
+
+// deterministicErrors happen again with the same sources and flags:
+// the jobs failing with them are never built again.
+var deterministicErrors = map[BuildErrorType]bool{
+	CMakeConfigureError:  true,
+	CompilerError:        true,
+	LinkerError:          true,
+	ArtifactMissingError: true,
+}
+
+// RetryPolicy decides which failed jobs are built again, and when.
+type RetryPolicy struct {
+	MaxAttempts int64
+	// BaseDelay is the delay before the second attempt, doubled
+	// after each failed attempt up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: MaxBuildAttempts,
+	BaseDelay:   time.Minute,
+	MaxDelay:    30 * time.Minute,
+}
+
+// ShouldRetry returns true if the failed job is queued again automatically.
+func (policy RetryPolicy) ShouldRetry(job *BuildJobModel) bool {
+	return transientErrors[job.ErrorType] && job.BuildAttempts < policy.MaxAttempts
+}
+
+// CanRestart returns true if the failed job is queued again when requested again.
+func (policy RetryPolicy) CanRestart(job *BuildJobModel) bool {
+	return !deterministicErrors[job.ErrorType] && job.BuildAttempts < policy.MaxAttempts
+}
+
+// Backoff returns the delay before the next attempt of a job after attempts
+// failed ones. The delay is randomized between half and all of the
+// exponential backoff, so that jobs failing together are not retried together.
+func (policy RetryPolicy) Backoff(attempts int64) time.Duration {
+	delay := policy.BaseDelay
+	for i := int64(1); i < attempts && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, policy.MaxDelay)
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retryReason explains the automatic retry of a failed job in its audit log.
+func (policy RetryPolicy) retryReason(job *BuildJobModel, delay time.Duration) string {
+	return fmt.Sprintf(
+		"retrying in %s after %s failure (attempt %d of %d): %s",
+		delay.Round(time.Second), job.ErrorType, job.BuildAttempts, policy.MaxAttempts, job.ErrorExcerpt,
+	)
+}
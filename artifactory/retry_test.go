@@ -0,0 +1,55 @@
+package artifactory_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/edgetx/cloudbuild/artifactory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	policy := artifactory.RetryPolicy{
+		MaxAttempts: 10,
+		BaseDelay:   time.Minute,
+		MaxDelay:    10 * time.Minute,
+	}
+	for attempts, delay := range map[int64]time.Duration{
+		1: time.Minute,
+		2: 2 * time.Minute,
+		3: 4 * time.Minute,
+		4: 8 * time.Minute,
+		5: 10 * time.Minute,
+		9: 10 * time.Minute,
+	} {
+		for i := 0; i < 20; i++ {
+			backoff := policy.Backoff(attempts)
+			assert.GreaterOrEqual(t, backoff, delay/2)
+			assert.LessOrEqual(t, backoff, delay)
+		}
+	}
+}
+
+func TestRetryPolicyByErrorType(t *testing.T) {
+	policy := artifactory.DefaultRetryPolicy
+	job := &artifactory.BuildJobModel{BuildAttempts: 1}
+	for errorType, retried := range map[artifactory.BuildErrorType]bool{
+		artifactory.GitFetchError:       true,
+		artifactory.SubmoduleError:      true,
+		artifactory.ImagePullError:      true,
+		artifactory.StorageUploadError:  true,
+		artifactory.CompilerError:       false,
+		artifactory.LinkerError:         false,
+		artifactory.CMakeConfigureError: false,
+		artifactory.TimeoutError:        false,
+		artifactory.UnknownError:        false,
+	} {
+		job.ErrorType = errorType
+		assert.Equal(t, retried, policy.ShouldRetry(job), errorType)
+	}
+
+	job.ErrorType = artifactory.GitFetchError
+	job.BuildAttempts = policy.MaxAttempts
+	assert.False(t, policy.ShouldRetry(job))
+	assert.False(t, policy.CanRestart(job))
+}
@@ -0,0 +1,127 @@
+package artifactory
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	semver "github.com/Masterminds/semver/v3"
+	"github.com/edgetx/cloudbuild/targets"
+)
+
+// JobRequirements must be met by the worker building a job.
+type JobRequirements struct {
+	// Platforms supported by the build container, any if empty.
+	Platforms []string `json:"platforms,omitempty"`
+	// MinMemoryMB needed by the build.
+	MinMemoryMB uint32 `json:"min_memory_mb,omitempty"`
+}
+
+// BuildWorker is a worker reserving jobs.
+type BuildWorker struct {
+	ID           string
+	Hostname     string
+	Capabilities *WorkerCapabilities
+}
+
+func (worker *BuildWorker) capabilities() *WorkerCapabilities {
+	if worker == nil {
+		return nil
+	}
+	return worker.Capabilities
+}
+
+// WorkerCapabilities are advertised by a worker and select the jobs it builds.
+type WorkerCapabilities struct {
+	Arch  string `json:"arch"`
+	Slots int    `json:"slots"`
+	// MemoryMB available to each build, 0 means no limit.
+	MemoryMB uint32 `json:"memory_mb"`
+	// Releases is a semver constraint on the releases built, any if empty.
+	Releases string `json:"releases,omitempty"`
+	// Images cached locally, preferred when picking a job.
+	Images []string          `json:"images,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+
+	releases *semver.Constraints
+}
+
+// ParseReleases validates the release constraint.
+func (caps *WorkerCapabilities) ParseReleases() error {
+	if caps.Releases == "" {
+		caps.releases = nil
+		return nil
+	}
+	constraints, err := semver.NewConstraint(caps.Releases)
+	if err != nil {
+		return fmt.Errorf("invalid release constraint %q: %w", caps.Releases, err)
+	}
+	caps.releases = constraints
+	return nil
+}
+
+func (caps *WorkerCapabilities) allowsRelease(ref string) bool {
+	if caps.releases == nil {
+		return true
+	}
+	version := targets.NightlyVersion
+	if ref != "nightly" {
+		v, err := semver.NewVersion(ref)
+		if err != nil {
+			return false
+		}
+		version = v
+	}
+	return caps.releases.Check(version)
+}
+
+// CanBuild returns true if the worker meets the requirements of the job,
+// nil capabilities meeting any requirement.
+func (caps *WorkerCapabilities) CanBuild(job *BuildJobModel) bool {
+	if caps == nil {
+		return true
+	}
+	if !caps.allowsRelease(job.CommitRef) {
+		return false
+	}
+	var requirements JobRequirements
+	if job.Requirements != nil {
+		if err := json.Unmarshal(job.Requirements, &requirements); err != nil {
+			return false
+		}
+	}
+	if len(requirements.Platforms) > 0 && !slices.Contains(requirements.Platforms, caps.Arch) {
+		return false
+	}
+	if caps.MemoryMB > 0 && requirements.MinMemoryMB > caps.MemoryMB {
+		return false
+	}
+	return true
+}
+
+func (caps *WorkerCapabilities) hasImage(image string) bool {
+	return caps != nil && slices.Contains(caps.Images, image)
+}
+
+// pickOrder returns the queued jobs the worker can build in the order they
+// should be tried. Among the jobs of the highest priority, those with
+// a cached container image come first.
+func (caps *WorkerCapabilities) pickOrder(queued []BuildJobModel) []*BuildJobModel {
+	var first *BuildJobModel
+	var cached, others []*BuildJobModel
+	for i := range queued {
+		job := &queued[i]
+		if !caps.CanBuild(job) {
+			continue
+		}
+		if first == nil {
+			first = job
+		}
+		if job.Priority == first.Priority && caps.hasImage(job.ContainerImage) {
+			cached = append(cached, job)
+		} else {
+			others = append(others, job)
+		}
+	}
+	return append(cached, others...)
+}
@@ -0,0 +1,37 @@
+package artifactory_test
+
+import (
+	"testing"
+
+	"github.com/edgetx/cloudbuild/artifactory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerCanBuild(t *testing.T) {
+	caps := &artifactory.WorkerCapabilities{
+		Arch:     "arm64",
+		MemoryMB: 4096,
+		Releases: ">= v2.10.0",
+	}
+	assert.Nil(t, caps.ParseReleases())
+
+	job := func(ref, requirements string) *artifactory.BuildJobModel {
+		return &artifactory.BuildJobModel{CommitRef: ref, Requirements: []byte(requirements)}
+	}
+	assert.True(t, caps.CanBuild(job("v2.10.5", `{}`)))
+	assert.True(t, caps.CanBuild(job("nightly", `{"platforms":["amd64","arm64"]}`)))
+	assert.True(t, caps.CanBuild(&artifactory.BuildJobModel{CommitRef: "v2.11.0"}))
+	assert.False(t, caps.CanBuild(job("v2.9.0", `{}`)))
+	assert.False(t, caps.CanBuild(job("v2.10.5", `{"platforms":["amd64"]}`)))
+	assert.False(t, caps.CanBuild(job("v2.10.5", `{"min_memory_mb":8192}`)))
+
+	unlimited := &artifactory.WorkerCapabilities{Arch: "amd64"}
+	assert.Nil(t, unlimited.ParseReleases())
+	assert.True(t, unlimited.CanBuild(job("v2.9.0", `{"min_memory_mb":8192}`)))
+
+	var noCaps *artifactory.WorkerCapabilities
+	assert.True(t, noCaps.CanBuild(job("v2.9.0", `{"platforms":["riscv64"]}`)))
+
+	invalid := &artifactory.WorkerCapabilities{Releases: "latest"}
+	assert.Error(t, invalid.ParseReleases())
+}
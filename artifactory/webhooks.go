@@ -0,0 +1,394 @@
+package artifactory
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	WebhookEventStatusChanged = "job.status_changed"
+
+	WebhookSignatureHeader = "X-Cloudbuild-Signature"
+	WebhookTimestampHeader = "X-Cloudbuild-Timestamp"
+	WebhookDeliveryHeader  = "X-Cloudbuild-Delivery"
+	WebhookEventHeader     = "X-Cloudbuild-Event"
+
+	MaxWebhookAttempts      = 8
+	WebhookDispatchInterval = time.Second
+	webhookBackoffBase      = 30 * time.Second
+	webhookBackoffMax       = 6 * time.Hour
+	webhookBatchSize        = 20
+	webhookTimeout          = 10 * time.Second
+	// a reserved delivery is retried after this if the dispatcher dies.
+	webhookLease = time.Minute
+)
+
+var (
+	ErrInvalidWebhookURL    = errors.New("invalid webhook URL")
+	ErrInvalidWebhookStatus = errors.New("invalid webhook status")
+	ErrWebhookNotFound      = errors.New("webhook subscription not found")
+	ErrWebhookStatus        = errors.New("webhook endpoint returned an error")
+	ErrWebhookForbiddenDst  = errors.New("webhook destination not allowed")
+	ErrCallbacksDisabled    = errors.New("job callbacks are disabled: no webhook secret is configured")
+)
+
+// WebhookPayload is the body POSTed to webhook endpoints.
+type WebhookPayload struct {
+	Event      string          `json:"event"`
+	Job        WebhookJobState `json:"job"`
+	OccurredAt time.Time       `json:"occurred_at"`
+}
+
+type WebhookJobState struct {
+	ID             string      `json:"id"`
+	From           BuildStatus `json:"from"`
+	Status         BuildStatus `json:"status"`
+	CommitHash     string      `json:"commit_hash"`
+	CommitRef      string      `json:"release"`
+	Target         string      `json:"target"`
+	BuildFlagsHash string      `json:"build_flags_hash"`
+}
+
+// ValidateWebhookURL accepts absolute http(s) URLs.
+func ValidateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: %s", ErrInvalidWebhookURL, rawURL)
+	}
+	return nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of "<timestamp>.<payload>".
+func SignWebhook(secret []byte, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks a signature computed with SignWebhook.
+func VerifyWebhook(secret []byte, timestamp string, payload []byte, signature string) bool {
+	expected := SignWebhook(secret, timestamp, payload)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// webhookBackoff returns the delay before the next attempt,
+// doubling after each failed attempt.
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookBackoffBase
+	for i := 1; i < attempts && delay < webhookBackoffMax; i++ {
+		delay *= 2
+	}
+	return min(delay, webhookBackoffMax)
+}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+func (artifactory *Artifactory) CreateWebhook(
+	rawURL string, statuses []BuildStatus,
+) (*WebhookSubscriptionDto, error) {
+	if err := ValidateWebhookURL(rawURL); err != nil {
+		return nil, err
+	}
+	for _, status := range statuses {
+		switch status {
+		case WaitingForBuild, BuildInProgress, BuildSuccess, BuildError, BuildCancelled:
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrInvalidWebhookStatus, status)
+		}
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	statusesJSON, err := json.Marshal(statuses)
+	if err != nil {
+		return nil, err
+	}
+	subscription, err := artifactory.WebhooksRepository.CreateSubscription(WebhookSubscriptionModel{
+		URL:      rawURL,
+		Secret:   secret,
+		Statuses: statusesJSON,
+	})
+	if err != nil {
+		return nil, err
+	}
+	dto := WebhookSubscriptionDtoFromModel(subscription)
+	// the secret is only returned on creation
+	dto.Secret = subscription.Secret
+	return &dto, nil
+}
+
+func (artifactory *Artifactory) ListWebhooks() (*[]WebhookSubscriptionDto, error) {
+	subscriptions, err := artifactory.WebhooksRepository.ListSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+	dtos := make([]WebhookSubscriptionDto, len(*subscriptions))
+	for i := range *subscriptions {
+		dtos[i] = WebhookSubscriptionDtoFromModel(&(*subscriptions)[i])
+	}
+	return &dtos, nil
+}
+
+func (artifactory *Artifactory) DeleteWebhook(id string) error {
+	uid, err := uuid.FromString(id)
+	if err != nil {
+		return ErrWebhookNotFound
+	}
+	err = artifactory.WebhooksRepository.DeleteSubscription(uid)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+func (artifactory *Artifactory) ListWebhookDeliveries(
+	query *WebhookDeliveryQuery,
+) (*[]WebhookDeliveryDto, error) {
+	deliveries, err := artifactory.WebhooksRepository.ListDeliveries(query)
+	if err != nil {
+		return nil, err
+	}
+	dtos := make([]WebhookDeliveryDto, len(*deliveries))
+	for i := range *deliveries {
+		dtos[i] = WebhookDeliveryDtoFromModel(&(*deliveries)[i])
+	}
+	return &dtos, nil
+}
+
+// WebhookDispatcher delivers the queued webhooks.
+type WebhookDispatcher struct {
+	artifactory *Artifactory
+	// Secret signs the job callbacks, subscriptions have their own.
+	Secret []byte
+	// subscriptions are configured by administrators, while job callbacks
+	// are set by anyone and must not reach the internal network.
+	client         *http.Client
+	callbackClient *http.Client
+}
+
+func NewWebhookDispatcher(
+	artifactory *Artifactory, secret []byte, allowPrivateCallbacks bool,
+) *WebhookDispatcher {
+	callbackClient := &http.Client{Timeout: webhookTimeout}
+	if !allowPrivateCallbacks {
+		callbackClient.Transport = publicOnlyTransport()
+	}
+	return &WebhookDispatcher{
+		artifactory:    artifactory,
+		Secret:         secret,
+		client:         &http.Client{Timeout: webhookTimeout},
+		callbackClient: callbackClient,
+	}
+}
+
+// forbiddenCallbackPrefixes are the special-purpose address ranges which
+// job callbacks cannot reach: private, shared (CGNAT), loopback,
+// link-local, benchmarking, documentation, multicast and reserved.
+var forbiddenCallbackPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.88.99.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/23"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+func isForbiddenCallbackAddr(addr netip.Addr) bool {
+	// e.g. ::ffff:127.0.0.1 is 127.0.0.1
+	addr = addr.Unmap()
+	for _, prefix := range forbiddenCallbackPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// publicOnlyTransport refuses to connect to the forbidden callback
+// addresses, whatever the host name resolves to.
+func publicOnlyTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || isForbiddenCallbackAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrWebhookForbiddenDst, address)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// secrets returns the signing secrets by subscription ID,
+// the job callbacks being signed with the dispatcher secret, if any.
+func (dispatcher *WebhookDispatcher) secrets() (map[string][]byte, error) {
+	subscriptions, err := dispatcher.artifactory.WebhooksRepository.ListSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+	secrets := make(map[string][]byte, len(*subscriptions)+1)
+	if len(dispatcher.Secret) > 0 {
+		secrets[""] = dispatcher.Secret
+	}
+	for _, subscription := range *subscriptions {
+		secrets[subscription.ID.String()] = []byte(subscription.Secret)
+	}
+	return secrets, nil
+}
+
+// deliver POSTs the payload once and returns the recorded attempt.
+func (dispatcher *WebhookDispatcher) deliver(
+	ctx context.Context, delivery *WebhookDeliveryModel, secret []byte,
+) *WebhookAttemptModel {
+	attempt := &WebhookAttemptModel{CreatedAt: time.Now()}
+	timestamp := strconv.FormatInt(attempt.CreatedAt.Unix(), 10)
+	payload := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "EdgeTX-Cloudbuild-Webhook")
+	req.Header.Set(WebhookEventHeader, WebhookEventStatusChanged)
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID.String())
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(secret, timestamp, payload))
+
+	client := dispatcher.client
+	if delivery.SubscriptionID == "" {
+		client = dispatcher.callbackClient
+	}
+	resp, err := client.Do(req)
+	attempt.Duration = time.Since(attempt.CreatedAt)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024)) //nolint:errcheck
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("%s: %s", ErrWebhookStatus, resp.Status)
+	}
+	return attempt
+}
+
+// process attempts one delivery and schedules the next attempt on failure.
+func (dispatcher *WebhookDispatcher) process(
+	ctx context.Context, delivery *WebhookDeliveryModel, secrets map[string][]byte,
+) {
+	var attempt *WebhookAttemptModel
+	secret, ok := secrets[delivery.SubscriptionID]
+	switch {
+	case ok:
+		attempt = dispatcher.deliver(ctx, delivery, secret)
+	case delivery.SubscriptionID == "":
+		// never send unsigned callbacks
+		attempt = &WebhookAttemptModel{CreatedAt: time.Now(), Error: ErrCallbacksDisabled.Error()}
+		delivery.Attempts = MaxWebhookAttempts - 1
+	default:
+		// the subscription was removed meanwhile
+		attempt = &WebhookAttemptModel{CreatedAt: time.Now(), Error: ErrWebhookNotFound.Error()}
+		delivery.Attempts = MaxWebhookAttempts - 1
+	}
+
+	delivery.Attempts++
+	switch {
+	case attempt.Error == "":
+		delivery.Status = WebhookDelivered
+		delivery.DeliveredAt = time.Now()
+	case delivery.Attempts >= MaxWebhookAttempts:
+		delivery.Status = WebhookFailed
+		log.Warnf("giving up webhook delivery %s to %s: %s", delivery.ID, delivery.URL, attempt.Error)
+	default:
+		delivery.NextAttemptAt = time.Now().Add(webhookBackoff(delivery.Attempts))
+	}
+	if err := dispatcher.artifactory.WebhooksRepository.SaveAttempt(delivery, attempt); err != nil {
+		log.Errorf("failed to save webhook delivery %s: %s", delivery.ID, err)
+	}
+}
+
+// DispatchDue delivers the webhooks due for an attempt,
+// it returns the number of deliveries processed.
+func (dispatcher *WebhookDispatcher) DispatchDue(ctx context.Context) (int, error) {
+	deliveries, err := dispatcher.artifactory.WebhooksRepository.ReserveDueDeliveries(
+		webhookBatchSize, webhookLease,
+	)
+	if err != nil || len(*deliveries) == 0 {
+		return 0, err
+	}
+	secrets, err := dispatcher.secrets()
+	if err != nil {
+		return 0, err
+	}
+	for i := range *deliveries {
+		dispatcher.process(ctx, &(*deliveries)[i], secrets)
+	}
+	return len(*deliveries), nil
+}
+
+func (dispatcher *WebhookDispatcher) Run() {
+	for {
+		processed, err := dispatcher.DispatchDue(context.Background())
+		if err != nil {
+			log.Errorf("failed to dispatch webhooks: %s", err)
+		}
+		if processed < webhookBatchSize {
+			time.Sleep(WebhookDispatchInterval)
+		}
+	}
+}
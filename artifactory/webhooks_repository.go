@@ -0,0 +1,207 @@
+package artifactory
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/edgetx/cloudbuild/database"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+type WebhooksRepository interface {
+	CreateSubscription(model WebhookSubscriptionModel) (*WebhookSubscriptionModel, error)
+	ListSubscriptions() (*[]WebhookSubscriptionModel, error)
+	DeleteSubscription(ID uuid.UUID) error
+	Enqueue(deliveries []WebhookDeliveryModel) error
+	ReserveDueDeliveries(limit int, lease time.Duration) (*[]WebhookDeliveryModel, error)
+	SaveAttempt(delivery *WebhookDeliveryModel, attempt *WebhookAttemptModel) error
+	ListDeliveries(query *WebhookDeliveryQuery) (*[]WebhookDeliveryModel, error)
+}
+
+// JobOutbox queues the notifications of a job status change
+// in the transaction changing the status.
+type JobOutbox interface {
+	EnqueueStatusChange(tx *gorm.DB, job *BuildJobModel, from, to BuildStatus) error
+}
+
+// WebhookDeliveryQuery selects the deliveries of a subscription or a job.
+type WebhookDeliveryQuery struct {
+	SubscriptionID string
+	BuildJobID     string
+	Limit          int
+}
+
+type WebhooksDBRepository struct {
+	db *gorm.DB
+}
+
+func NewWebhooksDBRepository(db *gorm.DB) *WebhooksDBRepository {
+	return &WebhooksDBRepository{
+		db: db,
+	}
+}
+
+func (repository *WebhooksDBRepository) CreateSubscription(
+	model WebhookSubscriptionModel,
+) (*WebhookSubscriptionModel, error) {
+	if err := repository.db.Create(&model).Error; err != nil {
+		return nil, errors.Wrap(err, "failed to create webhook subscription")
+	}
+	return &model, nil
+}
+
+func (repository *WebhooksDBRepository) ListSubscriptions() (*[]WebhookSubscriptionModel, error) {
+	var subscriptions []WebhookSubscriptionModel
+	err := repository.db.Order("created_at").Find(&subscriptions).Error
+	return &subscriptions, err
+}
+
+func (repository *WebhooksDBRepository) DeleteSubscription(id uuid.UUID) error {
+	res := repository.db.Delete(&WebhookSubscriptionModel{ID: id})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (repository *WebhooksDBRepository) Enqueue(deliveries []WebhookDeliveryModel) error {
+	return enqueueDeliveries(repository.db, deliveries)
+}
+
+func enqueueDeliveries(tx *gorm.DB, deliveries []WebhookDeliveryModel) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return tx.Create(&deliveries).Error
+}
+
+// EnqueueStatusChange queues the deliveries of a job status change to the
+// subscriptions and the job callback.
+func (repository *WebhooksDBRepository) EnqueueStatusChange(
+	tx *gorm.DB, job *BuildJobModel, from, to BuildStatus,
+) error {
+	payload, err := json.Marshal(WebhookPayload{
+		Event: WebhookEventStatusChanged,
+		Job: WebhookJobState{
+			ID:             job.ID.String(),
+			From:           from,
+			Status:         to,
+			CommitHash:     job.CommitHash,
+			CommitRef:      job.CommitRef,
+			Target:         job.Target,
+			BuildFlagsHash: job.BuildFlagsHash,
+		},
+		OccurredAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	var subscriptions []WebhookSubscriptionModel
+	if err := tx.Order("created_at").Find(&subscriptions).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	newDelivery := func(subscriptionID, url string) WebhookDeliveryModel {
+		return WebhookDeliveryModel{
+			SubscriptionID: subscriptionID,
+			BuildJobID:     job.ID.String(),
+			URL:            url,
+			Payload:        payload,
+			Status:         WebhookPending,
+			NextAttemptAt:  now,
+		}
+	}
+	var deliveries []WebhookDeliveryModel
+	for i := range subscriptions {
+		subscription := &subscriptions[i]
+		var statuses []BuildStatus
+		if subscription.Statuses != nil {
+			if err := json.Unmarshal(subscription.Statuses, &statuses); err != nil {
+				return err
+			}
+		}
+		if len(statuses) > 0 && !slices.Contains(statuses, to) {
+			continue
+		}
+		deliveries = append(deliveries, newDelivery(subscription.ID.String(), subscription.URL))
+	}
+	if job.CallbackURL != "" {
+		deliveries = append(deliveries, newDelivery("", job.CallbackURL))
+	}
+	return enqueueDeliveries(tx, deliveries)
+}
+
+// ReserveDueDeliveries returns the pending deliveries due for an attempt and
+// postpones them by lease, so that concurrent dispatchers skip them.
+func (repository *WebhooksDBRepository) ReserveDueDeliveries(
+	limit int, lease time.Duration,
+) (*[]WebhookDeliveryModel, error) {
+	var deliveries []WebhookDeliveryModel
+	now := time.Now()
+	err := repository.db.Raw(
+		fmt.Sprintf(`
+			UPDATE webhook_deliveries
+			SET next_attempt_at = @leaseUntil
+			WHERE id IN (
+				SELECT id FROM webhook_deliveries
+				WHERE status = @status AND next_attempt_at <= @now
+				ORDER BY next_attempt_at
+				LIMIT @limit
+				%s
+			)
+			RETURNING *
+		`, database.DialectOf(repository.db).SkipLocked()),
+		sql.Named("leaseUntil", now.Add(lease)),
+		sql.Named("status", WebhookPending),
+		sql.Named("now", now),
+		sql.Named("limit", limit),
+	).Scan(&deliveries).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to reserve webhook deliveries")
+	}
+	return &deliveries, nil
+}
+
+func (repository *WebhooksDBRepository) SaveAttempt(
+	delivery *WebhookDeliveryModel, attempt *WebhookAttemptModel,
+) error {
+	return repository.db.Transaction(func(tx *gorm.DB) error {
+		attempt.DeliveryID = delivery.ID.String()
+		if err := tx.Create(attempt).Error; err != nil {
+			return err
+		}
+		return tx.Model(delivery).Select(
+			"status", "attempts", "next_attempt_at", "delivered_at",
+		).Updates(delivery).Error
+	})
+}
+
+func (repository *WebhooksDBRepository) ListDeliveries(
+	query *WebhookDeliveryQuery,
+) (*[]WebhookDeliveryModel, error) {
+	var deliveries []WebhookDeliveryModel
+	tx := repository.db.Preload("AttemptLogs", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at")
+	})
+	if query.SubscriptionID != "" {
+		tx = tx.Where("subscription_id = ?", query.SubscriptionID)
+	}
+	if query.BuildJobID != "" {
+		tx = tx.Where("build_job_id = ?", query.BuildJobID)
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	err := tx.Order("created_at DESC").Limit(limit).Find(&deliveries).Error
+	return &deliveries, err
+}
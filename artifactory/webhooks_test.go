@@ -0,0 +1,253 @@
+package artifactory_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/edgetx/cloudbuild/artifactory"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryWebhooks is an in-memory WebhooksRepository.
+type memoryWebhooks struct {
+	subscriptions []artifactory.WebhookSubscriptionModel
+	deliveries    []artifactory.WebhookDeliveryModel
+}
+
+func (repo *memoryWebhooks) CreateSubscription(
+	model artifactory.WebhookSubscriptionModel,
+) (*artifactory.WebhookSubscriptionModel, error) {
+	model.ID = uuid.NewV4()
+	repo.subscriptions = append(repo.subscriptions, model)
+	return &model, nil
+}
+
+func (repo *memoryWebhooks) ListSubscriptions() (*[]artifactory.WebhookSubscriptionModel, error) {
+	return &repo.subscriptions, nil
+}
+
+func (repo *memoryWebhooks) DeleteSubscription(id uuid.UUID) error {
+	return nil
+}
+
+func (repo *memoryWebhooks) Enqueue(deliveries []artifactory.WebhookDeliveryModel) error {
+	for _, delivery := range deliveries {
+		delivery.ID = uuid.NewV4()
+		repo.deliveries = append(repo.deliveries, delivery)
+	}
+	return nil
+}
+
+func (repo *memoryWebhooks) ReserveDueDeliveries(
+	limit int, lease time.Duration,
+) (*[]artifactory.WebhookDeliveryModel, error) {
+	var due []artifactory.WebhookDeliveryModel
+	for i := range repo.deliveries {
+		delivery := &repo.deliveries[i]
+		if delivery.Status == artifactory.WebhookPending && !delivery.NextAttemptAt.After(time.Now()) {
+			delivery.NextAttemptAt = time.Now().Add(lease)
+			due = append(due, *delivery)
+		}
+	}
+	return &due, nil
+}
+
+func (repo *memoryWebhooks) SaveAttempt(
+	delivery *artifactory.WebhookDeliveryModel, attempt *artifactory.WebhookAttemptModel,
+) error {
+	for i := range repo.deliveries {
+		if repo.deliveries[i].ID == delivery.ID {
+			delivery.AttemptLogs = append(repo.deliveries[i].AttemptLogs, *attempt)
+			repo.deliveries[i] = *delivery
+		}
+	}
+	return nil
+}
+
+func (repo *memoryWebhooks) ListDeliveries(
+	query *artifactory.WebhookDeliveryQuery,
+) (*[]artifactory.WebhookDeliveryModel, error) {
+	return &repo.deliveries, nil
+}
+
+func newWebhookArtifactory(repo *memoryWebhooks) *artifactory.Artifactory {
+	art := artifactory.New(nil, nil, "", "", nil)
+	art.WebhooksRepository = repo
+	return art
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	payload := []byte(`{"event":"job.status_changed"}`)
+	signature := artifactory.SignWebhook([]byte("secret"), "1700000000", payload)
+
+	assert.Regexp(t, "^sha256=[0-9a-f]{64}$", signature)
+	assert.True(t, artifactory.VerifyWebhook([]byte("secret"), "1700000000", payload, signature))
+	assert.False(t, artifactory.VerifyWebhook([]byte("secret"), "1700000001", payload, signature))
+	assert.False(t, artifactory.VerifyWebhook([]byte("other"), "1700000000", payload, signature))
+}
+
+func TestCreateWebhookValidation(t *testing.T) {
+	art := newWebhookArtifactory(&memoryWebhooks{})
+
+	_, err := art.CreateWebhook("ftp://example.com/hook", nil)
+	assert.ErrorIs(t, err, artifactory.ErrInvalidWebhookURL)
+
+	_, err = art.CreateWebhook("https://example.com/hook", []artifactory.BuildStatus{"DONE"})
+	assert.ErrorIs(t, err, artifactory.ErrInvalidWebhookStatus)
+
+	webhook, err := art.CreateWebhook(
+		"https://example.com/hook", []artifactory.BuildStatus{artifactory.BuildSuccess},
+	)
+	assert.Nil(t, err)
+	assert.Len(t, webhook.Secret, 64)
+	assert.Equal(t, []artifactory.BuildStatus{artifactory.BuildSuccess}, webhook.Statuses)
+}
+
+func TestDispatchWebhook(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	repo := &memoryWebhooks{}
+	art := newWebhookArtifactory(repo)
+	webhook, err := art.CreateWebhook(server.URL, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, repo.Enqueue([]artifactory.WebhookDeliveryModel{{
+		SubscriptionID: webhook.ID,
+		URL:            server.URL,
+		Payload:        []byte(`{"event":"job.status_changed"}`),
+		Status:         artifactory.WebhookPending,
+	}}))
+
+	dispatcher := artifactory.NewWebhookDispatcher(art, nil, false)
+	processed, err := dispatcher.DispatchDue(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, processed)
+
+	timestamp := received.Header.Get(artifactory.WebhookTimestampHeader)
+	signature := received.Header.Get(artifactory.WebhookSignatureHeader)
+	assert.True(t, artifactory.VerifyWebhook([]byte(webhook.Secret), timestamp, body, signature))
+	assert.Equal(t, repo.deliveries[0].ID.String(), received.Header.Get(artifactory.WebhookDeliveryHeader))
+	assert.Equal(t, artifactory.WebhookDelivered, repo.deliveries[0].Status)
+	assert.Equal(t, 1, repo.deliveries[0].Attempts)
+	assert.Equal(t, http.StatusOK, repo.deliveries[0].AttemptLogs[0].StatusCode)
+}
+
+func TestDispatchWebhookRetries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	repo := &memoryWebhooks{}
+	art := newWebhookArtifactory(repo)
+	assert.Nil(t, repo.Enqueue([]artifactory.WebhookDeliveryModel{{
+		URL:     server.URL,
+		Payload: []byte(`{}`),
+		Status:  artifactory.WebhookPending,
+	}}))
+
+	dispatcher := artifactory.NewWebhookDispatcher(art, []byte("secret"), true)
+	_, err := dispatcher.DispatchDue(context.Background())
+	assert.Nil(t, err)
+
+	delivery := repo.deliveries[0]
+	assert.Equal(t, artifactory.WebhookPending, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.WithinDuration(t, time.Now().Add(30*time.Second), delivery.NextAttemptAt, 5*time.Second)
+	assert.Contains(t, delivery.AttemptLogs[0].Error, "500")
+
+	// not due yet
+	processed, err := dispatcher.DispatchDue(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, processed)
+
+	for i := 1; i < artifactory.MaxWebhookAttempts; i++ {
+		repo.deliveries[0].NextAttemptAt = time.Now()
+		_, err = dispatcher.DispatchDue(context.Background())
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, artifactory.WebhookFailed, repo.deliveries[0].Status)
+	assert.Len(t, repo.deliveries[0].AttemptLogs, artifactory.MaxWebhookAttempts)
+}
+
+func TestCallbackToPrivateAddressRejected(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	repo := &memoryWebhooks{}
+	art := newWebhookArtifactory(repo)
+	assert.Nil(t, repo.Enqueue([]artifactory.WebhookDeliveryModel{{
+		URL:     server.URL,
+		Payload: []byte(`{}`),
+		Status:  artifactory.WebhookPending,
+	}}))
+
+	dispatcher := artifactory.NewWebhookDispatcher(art, []byte("secret"), false)
+	_, err := dispatcher.DispatchDue(context.Background())
+	assert.Nil(t, err)
+	assert.False(t, called)
+	assert.Contains(t, repo.deliveries[0].AttemptLogs[0].Error, artifactory.ErrWebhookForbiddenDst.Error())
+}
+
+func TestUnsignedCallbackNotSent(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	repo := &memoryWebhooks{}
+	art := newWebhookArtifactory(repo)
+	assert.Nil(t, repo.Enqueue([]artifactory.WebhookDeliveryModel{{
+		URL:     server.URL,
+		Payload: []byte(`{}`),
+		Status:  artifactory.WebhookPending,
+	}}))
+
+	dispatcher := artifactory.NewWebhookDispatcher(art, nil, true)
+	_, err := dispatcher.DispatchDue(context.Background())
+	assert.Nil(t, err)
+	assert.False(t, called)
+	assert.Equal(t, artifactory.WebhookFailed, repo.deliveries[0].Status)
+	assert.Equal(t, artifactory.ErrCallbacksDisabled.Error(), repo.deliveries[0].AttemptLogs[0].Error)
+}
+
+func TestCallbackToSpecialAddressesRejected(t *testing.T) {
+	for _, url := range []string{
+		"http://100.64.0.1:8080/cgnat",
+		"http://0.1.2.3:8080/this-network",
+		"http://198.18.0.1:8080/benchmarking",
+		"http://169.254.169.254/metadata",
+		"http://[::ffff:127.0.0.1]:8080/mapped",
+		"http://[::ffff:10.0.0.1]:8080/mapped",
+		"http://[fd00::1]:8080/unique-local",
+	} {
+		t.Run(url, func(t *testing.T) {
+			repo := &memoryWebhooks{}
+			art := newWebhookArtifactory(repo)
+			assert.Nil(t, repo.Enqueue([]artifactory.WebhookDeliveryModel{{
+				URL:     url,
+				Payload: []byte(`{}`),
+				Status:  artifactory.WebhookPending,
+			}}))
+
+			dispatcher := artifactory.NewWebhookDispatcher(art, []byte("secret"), false)
+			_, err := dispatcher.DispatchDue(context.Background())
+			assert.Nil(t, err)
+			assert.Contains(t, repo.deliveries[0].AttemptLogs[0].Error, artifactory.ErrWebhookForbiddenDst.Error())
+		})
+	}
+}
@@ -1,8 +1,30 @@
 package buildlogs
 
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultPublishInterval = time.Second
+)
+
+// Sink receives build output while the build is still running.
+type Sink interface {
+	Append(data string) error
+}
+
 type Recorder struct {
-	stdOut string
-	stdErr string
+	mu          sync.Mutex
+	stdOut      string
+	stdErr      string
+	sink        Sink
+	unpublished string
+	publishMu   sync.Mutex
 }
 
 func NewRecorder() *Recorder {
@@ -12,14 +34,92 @@ func NewRecorder() *Recorder {
 	}
 }
 
+func NewRecorderWithSink(sink Sink) *Recorder {
+	return &Recorder{
+		stdOut: "",
+		stdErr: "",
+		sink:   sink,
+	}
+}
+
+func (recorder *Recorder) record(data string) {
+	if recorder.sink != nil {
+		recorder.unpublished += data
+	}
+}
+
 func (recorder *Recorder) AddStdOut(data string) {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
 	recorder.stdOut += data
+	recorder.record(data)
 }
 
 func (recorder *Recorder) AddStdErr(data string) {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
 	recorder.stdErr += data
+	recorder.record(data)
+}
+
+// Write allows the recorder to be used as the output of a running command.
+func (recorder *Recorder) Write(p []byte) (int, error) {
+	recorder.AddStdOut(string(p))
+	return len(p), nil
 }
 
 func (recorder *Recorder) Logs() string {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
 	return recorder.stdOut + recorder.stdErr
 }
+
+// takeUnpublished returns the complete lines not yet sent to the sink,
+// or everything pending when partial is true.
+func (recorder *Recorder) takeUnpublished(partial bool) string {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	end := len(recorder.unpublished)
+	if !partial {
+		end = strings.LastIndexByte(recorder.unpublished, '\n') + 1
+	}
+	data := recorder.unpublished[:end]
+	recorder.unpublished = recorder.unpublished[end:]
+	return data
+}
+
+func (recorder *Recorder) publish(partial bool) error {
+	if recorder.sink == nil {
+		return nil
+	}
+	// keep chunks in order when Flush races with Publish
+	recorder.publishMu.Lock()
+	defer recorder.publishMu.Unlock()
+	data := recorder.takeUnpublished(partial)
+	if data == "" {
+		return nil
+	}
+	return recorder.sink.Append(data)
+}
+
+// Flush sends all pending output, including an unterminated last line,
+// to the sink.
+func (recorder *Recorder) Flush() error {
+	return recorder.publish(true)
+}
+
+// Publish sends complete lines to the sink every interval until ctx is done.
+func (recorder *Recorder) Publish(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return recorder.Flush()
+		case <-ticker.C:
+			if err := recorder.publish(false); err != nil {
+				log.Warnf("failed to publish build logs: %s", err)
+			}
+		}
+	}
+}
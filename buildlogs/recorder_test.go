@@ -0,0 +1,52 @@
+package buildlogs_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/edgetx/cloudbuild/buildlogs"
+	"github.com/stretchr/testify/assert"
+)
+
+type sliceSink struct {
+	chunks []string
+}
+
+func (sink *sliceSink) Append(data string) error {
+	sink.chunks = append(sink.chunks, data)
+	return nil
+}
+
+func TestRecorderFlushesPendingOutput(t *testing.T) {
+	sink := &sliceSink{}
+	recorder := buildlogs.NewRecorderWithSink(sink)
+
+	_, err := recorder.Write([]byte("line 1\nline 2\npartial"))
+	assert.Nil(t, err)
+	assert.Nil(t, recorder.Flush())
+	assert.Nil(t, recorder.Flush())
+
+	assert.Equal(t, []string{"line 1\nline 2\npartial"}, sink.chunks)
+	assert.Equal(t, "line 1\nline 2\npartial", recorder.Logs())
+}
+
+func TestRecorderPublishesCompleteLines(t *testing.T) {
+	sink := &sliceSink{}
+	recorder := buildlogs.NewRecorderWithSink(sink)
+	recorder.AddStdOut("line 1\nline")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Nil(t, recorder.Publish(ctx, 10*time.Millisecond))
+
+	assert.Equal(t, []string{"line 1\n", "line"}, sink.chunks)
+}
+
+func TestRecorderWithoutSink(t *testing.T) {
+	recorder := buildlogs.NewRecorder()
+	recorder.AddStdOut("out")
+	recorder.AddStdErr("err")
+	assert.Nil(t, recorder.Flush())
+	assert.Equal(t, "outerr", recorder.Logs())
+}
@@ -49,6 +49,7 @@ type BuildCommandArgs struct {
 	BuildFlagsFile   string
 	BuildFlagsInline string
 	BuildImage       string
+	ContainerRuntime string
 	SourceRepository string
 	LogLevel         log.Level
 	ArtifactLocation string
@@ -66,7 +67,13 @@ func ParseArgs() (*BuildCommandArgs, error) {
 		&config.BuildImage,
 		"build-image",
 		"ghcr.io/edgetx/edgetx-builder",
-		"specify podman image for building",
+		"specify container image for building",
+	)
+	flag.StringVar(
+		&config.ContainerRuntime,
+		"container-runtime",
+		string(firmware.RuntimePodman),
+		"specify container runtime: podman|docker|nerdctl",
 	)
 
 	flag.StringVar(
@@ -113,6 +120,10 @@ func ValidateBuildArgs(config *BuildCommandArgs) error {
 		return errors.New("can not specify both build flags file and inline build flags params")
 	}
 
+	if _, err := firmware.ParseContainerRuntime(config.ContainerRuntime); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -121,28 +132,58 @@ func Build(
 	target string,
 	versionTag string,
 	buildImage string,
+	containerRuntime firmware.ContainerRuntime,
 	sourceRepository string,
 	commitHash string,
 	buildFlags []firmware.BuildFlag,
-) ([]byte, error) {
+	artifactLocation string,
+) error {
 	sourceDir, err := os.MkdirTemp("/tmp", "edgetxsource")
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create tmp dir")
+		return errors.Wrap(err, "failed to create tmp dir")
 	}
 	defer os.RemoveAll(sourceDir)
 	recorder := buildlogs.NewRecorder()
 	gitDownloader := source.NewGitDownloader(sourceDir, recorder)
-	firmwareBuilder := firmware.NewPodmanBuilder(sourceDir, recorder, runtime.NumCPU(), 1024*1024*1024*2)
+	firmwareBuilder := firmware.NewContainerBuilder(
+		containerRuntime, sourceDir, recorder, runtime.NumCPU(), 1024*1024*1024*2,
+	)
 
 	err = gitDownloader.Download(ctx, sourceRepository, commitHash)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	firmwareBin, err := firmwareBuilder.Build(ctx, buildImage, target, versionTag, buildFlags)
+	artifacts, err := firmwareBuilder.Build(
+		ctx, buildImage, target, versionTag, buildFlags, firmware.DefaultArtifactRules,
+	)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return firmwareBin, nil
+	firmwareBin, err := firmware.FindArtifact(artifacts, firmware.FirmwareArtifact)
+	if err != nil {
+		return err
+	}
+
+	// the source directory is removed on return
+	return copyArtifact(firmwareBin, artifactLocation)
+}
+
+func copyArtifact(artifact *firmware.Artifact, location string) error {
+	src, err := artifact.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(location, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
 }
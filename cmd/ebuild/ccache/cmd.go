@@ -0,0 +1,47 @@
+package ccache
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/edgetx/cloudbuild/config"
+	"github.com/edgetx/cloudbuild/firmware"
+	"github.com/spf13/cobra"
+)
+
+func NewCCacheCommand(ctx context.Context, o *config.CloudbuildOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ccache",
+		Short: "Compiler cache related commands",
+	}
+
+	o.BindCliOpts(cmd)
+
+	evictCmd := &cobra.Command{
+		Use:   "evict",
+		Short: "Remove the least recently used compiler caches above the total size cap",
+		Run: func(cmd *cobra.Command, args []string) {
+			if o.WorkerCCacheDir == "" {
+				fmt.Println("no compiler cache directory configured")
+				os.Exit(1)
+			}
+			if o.WorkerCCacheTotalSizeMB == 0 {
+				fmt.Println("no total size cap configured, nothing to evict")
+				return
+			}
+			removed, err := firmware.EvictCompilerCaches(o.WorkerCCacheDir, o.WorkerCCacheTotalSizeMB)
+			for _, path := range removed {
+				fmt.Println("removed", path)
+			}
+			if err != nil {
+				fmt.Println("failed to evict compiler caches:", err)
+				os.Exit(1)
+			}
+		},
+	}
+	o.BindCCacheOpts(evictCmd)
+	cmd.AddCommand(evictCmd)
+
+	return cmd
+}
@@ -4,12 +4,50 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/edgetx/cloudbuild/config"
 	"github.com/edgetx/cloudbuild/database"
 	"github.com/spf13/cobra"
 )
 
+func newMigrator(o *config.CloudbuildOpts) *database.Migrator {
+	db, err := database.New(o.DatabaseDSN)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	return database.NewMigrator(db, database.Migrations())
+}
+
+// migrationCount parses the optional number of migrations argument.
+func migrationCount(args []string, defaultCount int) int {
+	if len(args) == 0 {
+		return defaultCount
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n <= 0 {
+		fmt.Println("invalid number of migrations:", args[0])
+		os.Exit(1)
+	}
+	return n
+}
+
+func printMigrations(action string, migrations []database.Migration, dryRun bool) {
+	if dryRun {
+		action = "Would have " + strings.ToLower(action)
+	}
+	for _, migration := range migrations {
+		fmt.Printf("%s %d %s\n", action, migration.Version, migration.Name)
+	}
+	if len(migrations) == 0 {
+		fmt.Println("Nothing to do")
+	}
+}
+
 func NewDBCommand(ctx context.Context, o *config.CloudbuildOpts) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "db",
@@ -17,17 +55,72 @@ func NewDBCommand(ctx context.Context, o *config.CloudbuildOpts) *cobra.Command
 	}
 	o.BindCliOpts(cmd)
 	o.BindDBOpts(cmd)
+
 	cmd.AddCommand(&cobra.Command{
-		Use:   "migrate",
-		Short: "Create / migrate DB schema",
+		Use:   "status",
+		Short: "List the applied and pending migrations",
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := database.Migrate(o.DatabaseDSN); err != nil {
+			statuses, err := newMigrator(o).Status()
+			if err != nil {
 				fmt.Println(err.Error())
 				os.Exit(1)
 			}
-			fmt.Println("Database migrated successfully")
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+			for _, status := range statuses {
+				appliedAt := "pending"
+				if status.AppliedAt != nil {
+					appliedAt = status.AppliedAt.Format(time.RFC3339)
+				}
+				if status.Unknown {
+					appliedAt += " (unknown to this build)"
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+			}
+			w.Flush()
 		},
 	})
+
+	var dryRun bool
+	upCmd := &cobra.Command{
+		Use:     "up [N]",
+		Aliases: []string{"migrate"},
+		Short:   "Apply the next N pending migrations (all by default)",
+		Args:    cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			migrator := newMigrator(o)
+			migrator.DryRun = dryRun
+			migrator.Output = os.Stdout
+			applied, err := migrator.Up(migrationCount(args, 0))
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			printMigrations("Applied", applied, dryRun)
+		},
+	}
+	upCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the SQL without changing the database")
+	cmd.AddCommand(upCmd)
+
+	downCmd := &cobra.Command{
+		Use:   "down [N]",
+		Short: "Revert the last N applied migrations (1 by default)",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			migrator := newMigrator(o)
+			migrator.DryRun = dryRun
+			migrator.Output = os.Stdout
+			reverted, err := migrator.Down(migrationCount(args, 1))
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			printMigrations("Reverted", reverted, dryRun)
+		},
+	}
+	downCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the SQL without changing the database")
+	cmd.AddCommand(downCmd)
+
 	cmd.AddCommand(&cobra.Command{
 		Use:   "drop",
 		Short: "Drop DB schema",
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/edgetx/cloudbuild/cmd/ebuild/auth"
+	"github.com/edgetx/cloudbuild/cmd/ebuild/ccache"
 	"github.com/edgetx/cloudbuild/cmd/ebuild/db"
 	"github.com/edgetx/cloudbuild/cmd/ebuild/run"
 	"github.com/edgetx/cloudbuild/config"
@@ -44,6 +45,7 @@ func init() {
 	rootCmd.AddCommand(run.NewRunCommand(ctx, o))
 	rootCmd.AddCommand(db.NewDBCommand(ctx, o))
 	rootCmd.AddCommand(auth.NewAuthCommand(ctx, o))
+	rootCmd.AddCommand(ccache.NewCCacheCommand(ctx, o))
 }
 
 func main() {
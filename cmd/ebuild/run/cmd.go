@@ -12,8 +12,10 @@ import (
 	"github.com/edgetx/cloudbuild/auth"
 	"github.com/edgetx/cloudbuild/config"
 	"github.com/edgetx/cloudbuild/database"
+	"github.com/edgetx/cloudbuild/firmware"
 	"github.com/edgetx/cloudbuild/processor"
 	"github.com/edgetx/cloudbuild/server"
+	"github.com/edgetx/cloudbuild/source"
 	"github.com/edgetx/cloudbuild/targets"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
@@ -36,8 +38,8 @@ func (s *serverRunner) initLogging() {
 
 func (s *serverRunner) runAPI(cmd *cobra.Command, args []string) {
 	s.initLogging()
-	if err := database.Migrate(s.opts.DatabaseDSN); err != nil {
-		fmt.Printf("failed to migrate database: %s", err)
+	if err := database.CheckSchema(s.opts.DatabaseDSN); err != nil {
+		fmt.Printf("failed to check database schema: %s, run `ebuild db up` first\n", err)
 		os.Exit(1)
 	}
 	if defs, err := targets.ReadTargetsDef(
@@ -58,13 +60,28 @@ func (s *serverRunner) runAPI(cmd *cobra.Command, args []string) {
 		fmt.Printf("failed to create artifactory: %s", err)
 		os.Exit(1)
 	}
+	if err := art.ValidateDownloadMode(); err != nil {
+		fmt.Printf("invalid download configuration: %s", err)
+		os.Exit(1)
+	}
 	auth, err := auth.NewAuthTokenDBFromConfig(s.opts)
 	if err != nil {
 		fmt.Printf("failed to create authenticator: %s", err)
 		os.Exit(1)
 	}
-	go processor.GarbageCollector(s.opts)
+	if !art.CallbacksEnabled {
+		log.Warnln("no webhook secret configured: build requests with a callback URL are refused")
+	}
+	go processor.GarbageCollector(s.opts, art)
 	go art.RunGarbageCollector()
+	go artifactory.NewWebhookDispatcher(
+		art,
+		[]byte(s.opts.WebhookSecret),
+		s.opts.WebhookAllowPrivateCallbacks,
+	).Run()
+	if policy := artifactory.RetentionPolicyFromConfig(s.opts); policy.Enabled() {
+		go art.RunRetentionCollector(policy)
+	}
 	app := server.New(art, auth, processor.NewWorkerDB(s.opts))
 	err = app.Start(
 		fmt.Sprintf("%s:%d",
@@ -87,7 +104,13 @@ func (s *serverRunner) runWorker(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	worker := processor.New(art)
+	slots := processor.SlotsFromConfig(s.opts)
+	worker := processor.New(art, slots)
+	worker.Runtime, err = firmware.ParseContainerRuntime(s.opts.ContainerRuntime)
+	if err != nil {
+		fmt.Printf("invalid worker configuration: %s", err)
+		os.Exit(1)
+	}
 	err = worker.PullImage(s.ctx, s.opts.BuildImage)
 	if err != nil {
 		fmt.Printf("failed to pre-pull edgetx build image")
@@ -96,14 +119,54 @@ func (s *serverRunner) runWorker(cmd *cobra.Command, args []string) {
 		log.Infof("Image downloaded successfully")
 	}
 
-	go processor.Heartbeat(s.opts)
+	images, err := worker.CachedImages(s.ctx)
+	if err != nil {
+		log.Warnf("failed to list cached images: %s", err)
+	}
+	worker.Capabilities, err = processor.CapabilitiesFromConfig(s.opts, slots, images)
+	if err != nil {
+		fmt.Printf("invalid worker configuration: %s", err)
+		os.Exit(1)
+	}
+
+	if s.opts.WorkerGitMirror != "" {
+		worker.Mirrors, err = source.NewMirrors(s.opts.WorkerGitMirror)
+		if err != nil {
+			fmt.Printf("invalid worker configuration: %s", err)
+			os.Exit(1)
+		}
+	}
+
+	if s.opts.WorkerCCacheDir != "" {
+		worker.CompilerCache, err = firmware.NewCompilerCache(
+			s.opts.WorkerCCacheDir, s.opts.WorkerCCacheMaxSizeMB,
+		)
+		if err != nil {
+			fmt.Printf("invalid worker configuration: %s", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := worker.Register(processor.NewWorkerDB(s.opts)); err != nil {
+		fmt.Printf("failed to register worker: %s", err)
+		os.Exit(1)
+	}
+	go worker.Heartbeat()
+	if s.opts.WorkerMetricsListen != "" {
+		go processor.ServeMetrics(s.opts.WorkerMetricsListen)
+	}
 	go worker.Run()
 
 	// Wait for interrupt signal to gracefully shutdown the server with
 	// a timeout of 4 minutes.
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	select {
+	case <-quit:
+	case <-worker.Drained():
+		log.Println("Worker drained")
+		return
+	}
 	log.Println("Shutting down server...")
 
 	ctx, cancel := context.WithTimeout(s.ctx, 4*time.Minute)
@@ -139,6 +202,7 @@ func NewAPICommand(s *serverRunner) *cobra.Command {
 
 func NewWorkerCommand(s *serverRunner) *cobra.Command {
 	cmd := s.makeCmd("worker", "Run a cloudbuild worker", s.runWorker)
+	s.opts.BindWorkerOpts(cmd)
 	return cmd
 }
 
@@ -150,6 +214,7 @@ func NewRunCommand(ctx context.Context, o *config.CloudbuildOpts) *cobra.Command
 	o.BindCliOpts(cmd)
 	o.BindDBOpts(cmd)
 	o.BindStorageOpts(cmd)
+	o.BindArtifactOpts(cmd)
 	o.BindBuildOpts(cmd)
 
 	s := newServerRunner(ctx, o)
@@ -48,24 +48,21 @@ func main() {
 			}
 		}
 
-		firmwareBin, err := cli.Build(
+		err := cli.Build(
 			ctx,
 			config.Target,
 			config.VersionTag,
 			config.BuildImage,
+			firmware.ContainerRuntime(config.ContainerRuntime),
 			config.SourceRepository,
 			config.CommitHash,
 			buildFlags,
+			config.ArtifactLocation,
 		)
 		if err != nil {
 			log.Fatalf("failed to build firmware: %s", err)
 		}
 
-		err = os.WriteFile(config.ArtifactLocation, firmwareBin, 0o600)
-		if err != nil {
-			log.Fatalf("failed to save built firmware: %s", err)
-		}
-
 		log.Info("firmware was built successfully")
 		os.Exit(0)
 	}(ctx)
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/mitchellh/mapstructure"
@@ -16,7 +17,21 @@ import (
 )
 
 // Define a static error.
-var ErrInvalidDataType = errors.New("invalid data type, expected string")
+var (
+	ErrInvalidDataType     = errors.New("invalid data type, expected string")
+	ErrInvalidDownloadMode = errors.New("invalid download mode")
+)
+
+const (
+	// DownloadModePublic joins the download URL and the object name.
+	DownloadModePublic = "public"
+	// DownloadModePresigned issues time-limited URLs from the storage (S3).
+	DownloadModePresigned = "presigned"
+	// DownloadModeSigned issues time-limited URLs served by the API itself.
+	DownloadModeSigned = "signed"
+)
+
+var DownloadModes = []string{DownloadModePublic, DownloadModePresigned, DownloadModeSigned}
 
 type LogLevel log.Level
 
@@ -102,21 +117,77 @@ type CloudbuildOpts struct {
 	StorageS3AccessKey     string `mapstructure:"s3-access-key"`
 	StorageS3SecretKey     string `mapstructure:"s3-secret-key"`
 
+	// Download options:
+	DownloadMode      string `mapstructure:"download-mode"`
+	DownloadSecret    string `mapstructure:"download-secret"`
+	DownloadURLExpiry uint32 `mapstructure:"download-url-expiry"`
+
+	// Rate limiting options:
+	RateLimitJobs      string `mapstructure:"rate-limit-jobs"`
+	RateLimitStatus    string `mapstructure:"rate-limit-status"`
+	MaxQueuedJobsPerIP uint32 `mapstructure:"max-queued-jobs-per-ip"`
+
+	// Webhook options:
+	WebhookSecret                string `mapstructure:"webhook-secret"`
+	WebhookAllowPrivateCallbacks bool   `mapstructure:"webhook-allow-private-callbacks"`
+
+	// Worker options:
+	WorkerSlots    uint16 `mapstructure:"worker-slots"`
+	WorkerCPUs     uint16 `mapstructure:"worker-cpus"`
+	WorkerMemoryMB uint32 `mapstructure:"worker-memory"`
+	// WorkerMetricsListen is the address of the worker /metrics endpoint.
+	WorkerMetricsListen string `mapstructure:"worker-metrics-listen"`
+	// WorkerLabels are comma separated key=value pairs describing the worker.
+	WorkerLabels string `mapstructure:"worker-labels"`
+	// WorkerReleases is a semver constraint on the releases built by the worker.
+	WorkerReleases string `mapstructure:"worker-releases"`
+	// WorkerGitMirror is the directory of the git mirrors shared by the builds.
+	WorkerGitMirror string `mapstructure:"worker-git-mirror"`
+	// ContainerRuntime runs the build containers (podman, docker or nerdctl).
+	ContainerRuntime string `mapstructure:"container-runtime"`
+	// WorkerCCacheDir is the directory of the compiler caches.
+	WorkerCCacheDir string `mapstructure:"worker-ccache-dir"`
+	// WorkerCCacheMaxSizeMB caps the size of each compiler cache.
+	WorkerCCacheMaxSizeMB int `mapstructure:"worker-ccache-max-size"`
+	// WorkerCCacheTotalSizeMB caps the size of all the compiler caches
+	// when evicting them, 0 disables the eviction.
+	WorkerCCacheTotalSizeMB int `mapstructure:"worker-ccache-total-size"`
+
+	// Retention options:
+	RetentionNightlyDays   uint32 `mapstructure:"retention-nightly-days"`
+	RetentionReleaseDays   uint32 `mapstructure:"retention-release-days"`
+	RetentionRemoveOrphans bool   `mapstructure:"retention-remove-orphans"`
+
+	// Artifact options:
+	ManifestSigningKey   string `mapstructure:"manifest-key"`
+	ChecksumBLAKE3       bool   `mapstructure:"checksum-blake3"`
+	ArtifactNameTemplate string `mapstructure:"artifact-name-template"`
+
 	Viper *viper.Viper
 }
 
 func NewOpts(v *viper.Viper) *CloudbuildOpts {
 	return &CloudbuildOpts{
-		Viper:                  v,
-		LogLevel:               InfoLevel,
-		HTTPBindPort:           3000,
-		TargetsDef:             "./targets.json",
-		TargetsRefreshInterval: 300,
-		BuildImage:             "ghcr.io/edgetx/edgetx-builder",
-		SourceRepository:       "https://github.com/EdgeTX/edgetx.git",
-		DownloadURL:            "http://localhost:3000",
-		StorageType:            "FILE_SYSTEM_STORAGE",
-		StoragePath:            "/tmp",
+		Viper:                   v,
+		LogLevel:                InfoLevel,
+		HTTPBindPort:            3000,
+		TargetsDef:              "./targets.json",
+		TargetsRefreshInterval:  300,
+		BuildImage:              "ghcr.io/edgetx/edgetx-builder",
+		SourceRepository:        "https://github.com/EdgeTX/edgetx.git",
+		DownloadURL:             "http://localhost:3000",
+		StorageType:             "FILE_SYSTEM_STORAGE",
+		StoragePath:             "/tmp",
+		DownloadMode:            DownloadModePublic,
+		DownloadURLExpiry:       3600,
+		WorkerSlots:             1,
+		WorkerMetricsListen:     ":9090",
+		WorkerCCacheMaxSizeMB:   5120,
+		WorkerCCacheTotalSizeMB: 20480,
+		ContainerRuntime:        "podman",
+		RateLimitJobs:           "30/m",
+		RateLimitStatus:         "300/m",
+		MaxQueuedJobsPerIP:      50,
 	}
 }
 
@@ -161,6 +232,25 @@ func (o *CloudbuildOpts) BindStorageOpts(c *cobra.Command) {
 		&o.StorageS3SecretKey, "s3-secret-key", o.StorageS3SecretKey,
 		"Storage secret key",
 	)
+	c.PersistentFlags().StringVar(
+		&o.DownloadMode, "download-mode", o.DownloadMode,
+		"Artifact download mode (public, presigned or signed)",
+	)
+}
+
+func (o *CloudbuildOpts) BindArtifactOpts(c *cobra.Command) {
+	c.PersistentFlags().StringVar(
+		&o.ManifestSigningKey, "manifest-key", o.ManifestSigningKey,
+		"Ed25519 private key (PEM) used to sign build manifests",
+	)
+	c.PersistentFlags().BoolVar(
+		&o.ChecksumBLAKE3, "checksum-blake3", o.ChecksumBLAKE3,
+		"Compute BLAKE3 checksums of artifacts in addition to SHA-256",
+	)
+	c.PersistentFlags().StringVar(
+		&o.ArtifactNameTemplate, "artifact-name-template", o.ArtifactNameTemplate,
+		"Downloaded file name template (e.g. {target}-{release}-{flags_short}.{ext})",
+	)
 }
 
 func (o *CloudbuildOpts) BindBuildOpts(c *cobra.Command) {
@@ -172,6 +262,57 @@ func (o *CloudbuildOpts) BindBuildOpts(c *cobra.Command) {
 	)
 }
 
+func (o *CloudbuildOpts) BindWorkerOpts(c *cobra.Command) {
+	c.Flags().Uint16Var(
+		&o.WorkerSlots, "worker-slots", o.WorkerSlots,
+		"Number of builds running concurrently",
+	)
+	c.Flags().Uint16Var(
+		&o.WorkerCPUs, "worker-cpus", o.WorkerCPUs,
+		"CPUs shared by the worker slots (0 uses all CPUs)",
+	)
+	c.Flags().Uint32Var(
+		&o.WorkerMemoryMB, "worker-memory", o.WorkerMemoryMB,
+		"Memory in MiB shared by the worker slots (0 means no limit)",
+	)
+	c.Flags().StringVar(
+		&o.WorkerMetricsListen, "worker-metrics-listen", o.WorkerMetricsListen,
+		"Listen address of the worker metrics endpoint (empty disables it)",
+	)
+	c.Flags().StringVar(
+		&o.WorkerLabels, "worker-labels", o.WorkerLabels,
+		"Worker labels (e.g. zone=eu,disk=ssd)",
+	)
+	c.Flags().StringVar(
+		&o.WorkerReleases, "worker-releases", o.WorkerReleases,
+		"Releases built by the worker (e.g. >= v2.10.0, empty means all)",
+	)
+	c.Flags().StringVar(
+		&o.WorkerGitMirror, "worker-git-mirror", o.WorkerGitMirror,
+		"Directory of the local git mirrors (empty disables them)",
+	)
+	c.Flags().StringVar(
+		&o.ContainerRuntime, "container-runtime", o.ContainerRuntime,
+		"Container runtime running the builds (podman, docker or nerdctl)",
+	)
+	o.BindCCacheOpts(c)
+}
+
+func (o *CloudbuildOpts) BindCCacheOpts(c *cobra.Command) {
+	c.Flags().StringVar(
+		&o.WorkerCCacheDir, "worker-ccache-dir", o.WorkerCCacheDir,
+		"Directory of the compiler caches (empty disables them)",
+	)
+	c.Flags().IntVar(
+		&o.WorkerCCacheMaxSizeMB, "worker-ccache-max-size", o.WorkerCCacheMaxSizeMB,
+		"Maximum size in MiB of each compiler cache (0 keeps the ccache default)",
+	)
+	c.Flags().IntVar(
+		&o.WorkerCCacheTotalSizeMB, "worker-ccache-total-size", o.WorkerCCacheTotalSizeMB,
+		"Maximum size in MiB of all the compiler caches when evicting (0 disables the eviction)",
+	)
+}
+
 func (o *CloudbuildOpts) BindAPIOpts(c *cobra.Command) {
 	c.Flags().Uint16VarP(
 		&o.HTTPBindPort, "port", "p", o.HTTPBindPort, "HTTP listen port",
@@ -189,11 +330,52 @@ func (o *CloudbuildOpts) BindAPIOpts(c *cobra.Command) {
 	c.Flags().StringVarP(
 		&o.DownloadURL, "download-url", "u", o.DownloadURL, "Artifact download URL",
 	)
+	c.Flags().StringVar(
+		&o.DownloadSecret, "download-secret", o.DownloadSecret,
+		"Secret used to sign download URLs (signed download mode)",
+	)
+	c.Flags().Uint32Var(
+		&o.DownloadURLExpiry, "download-url-expiry", o.DownloadURLExpiry,
+		"Validity of presigned and signed download URLs in seconds",
+	)
+	c.Flags().StringVar(
+		&o.RateLimitJobs, "rate-limit-jobs", o.RateLimitJobs,
+		"Build requests allowed per client (e.g. 30/m, 0 disables)",
+	)
+	c.Flags().StringVar(
+		&o.RateLimitStatus, "rate-limit-status", o.RateLimitStatus,
+		"Status requests allowed per client (e.g. 300/m, 0 disables)",
+	)
+	c.Flags().Uint32Var(
+		&o.MaxQueuedJobsPerIP, "max-queued-jobs-per-ip", o.MaxQueuedJobsPerIP,
+		"Queued jobs allowed per anonymous client IP (0 means no limit)",
+	)
+	c.Flags().StringVar(
+		&o.WebhookSecret, "webhook-secret", o.WebhookSecret,
+		"Secret used to sign the job callbacks",
+	)
+	c.Flags().BoolVar(
+		&o.WebhookAllowPrivateCallbacks, "webhook-allow-private-callbacks",
+		o.WebhookAllowPrivateCallbacks,
+		"Allow job callbacks to private and loopback addresses",
+	)
+	c.Flags().Uint32Var(
+		&o.RetentionNightlyDays, "retention-nightly-days", o.RetentionNightlyDays,
+		"Days to keep nightly builds (0 keeps them forever)",
+	)
+	c.Flags().Uint32Var(
+		&o.RetentionReleaseDays, "retention-release-days", o.RetentionReleaseDays,
+		"Days to keep release builds (0 keeps them forever)",
+	)
+	c.Flags().BoolVar(
+		&o.RetentionRemoveOrphans, "retention-remove-orphans", o.RetentionRemoveOrphans,
+		"Remove stored artifacts not belonging to any build",
+	)
 }
 
 func (o *CloudbuildOpts) Unmarshal() error {
 	// Unmarshal config into struct
-	return o.Viper.Unmarshal(
+	err := o.Viper.Unmarshal(
 		o,
 		viper.DecodeHook(
 			mapstructure.ComposeDecodeHookFunc(
@@ -202,6 +384,21 @@ func (o *CloudbuildOpts) Unmarshal() error {
 			),
 		),
 	)
+	if err != nil {
+		return err
+	}
+	return o.Validate()
+}
+
+// Validate checks the options which every command depends on.
+func (o *CloudbuildOpts) Validate() error {
+	if !slices.Contains(DownloadModes, o.DownloadMode) {
+		return fmt.Errorf(
+			"%w %q, expected one of: %s",
+			ErrInvalidDownloadMode, o.DownloadMode, strings.Join(DownloadModes, ", "),
+		)
+	}
+	return nil
 }
 
 func (o *CloudbuildOpts) JSON() string {
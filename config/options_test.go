@@ -0,0 +1,25 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/edgetx/cloudbuild/config"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalDownloadMode(t *testing.T) {
+	v := viper.New()
+	opts := config.NewOpts(v)
+	assert.Nil(t, opts.Unmarshal())
+	assert.Equal(t, config.DownloadModePublic, opts.DownloadMode)
+
+	v.Set("download-mode", "signed")
+	assert.Nil(t, opts.Unmarshal())
+	assert.Equal(t, config.DownloadModeSigned, opts.DownloadMode)
+
+	v.Set("download-mode", "private")
+	err := opts.Unmarshal()
+	assert.ErrorIs(t, err, config.ErrInvalidDownloadMode)
+	assert.ErrorContains(t, err, "public, presigned, signed")
+}
@@ -2,15 +2,50 @@ package database
 
 import (
 	"fmt"
+	"strings"
 
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+// SQLitePrefix starts the DSN of a SQLite database file, e.g. sqlite:///var/lib/cloudbuild.db
+const SQLitePrefix = "sqlite://"
+
+// sqliteDefaults let the API and the workers share the database file.
+var sqliteDefaults = [][2]string{
+	{"_busy_timeout", "10000"},
+	{"_journal_mode", "WAL"},
+	{"_txlock", "immediate"},
+	{"_foreign_keys", "1"},
+}
+
 func New(dsn string) (*gorm.DB, error) {
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(open(dsn), &gorm.Config{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connecto to the database: %w", err)
 	}
 	return db, nil
 }
+
+func open(dsn string) gorm.Dialector {
+	if strings.HasPrefix(dsn, SQLitePrefix) {
+		return sqlite.Open(sqliteDSN(dsn))
+	}
+	return postgres.Open(dsn)
+}
+
+// sqliteDSN converts a sqlite:// DSN to the file name and options of the driver.
+func sqliteDSN(dsn string) string {
+	path, query, _ := strings.Cut(strings.TrimPrefix(dsn, SQLitePrefix), "?")
+	options := []string{}
+	if query != "" {
+		options = append(options, query)
+	}
+	for _, option := range sqliteDefaults {
+		if !strings.Contains(query, option[0]+"=") {
+			options = append(options, option[0]+"="+option[1])
+		}
+	}
+	return "file:" + path + "?" + strings.Join(options, "&")
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Dialect hides the SQL that differs between the supported databases.
+type Dialect interface {
+	// SkipLocked is appended to a SELECT to lock the selected rows,
+	// skipping those locked by others.
+	SkipLocked() string
+	// Duration is the expression of the time between two timestamp columns.
+	Duration(start, end string) string
+	// DropSchema removes all the tables.
+	DropSchema(db *gorm.DB) error
+}
+
+// DialectOf returns the dialect of the database behind db.
+func DialectOf(db *gorm.DB) Dialect {
+	if db.Dialector.Name() == "sqlite" {
+		return sqliteDialect{}
+	}
+	return postgresDialect{}
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) SkipLocked() string {
+	return "FOR UPDATE SKIP LOCKED"
+}
+
+func (postgresDialect) Duration(start, end string) string {
+	return fmt.Sprintf("(%s - %s)", end, start)
+}
+
+func (postgresDialect) DropSchema(db *gorm.DB) error {
+	err := db.Exec("DROP SCHEMA IF EXISTS public CASCADE;").Error
+	if err != nil {
+		return fmt.Errorf("failed to drop schema: %w", err)
+	}
+
+	err = db.Exec("CREATE SCHEMA IF NOT EXISTS public;").Error
+	if err != nil {
+		return fmt.Errorf("failed to create db: %w", err)
+	}
+	return nil
+}
+
+// sqliteDialect relies on SQLite serializing the writes:
+// rows do not need to be locked.
+type sqliteDialect struct{}
+
+func (sqliteDialect) SkipLocked() string {
+	return ""
+}
+
+func (sqliteDialect) Duration(start, end string) string {
+	return fmt.Sprintf("(julianday(%s) - julianday(%s))", end, start)
+}
+
+func (sqliteDialect) DropSchema(db *gorm.DB) error {
+	tables, err := db.Migrator().GetTables()
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	// the pragma only applies to the connection running it
+	return db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+			return err
+		}
+		defer conn.Exec("PRAGMA foreign_keys = ON")
+		for _, table := range tables {
+			if strings.HasPrefix(table, "sqlite_") {
+				continue
+			}
+			if err := conn.Migrator().DropTable(table); err != nil {
+				return fmt.Errorf("failed to drop table %s: %w", table, err)
+			}
+		}
+		return nil
+	})
+}
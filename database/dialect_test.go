@@ -0,0 +1,47 @@
+package database_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edgetx/cloudbuild/database"
+	"github.com/stretchr/testify/assert"
+)
+
+type sampleModel struct {
+	ID        uint `gorm:"primary_key"`
+	StartedAt time.Time
+	EndedAt   time.Time
+}
+
+func TestSQLiteDatabase(t *testing.T) {
+	dsn := database.SQLitePrefix + filepath.Join(t.TempDir(), "test.db")
+	db, err := database.New(dsn)
+	assert.Nil(t, err)
+	dialect := database.DialectOf(db)
+	assert.Empty(t, dialect.SkipLocked())
+
+	var journalMode string
+	assert.Nil(t, db.Raw("PRAGMA journal_mode").Scan(&journalMode).Error)
+	assert.Equal(t, "wal", journalMode)
+
+	assert.Nil(t, db.AutoMigrate(&sampleModel{}))
+	start := time.Now()
+	assert.Nil(t, db.Create(&[]sampleModel{
+		{StartedAt: start, EndedAt: start.Add(time.Minute)},
+		{StartedAt: start, EndedAt: start.Add(time.Hour)},
+		{StartedAt: start, EndedAt: start.Add(time.Second)},
+	}).Error)
+	var ids []uint
+	err = db.Model(&sampleModel{}).
+		Order(dialect.Duration("started_at", "ended_at")+" desc").
+		Pluck("id", &ids).Error
+	assert.Nil(t, err)
+	assert.Equal(t, []uint{2, 1, 3}, ids)
+
+	assert.Nil(t, database.DropSchema(dsn))
+	tables, err := db.Migrator().GetTables()
+	assert.Nil(t, err)
+	assert.Empty(t, tables)
+}
@@ -10,27 +10,36 @@ func RegisterModels(objs ...interface{}) {
 	models = append(models, objs...)
 }
 
+// Migrate applies all the pending migrations.
 func Migrate(dsn string) error {
 	if db, err := New(dsn); err != nil {
 		return err
 	} else {
-		return db.AutoMigrate(models...)
+		_, err := NewMigrator(db, Migrations()).Up(0)
+		return err
 	}
 }
 
+// CheckSchema returns ErrSchemaBehind if migrations are pending.
+func CheckSchema(dsn string) error {
+	db, err := New(dsn)
+	if err != nil {
+		return err
+	}
+	pending, err := NewMigrator(db, Migrations()).Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d pending migrations", ErrSchemaBehind, len(pending))
+	}
+	return nil
+}
+
 func DropSchema(dsn string) error {
 	if db, err := New(dsn); err != nil {
 		return err
 	} else {
-		err = db.Exec("DROP SCHEMA IF EXISTS public CASCADE;").Error
-		if err != nil {
-			return fmt.Errorf("failed to drop schema: %w", err)
-		}
-
-		err = db.Exec("CREATE SCHEMA IF NOT EXISTS public;").Error
-		if err != nil {
-			return fmt.Errorf("failed to create db: %w", err)
-		}
-		return nil
+		return DialectOf(db).DropSchema(db)
 	}
 }
@@ -0,0 +1,287 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var (
+	ErrSchemaBehind          = errors.New("database schema is not up to date")
+	ErrIrreversibleMigration = errors.New("migration cannot be reverted")
+
+	// errDryRun rolls back the migrations of a dry run.
+	errDryRun = errors.New("dry run")
+)
+
+// Migration is a versioned change of the schema. Migrations are applied in
+// the order of their versions, and each version is applied only once.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	// Down reverts Up, or is nil if the migration cannot be reverted.
+	Down func(tx *gorm.DB) error
+}
+
+// SchemaMigrationModel records an applied migration.
+type SchemaMigrationModel struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (SchemaMigrationModel) TableName() string {
+	return "schema_migrations"
+}
+
+// baseline creates the tables of the registered models as they are, and is
+// also a no-op on the databases created before the schema was versioned.
+// As it always creates the latest tables, the later migrations must check
+// the current schema before changing it. It cannot be reverted, which would
+// drop all the data: use `ebuild db drop` to start from scratch.
+var baseline = Migration{
+	Version: 1,
+	Name:    "create registered models",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(models...)
+	},
+}
+
+var migrations = map[int]Migration{baseline.Version: baseline}
+
+// RegisterMigrations adds migrations to those applied by Migrate.
+func RegisterMigrations(objs ...Migration) {
+	for _, migration := range objs {
+		if _, ok := migrations[migration.Version]; ok {
+			panic(fmt.Sprintf("duplicate migration version %d", migration.Version))
+		}
+		migrations[migration.Version] = migration
+	}
+}
+
+// Migrations returns the registered migrations, in order.
+func Migrations() []Migration {
+	sorted := make([]Migration, 0, len(migrations))
+	for _, migration := range migrations {
+		sorted = append(sorted, migration)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	return sorted
+}
+
+// MigrationStatus tells whether a migration has been applied.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	// Unknown is set for the applied migrations missing from this build.
+	Unknown bool
+}
+
+// Migrator applies and reverts migrations. With DryRun, the migrations are
+// rolled back and their SQL is written to Output instead.
+type Migrator struct {
+	DryRun bool
+	Output io.Writer
+
+	db         *gorm.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB, migrations []Migration) *Migrator {
+	return &Migrator{
+		Output:     io.Discard,
+		db:         db,
+		migrations: migrations,
+	}
+}
+
+// Status lists the known and applied migrations, in order.
+func (migrator *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := migrator.applied(migrator.db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, 0, len(migrator.migrations))
+	for _, migration := range migrator.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &record.AppliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, record := range applied {
+		appliedAt := record.AppliedAt
+		statuses = append(statuses, MigrationStatus{
+			Version:   record.Version,
+			Name:      record.Name,
+			AppliedAt: &appliedAt,
+			Unknown:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// Pending returns the migrations not applied yet, in order.
+func (migrator *Migrator) Pending() ([]Migration, error) {
+	applied, err := migrator.applied(migrator.db)
+	if err != nil {
+		return nil, err
+	}
+	return migrator.pending(applied), nil
+}
+
+// Up applies the first n pending migrations, or all of them if n <= 0,
+// and returns the applied migrations.
+func (migrator *Migrator) Up(n int) ([]Migration, error) {
+	var done []Migration
+	err := migrator.transaction(func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&SchemaMigrationModel{}); err != nil {
+			return fmt.Errorf("failed to create schema_migrations: %w", err)
+		}
+		applied, err := migrator.applied(tx)
+		if err != nil {
+			return err
+		}
+		pending := migrator.pending(applied)
+		if n > 0 && n < len(pending) {
+			pending = pending[:n]
+		}
+		for _, migration := range pending {
+			if err := migration.Up(tx); err != nil {
+				return fmt.Errorf("failed to apply migration %d: %w", migration.Version, err)
+			}
+			err := tx.Create(&SchemaMigrationModel{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+			if err != nil {
+				return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	if err != nil {
+		// the whole batch was rolled back
+		return nil, err
+	}
+	return done, nil
+}
+
+// Down reverts the last n applied migrations, and returns them.
+func (migrator *Migrator) Down(n int) ([]Migration, error) {
+	var done []Migration
+	err := migrator.transaction(func(tx *gorm.DB) error {
+		applied, err := migrator.applied(tx)
+		if err != nil {
+			return err
+		}
+		for i := len(migrator.migrations) - 1; i >= 0 && len(done) < n; i-- {
+			migration := migrator.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == nil {
+				return fmt.Errorf("%w: %d %s", ErrIrreversibleMigration, migration.Version, migration.Name)
+			}
+			if err := migration.Down(tx); err != nil {
+				return fmt.Errorf("failed to revert migration %d: %w", migration.Version, err)
+			}
+			err := tx.Delete(&SchemaMigrationModel{}, migration.Version).Error
+			if err != nil {
+				return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	if err != nil {
+		// the whole batch was rolled back
+		return nil, err
+	}
+	return done, nil
+}
+
+func (migrator *Migrator) applied(db *gorm.DB) (map[int]SchemaMigrationModel, error) {
+	applied := make(map[int]SchemaMigrationModel)
+	if !db.Migrator().HasTable(&SchemaMigrationModel{}) {
+		return applied, nil
+	}
+	var records []SchemaMigrationModel
+	if err := db.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+func (migrator *Migrator) pending(applied map[int]SchemaMigrationModel) []Migration {
+	pending := make([]Migration, 0)
+	for _, migration := range migrator.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending
+}
+
+// transaction runs fn in a transaction, which is rolled back on dry runs.
+func (migrator *Migrator) transaction(fn func(tx *gorm.DB) error) error {
+	if !migrator.DryRun {
+		return migrator.db.Transaction(fn)
+	}
+	db := migrator.db.Session(&gorm.Session{
+		Logger: &sqlRecorder{Interface: migrator.db.Logger, output: migrator.Output},
+	})
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return errDryRun
+	})
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+	return err
+}
+
+// sqlRecorder writes the statements changing the database to output.
+type sqlRecorder struct {
+	logger.Interface
+	output io.Writer
+}
+
+func (recorder *sqlRecorder) LogMode(level logger.LogLevel) logger.Interface {
+	return &sqlRecorder{Interface: recorder.Interface.LogMode(level), output: recorder.output}
+}
+
+func (recorder *sqlRecorder) Trace(
+	ctx context.Context, begin time.Time, fc func() (string, int64), err error,
+) {
+	recorder.Interface.Trace(ctx, begin, fc, err)
+	sql, _ := fc()
+	verb, _, _ := strings.Cut(strings.TrimSpace(sql), " ")
+	switch strings.ToUpper(verb) {
+	case "SELECT", "PRAGMA", "SAVEPOINT", "RELEASE":
+		return
+	}
+	fmt.Fprintf(recorder.output, "%s;\n", sql)
+}
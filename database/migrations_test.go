@@ -0,0 +1,130 @@
+package database_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/edgetx/cloudbuild/database"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+var widgetMigrations = []database.Migration{
+	{
+		Version: 1,
+		Name:    "create widgets",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("CREATE TABLE widgets (id integer PRIMARY KEY, name text)").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("DROP TABLE widgets").Error
+		},
+	},
+	{
+		Version: 2,
+		Name:    "rename widget name",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE widgets RENAME COLUMN name TO title").Error
+		},
+	},
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := database.New(database.SQLitePrefix + filepath.Join(t.TempDir(), "test.db"))
+	assert.Nil(t, err)
+	return db
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	db := newTestDB(t)
+	migrator := database.NewMigrator(db, widgetMigrations)
+
+	applied, err := migrator.Up(1)
+	assert.Nil(t, err)
+	assert.Len(t, applied, 1)
+	assert.True(t, db.Migrator().HasColumn("widgets", "name"))
+
+	statuses, err := migrator.Status()
+	assert.Nil(t, err)
+	assert.Len(t, statuses, 2)
+	assert.NotNil(t, statuses[0].AppliedAt)
+	assert.Nil(t, statuses[1].AppliedAt)
+
+	applied, err = migrator.Up(0)
+	assert.Nil(t, err)
+	assert.Len(t, applied, 1)
+	assert.Equal(t, 2, applied[0].Version)
+	assert.True(t, db.Migrator().HasColumn("widgets", "title"))
+	pending, err := migrator.Pending()
+	assert.Nil(t, err)
+	assert.Empty(t, pending)
+
+	_, err = migrator.Down(1)
+	assert.ErrorIs(t, err, database.ErrIrreversibleMigration)
+	assert.True(t, db.Migrator().HasTable("widgets"))
+
+	// an older build still lists the migrations it does not know
+	statuses, err = database.NewMigrator(db, widgetMigrations[:1]).Status()
+	assert.Nil(t, err)
+	assert.Len(t, statuses, 2)
+	assert.True(t, statuses[1].Unknown)
+	reverted, err := database.NewMigrator(db, widgetMigrations[:1]).Down(1)
+	assert.Nil(t, err)
+	assert.Len(t, reverted, 1)
+	assert.False(t, db.Migrator().HasTable("widgets"))
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	db := newTestDB(t)
+	migrator := database.NewMigrator(db, widgetMigrations)
+	var output bytes.Buffer
+	migrator.DryRun = true
+	migrator.Output = &output
+
+	applied, err := migrator.Up(0)
+	assert.Nil(t, err)
+	assert.Len(t, applied, 2)
+	assert.Contains(t, output.String(), "CREATE TABLE widgets (id integer PRIMARY KEY, name text);\n")
+	assert.Contains(t, output.String(), "ALTER TABLE widgets RENAME COLUMN name TO title;\n")
+	assert.NotContains(t, output.String(), "SELECT")
+
+	assert.False(t, db.Migrator().HasTable("widgets"))
+	migrator.DryRun = false
+	pending, err := migrator.Pending()
+	assert.Nil(t, err)
+	assert.Len(t, pending, 2)
+}
+
+func TestMigrateRollsBackFailures(t *testing.T) {
+	db := newTestDB(t)
+	migrations := append([]database.Migration{}, widgetMigrations[0], database.Migration{
+		Version: 2,
+		Name:    "broken",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE missing ADD COLUMN title text").Error
+		},
+	})
+	migrator := database.NewMigrator(db, migrations)
+
+	_, err := migrator.Up(0)
+	assert.NotNil(t, err)
+	assert.False(t, db.Migrator().HasTable("widgets"))
+	pending, err := migrator.Pending()
+	assert.Nil(t, err)
+	assert.Len(t, pending, 2)
+}
+
+func TestBaselineIsIrreversible(t *testing.T) {
+	db := newTestDB(t)
+	// the registered migrations of this package only include the baseline
+	migrator := database.NewMigrator(db, database.Migrations())
+	_, err := migrator.Up(0)
+	assert.Nil(t, err)
+
+	_, err = migrator.Down(1)
+	assert.ErrorIs(t, err, database.ErrIrreversibleMigration)
+	statuses, err := migrator.Status()
+	assert.Nil(t, err)
+	assert.NotNil(t, statuses[0].AppliedAt)
+}
@@ -20,7 +20,7 @@ type Paginable interface {
 	SetTotalRows(int64)
 	GetOffset() int
 	GetLimit() int
-	GetSort() interface{}
+	GetSort(dialect Dialect) interface{}
 }
 
 type Pagination struct {
@@ -49,7 +49,7 @@ func (p *Pagination) GetLimit() int {
 	return p.Limit
 }
 
-func (p *Pagination) GetSort() interface{} {
+func (p *Pagination) GetSort(_ Dialect) interface{} {
 	if p.Sort == "" {
 		return nil
 	}
@@ -64,6 +64,6 @@ func Paginate(value interface{}, p Paginable, db *gorm.DB) func(db *gorm.DB) *go
 	db.Model(value).Count(&rows)
 	p.SetTotalRows(rows)
 	return func(db *gorm.DB) *gorm.DB {
-		return db.Offset(p.GetOffset()).Limit(p.GetLimit()).Order(p.GetSort())
+		return db.Offset(p.GetOffset()).Limit(p.GetLimit()).Order(p.GetSort(DialectOf(db)))
 	}
 }
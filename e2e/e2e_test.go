@@ -0,0 +1,286 @@
+// Package e2e_test runs the API and a worker in-process, with the simulated
+// firmware builder and local sources, against a temporary SQLite database.
+package e2e_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edgetx/cloudbuild/artifactory"
+	"github.com/edgetx/cloudbuild/auth"
+	"github.com/edgetx/cloudbuild/buildlogs"
+	"github.com/edgetx/cloudbuild/config"
+	"github.com/edgetx/cloudbuild/database"
+	"github.com/edgetx/cloudbuild/firmware"
+	"github.com/edgetx/cloudbuild/processor"
+	"github.com/edgetx/cloudbuild/server"
+	"github.com/edgetx/cloudbuild/source"
+	"github.com/edgetx/cloudbuild/targets"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	targetsJSON = `{
+	  "releases": { "v1.2.3": { "sha": "3ca63cbb9bb7fe14c22e0349b668900f125e2d09" }},
+	  "flags": {
+	    "language": {
+	      "build_flag": "TRANSLATIONS",
+	      "values": [ "CZ", "FR" ]
+	    }
+	  },
+	  "targets": {
+	    "mydreamradio": {
+	      "description": "Acme Dream Radio",
+	      "build_flags": { "PCB": "ACME" }
+	    },
+	    "brokenradio": {
+	      "description": "Acme Broken Radio",
+	      "build_flags": { "PCB": "BROKEN" }
+	    }
+	  }
+	}`
+	buildTimeout = 30 * time.Second
+)
+
+var (
+	simulator *firmware.SimulatedBuilder
+	apiURL    string
+	worker    *processor.Worker
+)
+
+// harness starts the API on an HTTP test server and one worker.
+type harness struct {
+	server *httptest.Server
+	worker *processor.Worker
+}
+
+func startHarness(opts *config.CloudbuildOpts) (*harness, error) {
+	if err := database.DropSchema(opts.DatabaseDSN); err != nil {
+		return nil, err
+	}
+	if err := database.Migrate(opts.DatabaseDSN); err != nil {
+		return nil, err
+	}
+
+	// the download URL depends on the server address
+	var router http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.ServeHTTP(w, r)
+	}))
+	opts.DownloadURL = srv.URL + "/api/download"
+
+	art, err := artifactory.NewFromConfig(context.Background(), opts)
+	if err != nil {
+		srv.Close()
+		return nil, err
+	}
+	authenticator, err := auth.NewAuthTokenDBFromConfig(opts)
+	if err != nil {
+		srv.Close()
+		return nil, err
+	}
+	db, err := database.New(opts.DatabaseDSN)
+	if err != nil {
+		srv.Close()
+		return nil, err
+	}
+	workers := processor.NewWorkerDBFromDB(db)
+	router, err = server.New(art, authenticator, workers).Router(opts)
+	if err != nil {
+		srv.Close()
+		return nil, err
+	}
+
+	fixtureDir, err := os.MkdirTemp("", "fixture")
+	if err != nil {
+		srv.Close()
+		return nil, err
+	}
+	err = os.WriteFile(filepath.Join(fixtureDir, "CMakeLists.txt"), []byte("project(edgetx)\n"), 0o600)
+	if err != nil {
+		srv.Close()
+		return nil, err
+	}
+
+	worker := processor.New(art, processor.NewSlots(2, 2, 0))
+	worker.NewDownloader = func(workingDir string, recorder *buildlogs.Recorder) source.Downloader {
+		return source.NewLocalDownloader(fixtureDir, workingDir, recorder)
+	}
+	worker.NewBuilder = func(
+		workingDir string, recorder *buildlogs.Recorder, _ processor.Slot,
+	) firmware.Builder {
+		return simulator.ForDir(workingDir, recorder)
+	}
+	if err := worker.Register(workers); err != nil {
+		srv.Close()
+		return nil, err
+	}
+	worker.Run()
+	return &harness{server: srv, worker: worker}, nil
+}
+
+func (h *harness) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), buildTimeout)
+	defer cancel()
+	_ = h.worker.Stop(ctx)
+	h.server.Close()
+}
+
+func postJSON(t *testing.T, path string, body interface{}, result interface{}) int {
+	t.Helper()
+	data, err := json.Marshal(body)
+	assert.Nil(t, err)
+	res, err := http.Post(apiURL+path, "application/json", bytes.NewReader(data))
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	if result != nil {
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(result))
+	}
+	return res.StatusCode
+}
+
+// waitForJob polls the status of the job built for req until it is finished.
+func waitForJob(t *testing.T, req *artifactory.BuildRequest) *artifactory.BuildJobDto {
+	t.Helper()
+	deadline := time.Now().Add(buildTimeout)
+	for time.Now().Before(deadline) {
+		var job artifactory.BuildJobDto
+		assert.Equal(t, http.StatusOK, postJSON(t, "/api/status", req, &job))
+		if job.Status == artifactory.BuildSuccess || job.Status == artifactory.BuildError {
+			return &job
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("job not finished after %s", buildTimeout)
+	return nil
+}
+
+func download(t *testing.T, url string) []byte {
+	t.Helper()
+	res, err := http.Get(url) //nolint:gosec
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	data, err := io.ReadAll(res.Body)
+	assert.Nil(t, err)
+	return data
+}
+
+func TestSubmitBuildDownload(t *testing.T) {
+	req := artifactory.NewBuildRequestWithParams("v1.2.3", "mydreamradio", []artifactory.OptionFlag{
+		{Name: "language", Value: "FR"},
+	})
+	var created artifactory.BuildJobDto
+	assert.Equal(t, http.StatusCreated, postJSON(t, "/api/jobs", req, &created))
+	assert.Equal(t, artifactory.WaitingForBuild, created.Status)
+
+	job := waitForJob(t, req)
+	assert.Equal(t, artifactory.BuildSuccess, job.Status)
+	assert.NotEmpty(t, job.WorkerID)
+
+	fw, err := findArtifact(job, firmware.FirmwareArtifact)
+	assert.Nil(t, err)
+	expected := firmware.SimulatedFirmware(job.ContainerImage, job.Target, job.CommitRef, job.BuildFlags)
+	assert.Equal(t, expected, download(t, fw.DownloadURL))
+
+	// the same request is served without building again
+	builds := simulator.Builds()
+	assert.Equal(t, http.StatusCreated, postJSON(t, "/api/jobs", req, &created))
+	assert.Equal(t, artifactory.BuildSuccess, created.Status)
+	assert.Equal(t, builds, simulator.Builds())
+}
+
+func TestBuildFailure(t *testing.T) {
+	simulator.FailTargets["brokenradio"] = errors.New("simulated compiler error")
+	req := artifactory.NewBuildRequestWithParams("v1.2.3", "brokenradio", nil)
+	assert.Equal(t, http.StatusCreated, postJSON(t, "/api/jobs", req, nil))
+
+	job := waitForJob(t, req)
+	assert.Equal(t, artifactory.BuildError, job.Status)
+	assert.Equal(t, artifactory.UnknownError, job.ErrorType)
+	assert.Equal(t, "failed to build: simulated compiler error", job.ErrorExcerpt)
+	assert.Empty(t, job.Artifacts)
+}
+
+func TestDrainingWorkerResumed(t *testing.T) {
+	defer worker.SetState(processor.WorkerActive)
+	// let the slots see the draining state before resuming the worker
+	worker.SetState(processor.WorkerDraining)
+	time.Sleep(2 * time.Second)
+	worker.SetState(processor.WorkerActive)
+
+	req := artifactory.NewBuildRequestWithParams("v1.2.3", "mydreamradio", []artifactory.OptionFlag{
+		{Name: "language", Value: "CZ"},
+	})
+	assert.Equal(t, http.StatusCreated, postJSON(t, "/api/jobs", req, nil))
+	job := waitForJob(t, req)
+	assert.Equal(t, artifactory.BuildSuccess, job.Status)
+
+	worker.SetState(processor.WorkerDraining)
+	select {
+	case <-worker.Drained():
+	case <-time.After(buildTimeout):
+		t.Fatal("worker not drained")
+	}
+}
+
+func findArtifact(job *artifactory.BuildJobDto, slug string) (*artifactory.ArtifactDto, error) {
+	for i := range job.Artifacts {
+		if job.Artifacts[i].Slug == slug {
+			return &job.Artifacts[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no %s artifact", slug)
+}
+
+func TestMain(m *testing.M) {
+	log.SetOutput(os.Stdout)
+	gin.SetMode(gin.TestMode)
+	defs, err := targets.ReadTargetsDefFromBytes([]byte(targetsJSON), "")
+	if err != nil {
+		panic(err)
+	}
+	targets.SetTargets(defs)
+
+	v := viper.New()
+	v.Set("config-path", "./../test_config.yaml")
+	config.InitConfig(v)()
+	opts := config.NewOpts(v)
+	if err := opts.Unmarshal(); err != nil {
+		fmt.Println("failed to unmarshal config:", err)
+		os.Exit(1)
+	}
+	storageDir, err := os.MkdirTemp("", "artifacts")
+	if err != nil {
+		panic(err)
+	}
+	opts.StoragePath = storageDir
+	opts.DatabaseDSN = database.SQLitePrefix + filepath.Join(storageDir, "cloudbuild.db")
+
+	simulator = firmware.NewSimulatedBuilder(100 * time.Millisecond)
+	h, err := startHarness(opts)
+	if err != nil {
+		fmt.Println("failed to start test harness:", err)
+		os.Exit(1)
+	}
+	apiURL = h.server.URL
+	worker = h.worker
+
+	code := m.Run()
+	h.stop()
+	os.RemoveAll(storageDir)
+	os.Exit(code)
+}
@@ -0,0 +1,106 @@
+package firmware
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrArtifactNotFound = errors.New("cannot find build artifact")
+)
+
+const (
+	FirmwareArtifact = "firmware"
+)
+
+// ArtifactRule selects the build output stored under a given slug.
+// The first file matching one of the glob patterns (relative to the
+// source directory) is used.
+type ArtifactRule struct {
+	Slug     string   `json:"slug"`
+	Patterns []string `json:"patterns"`
+	Optional bool     `json:"optional,omitempty"`
+}
+
+// Artifact is a named file produced by a build. It is only
+// available until the build working directory is removed.
+type Artifact struct {
+	Slug     string
+	Filename string
+	Path     string
+	Size     int64
+}
+
+func (artifact *Artifact) Open() (*os.File, error) {
+	return os.Open(artifact.Path)
+}
+
+func (artifact *Artifact) ContentType() string {
+	if contentType := mime.TypeByExtension(filepath.Ext(artifact.Filename)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// DefaultArtifactRules is used when no rules are specified.
+var DefaultArtifactRules = []ArtifactRule{
+	{Slug: FirmwareArtifact, Patterns: []string{"*.uf2", "*.bin"}},
+}
+
+func FindArtifact(artifacts []Artifact, slug string) (*Artifact, error) {
+	for i := range artifacts {
+		if artifacts[i].Slug == slug {
+			return &artifacts[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrArtifactNotFound, slug)
+}
+
+func matchBuildArtefacts(workingDir string, patterns ...string) ([]string, error) {
+	var matches []string
+
+	for _, pattern := range patterns {
+		found, err := filepath.Glob(filepath.Join(workingDir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("error with pattern %s: %w", pattern, err)
+		}
+		matches = append(matches, found...)
+	}
+	return matches, nil
+}
+
+// collectArtifacts finds the artifacts of a build in workingDir.
+func collectArtifacts(workingDir string, rules []ArtifactRule) ([]Artifact, error) {
+	if len(rules) == 0 {
+		rules = DefaultArtifactRules
+	}
+
+	artifacts := make([]Artifact, 0, len(rules))
+	for _, rule := range rules {
+		paths, err := matchBuildArtefacts(workingDir, rule.Patterns...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s artifact pattern: %w", rule.Slug, err)
+		}
+		if len(paths) == 0 {
+			if rule.Optional {
+				continue
+			}
+			return nil, fmt.Errorf("%w: %s", ErrArtifactNotFound, rule.Slug)
+		}
+
+		info, err := os.Stat(paths[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s artifact: %w", rule.Slug, err)
+		}
+		artifacts = append(artifacts, Artifact{
+			Slug:     rule.Slug,
+			Filename: filepath.Base(paths[0]),
+			Path:     paths[0],
+			Size:     info.Size(),
+		})
+	}
+	return artifacts, nil
+}
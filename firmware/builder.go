@@ -2,9 +2,20 @@ package firmware
 
 import (
 	"context"
+	"errors"
 )
 
+// ErrImagePull is returned when the build container image cannot be pulled.
+var ErrImagePull = errors.New("failed to pull container image")
+
 type Builder interface {
 	PullImage(ctx context.Context, buildContainer string) error
-	Build(ctx context.Context, buildContainer string, target string, versionTag string, flags []BuildFlag) ([]byte, error)
+	Build(
+		ctx context.Context,
+		buildContainer string,
+		target string,
+		versionTag string,
+		flags []BuildFlag,
+		rules []ArtifactRule,
+	) ([]Artifact, error)
 }
@@ -0,0 +1,186 @@
+package firmware
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// ccacheContainerDir is where the compiler cache is mounted in the build container.
+	ccacheContainerDir = "/home/rootless/ccache"
+	// ccacheStatsLog records the result of each compilation of a build,
+	// relative to the source directory.
+	ccacheStatsLog = ".ccache-stats.log"
+)
+
+var metricCompilerCache = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "build_ccache_results_total",
+		Help: "Compilations by compiler cache result (hit or miss).",
+	},
+	[]string{"target", "result"},
+)
+
+// RegisterCompilerCacheMetrics registers the compiler cache metrics of the builds.
+func RegisterCompilerCacheMetrics(r prometheus.Registerer) {
+	r.MustRegister(metricCompilerCache)
+}
+
+var unsafeCacheChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// CompilerCache keeps a ccache directory per build container image and target,
+// as the object files of other images or targets cannot be reused.
+type CompilerCache struct {
+	Dir string
+	// MaxSizeMB caps the size of each cache, ccache's default applies when 0.
+	MaxSizeMB int
+}
+
+func NewCompilerCache(dir string, maxSizeMB int) (*CompilerCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create compiler cache directory: %w", err)
+	}
+	return &CompilerCache{Dir: dir, MaxSizeMB: maxSizeMB}, nil
+}
+
+// Path returns the cache directory of the builds of target with buildContainer.
+func (cache *CompilerCache) Path(buildContainer, target string) string {
+	name := unsafeCacheChars.ReplaceAllString(buildContainer+"-"+target, "_")
+	return filepath.Join(cache.Dir, name)
+}
+
+// prepare creates the cache directory if needed, and marks it as used.
+func (cache *CompilerCache) prepare(buildContainer, target string) (string, error) {
+	dir := cache.Path(buildContainer, target)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create compiler cache: %w", err)
+	}
+	now := time.Now()
+	if err := os.Chtimes(dir, now, now); err != nil {
+		return "", fmt.Errorf("failed to touch compiler cache: %w", err)
+	}
+	return dir, nil
+}
+
+// env returns the variables making the build use ccache.
+func (cache *CompilerCache) env() []string {
+	env := []string{
+		"CCACHE_DIR=" + ccacheContainerDir,
+		"CCACHE_BASEDIR=/home/rootless/src",
+		"CCACHE_COMPILERCHECK=content",
+		"CCACHE_STATSLOG=/home/rootless/src/" + ccacheStatsLog,
+		"CMAKE_C_COMPILER_LAUNCHER=ccache",
+		"CMAKE_CXX_COMPILER_LAUNCHER=ccache",
+	}
+	if cache.MaxSizeMB > 0 {
+		env = append(env, fmt.Sprintf("CCACHE_MAXSIZE=%dM", cache.MaxSizeMB))
+	}
+	return env
+}
+
+// CacheStats counts the compilations of a build served from the cache.
+type CacheStats struct {
+	Hits   int
+	Misses int
+}
+
+// readCacheStats parses the ccache stats log of a build.
+func readCacheStats(path string) (CacheStats, error) {
+	var stats CacheStats
+	file, err := os.Open(path)
+	if err != nil {
+		return stats, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#"):
+		case strings.HasSuffix(line, "cache_hit"):
+			stats.Hits++
+		case line == "cache_miss":
+			stats.Misses++
+		}
+	}
+	return stats, scanner.Err()
+}
+
+type cacheUsage struct {
+	path    string
+	size    int64
+	lastUse time.Time
+}
+
+// EvictCompilerCaches removes the least recently used caches in dir
+// until they use at most totalSizeMB, and returns the removed caches.
+// Nothing is removed when totalSizeMB is 0.
+func EvictCompilerCaches(dir string, totalSizeMB int) ([]string, error) {
+	removed := make([]string, 0)
+	if totalSizeMB <= 0 {
+		return removed, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var caches []cacheUsage
+	var total int64
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, entry.Name())
+		size, err := dirSize(path)
+		if err != nil {
+			return nil, err
+		}
+		caches = append(caches, cacheUsage{path: path, size: size, lastUse: info.ModTime()})
+		total += size
+	}
+	sort.Slice(caches, func(i, j int) bool {
+		return caches[i].lastUse.Before(caches[j].lastUse)
+	})
+
+	limit := int64(totalSizeMB) * 1024 * 1024
+	for _, cache := range caches {
+		if total <= limit {
+			break
+		}
+		if err := os.RemoveAll(cache.path); err != nil {
+			return removed, err
+		}
+		total -= cache.size
+		removed = append(removed, cache.path)
+	}
+	return removed, nil
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
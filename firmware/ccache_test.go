@@ -0,0 +1,39 @@
+package firmware_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edgetx/cloudbuild/firmware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvictCompilerCaches(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, name := range []string{"oldest", "older", "recent"} {
+		cache := filepath.Join(dir, name)
+		assert.Nil(t, os.MkdirAll(cache, 0o755))
+		data := make([]byte, 1024*1024)
+		assert.Nil(t, os.WriteFile(filepath.Join(cache, "obj"), data, 0o600))
+		lastUse := now.Add(time.Duration(i-3) * time.Hour)
+		assert.Nil(t, os.Chtimes(cache, lastUse, lastUse))
+	}
+
+	// no total size cap
+	removed, err := firmware.EvictCompilerCaches(dir, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, removed)
+	assert.DirExists(t, filepath.Join(dir, "oldest"))
+
+	removed, err = firmware.EvictCompilerCaches(dir, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "oldest"), filepath.Join(dir, "older")}, removed)
+	assert.DirExists(t, filepath.Join(dir, "recent"))
+
+	removed, err = firmware.EvictCompilerCaches(dir, 1)
+	assert.Nil(t, err)
+	assert.Empty(t, removed)
+}
@@ -0,0 +1,221 @@
+package firmware
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/edgetx/cloudbuild/buildlogs"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// containerRemoveTimeout bounds the cleanup of a cancelled build container.
+const containerRemoveTimeout = 30 * time.Second
+
+type ContainerExecutor func(ctx context.Context, args ...string) (string, error)
+
+// DefaultContainerExecutor runs the container runtime and copies its output
+// to stdOutput while the command is running.
+func DefaultContainerExecutor(
+	runtime ContainerRuntime, workingDir string, stdOutput io.Writer,
+) ContainerExecutor {
+	return func(ctx context.Context, args ...string) (string, error) {
+		log.Debugf("%s cmd: %s", runtime.Command(), args)
+		var output bytes.Buffer
+		cmd := exec.CommandContext(ctx, runtime.Command(), args...)
+		cmd.Dir = workingDir
+		cmd.Stdout = io.MultiWriter(&output, stdOutput)
+		cmd.Stderr = cmd.Stdout
+		err := cmd.Run()
+		return output.String(), err
+	}
+}
+
+// ContainerBuilder builds the firmware in a container of the build image.
+type ContainerBuilder struct {
+	workingDir  string
+	Runtime     ContainerRuntime
+	Executor    ContainerExecutor
+	CPULimit    int // logical cores
+	MemoryLimit int // bytes, 0 means no limit
+	// Cache is mounted in the build container when set.
+	Cache    *CompilerCache
+	recorder *buildlogs.Recorder
+}
+
+func NewContainerBuilder(
+	runtime ContainerRuntime,
+	workingDir string,
+	recorder *buildlogs.Recorder,
+	cpuLimit int,
+	memoryLimit int,
+) *ContainerBuilder {
+	return &ContainerBuilder{
+		workingDir:  workingDir,
+		Runtime:     runtime,
+		Executor:    DefaultContainerExecutor(runtime, workingDir, recorder),
+		CPULimit:    cpuLimit,
+		MemoryLimit: memoryLimit,
+		recorder:    recorder,
+	}
+}
+
+func (builder *ContainerBuilder) PullImage(ctx context.Context, buildContainer string) error {
+	output, err := builder.Executor(ctx, "pull", "--quiet", buildContainer)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrImagePull, err)
+	}
+	log.Debugf("pulled container image: %s", output)
+	return nil
+}
+
+// ListImages returns the container images available locally.
+func (builder *ContainerBuilder) ListImages(ctx context.Context) ([]string, error) {
+	output, err := builder.Executor(ctx, builder.Runtime.listImagesArgs()...)
+	if err != nil {
+		return nil, errors.Errorf("failed to list container images: %s", err)
+	}
+	images := make([]string, 0)
+	for _, image := range strings.Fields(output) {
+		if !strings.Contains(image, "<none>") {
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+func (builder *ContainerBuilder) buildCmdArgs(
+	containerName string,
+	buildContainer string,
+	target string,
+	versionTag string,
+	flags []BuildFlag,
+	cacheDir string,
+) []string {
+	args := []string{
+		"run",
+		"--tty",
+		"--rm",
+		"--name", containerName,
+	}
+	args = append(args, builder.Runtime.userArgs()...)
+	args = append(args, fmt.Sprintf("--cpus=%d", builder.CPULimit))
+	if builder.MemoryLimit > 0 {
+		args = append(args, fmt.Sprintf("--memory=%d", builder.MemoryLimit))
+	}
+	args = append(args,
+		"--volume",
+		builder.Runtime.volume(builder.workingDir, "/home/rootless/src"),
+	)
+	if cacheDir != "" {
+		args = append(args,
+			"--volume",
+			builder.Runtime.sharedVolume(cacheDir, ccacheContainerDir),
+		)
+	}
+
+	env := []string{
+		fmt.Sprintf("FLAVOR=%s", target),
+		fmt.Sprintf("EXTRA_OPTIONS=%s", CmakeFlags(flags)),
+		fmt.Sprintf("MAX_JOBS=%d", builder.CPULimit),
+		fmt.Sprintf("CMAKE_BUILD_PARALLEL_LEVEL=%d", builder.CPULimit),
+	}
+	if versionTag == "nightly" {
+		env = append(env, "EDGETX_VERSION_SUFFIX=nightly")
+	} else {
+		env = append(
+			env,
+			"EDGETX_VERSION_SUFFIX=cloudbuild",
+			fmt.Sprintf("EDGETX_VERSION_TAG=%s", versionTag),
+		)
+	}
+	if cacheDir != "" {
+		env = append(env, builder.Cache.env()...)
+	}
+	for _, varDef := range env {
+		args = append(args, "--env", varDef)
+	}
+
+	return append(args, buildContainer, "./tools/build-gh.sh")
+}
+
+func (builder *ContainerBuilder) Build(
+	ctx context.Context,
+	buildContainer string,
+	target string,
+	versionTag string,
+	flags []BuildFlag,
+	rules []ArtifactRule,
+) ([]Artifact, error) {
+	if err := builder.PullImage(ctx, buildContainer); err != nil {
+		return nil, err
+	}
+
+	containerName, err := newContainerName()
+	if err != nil {
+		return nil, err
+	}
+	cacheDir := ""
+	if builder.Cache != nil {
+		cacheDir, err = builder.Cache.prepare(buildContainer, target)
+		if err != nil {
+			return nil, err
+		}
+	}
+	args := builder.buildCmdArgs(containerName, buildContainer, target, versionTag, flags, cacheDir)
+	output, err := builder.Executor(ctx, args...)
+	log.Debugf("container build output: %s", output)
+	if cacheDir != "" {
+		builder.recordCacheStats(target)
+	}
+	if ctx.Err() != nil {
+		// killing the "run" command leaves the container running
+		builder.removeContainer(containerName)
+		return nil, fmt.Errorf("build interrupted: %w", context.Cause(ctx))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to build: %w", err)
+	}
+
+	return collectArtifacts(builder.workingDir, rules)
+}
+
+// recordCacheStats adds the compiler cache hits and misses of the build
+// to its logs and metrics.
+func (builder *ContainerBuilder) recordCacheStats(target string) {
+	stats, err := readCacheStats(filepath.Join(builder.workingDir, ccacheStatsLog))
+	if err != nil {
+		log.Debugf("no compiler cache stats: %s", err)
+		return
+	}
+	builder.recorder.AddStdOut(fmt.Sprintf(
+		"ccache: %d hits, %d misses\n", stats.Hits, stats.Misses,
+	))
+	metricCompilerCache.WithLabelValues(target, "hit").Add(float64(stats.Hits))
+	metricCompilerCache.WithLabelValues(target, "miss").Add(float64(stats.Misses))
+}
+
+func newContainerName() (string, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to generate container name: %w", err)
+	}
+	return "cloudbuild-" + hex.EncodeToString(suffix), nil
+}
+
+func (builder *ContainerBuilder) removeContainer(containerName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), containerRemoveTimeout)
+	defer cancel()
+	_, err := builder.Executor(ctx, builder.Runtime.removeArgs(containerName)...)
+	if err != nil {
+		log.Errorf("failed to remove container %s: %s", containerName, err)
+	}
+}
@@ -0,0 +1,233 @@
+package firmware_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/edgetx/cloudbuild/buildlogs"
+	firmware "github.com/edgetx/cloudbuild/firmware"
+	"github.com/edgetx/cloudbuild/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirmwareFirmwareBuild(t *testing.T) {
+	t.Skip()
+	sourceDir, err := os.MkdirTemp("/tmp", "source")
+	assert.Nil(t, err, "failed to create source dir")
+	defer os.RemoveAll(sourceDir)
+
+	t.Log("will start firmware download")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+	defer cancel()
+	repository := "https://github.com/EdgeTX/edgetx.git"
+	recorder := buildlogs.NewRecorder()
+	firmwareDownloader := source.NewGitDownloader(sourceDir, recorder)
+	err = firmwareDownloader.Download(ctx, repository, "8620fe19289c36b574ab68008145a530d589f0fd")
+	assert.Nil(t, err, "failed to download firmware")
+	t.Log("will start firmware build")
+
+	firmwareBuilder := firmware.NewContainerBuilder(
+		firmware.RuntimePodman, sourceDir, recorder, runtime.NumCPU(), 1024*1024*1024,
+	)
+	flags := []firmware.BuildFlag{
+		firmware.NewFlag("DISABLE_COMPANION", "YES"),
+		firmware.NewFlag("CMAKE_BUILD_TYPE", "Release"),
+		firmware.NewFlag("TRACE_SIMPGMSPACE", "NO"),
+		firmware.NewFlag("VERBOSE_CMAKELISTS", "YES"),
+		firmware.NewFlag("CMAKE_RULE_MESSAGES", "OFF"),
+		firmware.NewFlag("INTERNAL_MODULE_MULTI", "ON"),
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute*20)
+	defer cancel()
+	artifacts, err := firmwareBuilder.Build(
+		ctx,
+		"ghcr.io/edgetx/edgetx-builder",
+		"t16",
+		"test",
+		flags,
+		firmware.DefaultArtifactRules,
+	)
+	assert.Nil(t, err, "failed to build firmware")
+	firmwareBin, err := firmware.FindArtifact(artifacts, firmware.FirmwareArtifact)
+	assert.Nil(t, err, "missing firmware artifact")
+	assert.True(t, firmwareBin.Size > 0, "firmware bin is empty")
+}
+
+func newFakeBuilder(t *testing.T) (*firmware.ContainerBuilder, string) {
+	t.Helper()
+	sourceDir := t.TempDir()
+	builder := firmware.NewContainerBuilder(firmware.RuntimePodman, sourceDir, buildlogs.NewRecorder(), 1, 0)
+	builder.Executor = func(ctx context.Context, args ...string) (string, error) {
+		return "", nil
+	}
+	return builder, sourceDir
+}
+
+func TestBuildCollectsNamedArtifacts(t *testing.T) {
+	builder, sourceDir := newFakeBuilder(t)
+	assert.Nil(t, os.WriteFile(filepath.Join(sourceDir, "fw.uf2"), []byte("uf2"), 0o600))
+	assert.Nil(t, os.MkdirAll(filepath.Join(sourceDir, "build"), 0o700))
+	assert.Nil(t, os.WriteFile(filepath.Join(sourceDir, "build", "fw.elf"), []byte("elf"), 0o600))
+
+	rules := []firmware.ArtifactRule{
+		{Slug: "firmware", Patterns: []string{"*.uf2", "*.bin"}},
+		{Slug: "elf", Patterns: []string{"build/*.elf"}},
+		{Slug: "map", Patterns: []string{"build/*.map"}, Optional: true},
+	}
+	artifacts, err := builder.Build(context.Background(), "img", "t16", "nightly", nil, rules)
+	assert.Nil(t, err)
+	assert.Equal(t, []firmware.Artifact{
+		{Slug: "firmware", Filename: "fw.uf2", Path: filepath.Join(sourceDir, "fw.uf2"), Size: 3},
+		{Slug: "elf", Filename: "fw.elf", Path: filepath.Join(sourceDir, "build", "fw.elf"), Size: 3},
+	}, artifacts)
+}
+
+func TestBuildFailsWhenArtifactIsMissing(t *testing.T) {
+	builder, _ := newFakeBuilder(t)
+	_, err := builder.Build(context.Background(), "img", "t16", "nightly", nil, nil)
+	assert.ErrorIs(t, err, firmware.ErrArtifactNotFound)
+}
+
+func TestCancelledBuildRemovesContainer(t *testing.T) {
+	builder, _ := newFakeBuilder(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls [][]string
+	builder.Executor = func(execCtx context.Context, args ...string) (string, error) {
+		calls = append(calls, args)
+		if args[0] == "run" {
+			cancel()
+			return "", context.Canceled
+		}
+		return "", nil
+	}
+
+	_, err := builder.Build(ctx, "img", "t16", "nightly", nil, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, calls, 3) // pull, run, rm
+	assert.Equal(t, "rm", calls[2][0])
+	assert.Equal(t, calls[1][4], calls[2][len(calls[2])-1])
+}
+
+func TestBuildPassesResourceLimits(t *testing.T) {
+	builder, sourceDir := newFakeBuilder(t)
+	builder.CPULimit = 4
+	builder.MemoryLimit = 2 * 1024 * 1024 * 1024
+	assert.Nil(t, os.WriteFile(filepath.Join(sourceDir, "fw.bin"), []byte("bin"), 0o600))
+	var runArgs []string
+	builder.Executor = func(ctx context.Context, args ...string) (string, error) {
+		if args[0] == "run" {
+			runArgs = args
+		}
+		return "", nil
+	}
+
+	_, err := builder.Build(context.Background(), "img", "t16", "nightly", nil, nil)
+	assert.Nil(t, err)
+	assert.Contains(t, runArgs, "--cpus=4")
+	assert.Contains(t, runArgs, "--memory=2147483648")
+}
+
+func TestListImages(t *testing.T) {
+	builder, _ := newFakeBuilder(t)
+	builder.Executor = func(ctx context.Context, args ...string) (string, error) {
+		assert.Equal(t, "images", args[0])
+		return "ghcr.io/edgetx/edgetx-builder:2.10\n<none>:<none>\nghcr.io/edgetx/edgetx-builder:latest\n", nil
+	}
+
+	images, err := builder.ListImages(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"ghcr.io/edgetx/edgetx-builder:2.10",
+		"ghcr.io/edgetx/edgetx-builder:latest",
+	}, images)
+}
+
+func TestBuildUsesCompilerCache(t *testing.T) {
+	sourceDir := t.TempDir()
+	recorder := buildlogs.NewRecorder()
+	builder := firmware.NewContainerBuilder(firmware.RuntimePodman, sourceDir, recorder, 1, 0)
+	cache, err := firmware.NewCompilerCache(t.TempDir(), 1024)
+	assert.Nil(t, err)
+	builder.Cache = cache
+	builder.Executor = func(ctx context.Context, args ...string) (string, error) {
+		if args[0] != "run" {
+			return "", nil
+		}
+		assert.Contains(t, args, sourceDir+":/home/rootless/src:Z")
+		assert.Contains(t, args, cache.Path("img", "t16")+":/home/rootless/ccache:z")
+		assert.Contains(t, args, "CCACHE_MAXSIZE=1024M")
+		assert.Contains(t, args, "CMAKE_CXX_COMPILER_LAUNCHER=ccache")
+		stats := "# main.cpp\ndirect_cache_hit\n# gui.cpp\ncache_miss\n# lcd.cpp\npreprocessed_cache_hit\n"
+		assert.Nil(t, os.WriteFile(filepath.Join(sourceDir, ".ccache-stats.log"), []byte(stats), 0o600))
+		return "", os.WriteFile(filepath.Join(sourceDir, "fw.bin"), []byte("bin"), 0o600)
+	}
+
+	_, err = builder.Build(context.Background(), "img", "t16", "nightly", nil, nil)
+	assert.Nil(t, err)
+	assert.DirExists(t, cache.Path("img", "t16"))
+	assert.Contains(t, recorder.Logs(), "ccache: 2 hits, 1 misses")
+}
+
+func TestBuildTranslatesRuntimeOptions(t *testing.T) {
+	user := fmt.Sprintf("--user=%d:%d", os.Getuid(), os.Getgid())
+	tests := []struct {
+		runtime firmware.ContainerRuntime
+		user    string
+		volume  string
+		remove  []string
+	}{
+		{firmware.RuntimePodman, "--userns=keep-id", ":/home/rootless/src:Z", []string{"--ignore", "--time"}},
+		{firmware.RuntimeDocker, user, ":/home/rootless/src:Z", nil},
+		{firmware.RuntimeNerdctl, user, ":/home/rootless/src", nil},
+	}
+	for _, test := range tests {
+		t.Run(string(test.runtime), func(t *testing.T) {
+			builder, sourceDir := newFakeBuilder(t)
+			builder.Runtime = test.runtime
+			builder.CPULimit = 2
+			builder.MemoryLimit = 1024
+			ctx, cancel := context.WithCancel(context.Background())
+			var calls [][]string
+			builder.Executor = func(execCtx context.Context, args ...string) (string, error) {
+				calls = append(calls, args)
+				if args[0] == "run" {
+					cancel()
+				}
+				return "", nil
+			}
+
+			_, err := builder.Build(ctx, "img", "t16", "nightly", nil, nil)
+			assert.ErrorIs(t, err, context.Canceled)
+			run, rm := calls[1], calls[2]
+			assert.Contains(t, run, test.user)
+			assert.Contains(t, run, sourceDir+test.volume)
+			assert.Contains(t, run, "--cpus=2")
+			assert.Contains(t, run, "--memory=1024")
+			assert.Equal(t, "rm", rm[0])
+			for _, option := range test.remove {
+				assert.Contains(t, rm, option)
+			}
+			if test.remove == nil {
+				assert.Equal(t, []string{"rm", "--force", run[4]}, rm)
+			}
+		})
+	}
+}
+
+func TestParseContainerRuntime(t *testing.T) {
+	runtime, err := firmware.ParseContainerRuntime("docker")
+	assert.Nil(t, err)
+	assert.Equal(t, firmware.RuntimeDocker, runtime)
+
+	runtime, err = firmware.ParseContainerRuntime("")
+	assert.Nil(t, err)
+	assert.Equal(t, firmware.RuntimePodman, runtime)
+
+	_, err = firmware.ParseContainerRuntime("lxc")
+	assert.ErrorIs(t, err, firmware.ErrUnknownRuntime)
+}
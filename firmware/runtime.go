@@ -0,0 +1,87 @@
+package firmware
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+var ErrUnknownRuntime = errors.New("unknown container runtime")
+
+// ContainerRuntime is the CLI running the build containers.
+type ContainerRuntime string
+
+const (
+	RuntimePodman  ContainerRuntime = "podman"
+	RuntimeDocker  ContainerRuntime = "docker"
+	RuntimeNerdctl ContainerRuntime = "nerdctl"
+)
+
+func ParseContainerRuntime(name string) (ContainerRuntime, error) {
+	switch runtime := ContainerRuntime(name); runtime {
+	case RuntimePodman, RuntimeDocker, RuntimeNerdctl:
+		return runtime, nil
+	case "":
+		return RuntimePodman, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownRuntime, name)
+	}
+}
+
+// Command returns the executable of the runtime.
+func (runtime ContainerRuntime) Command() string {
+	if runtime.isPodman() {
+		return string(RuntimePodman)
+	}
+	return string(runtime)
+}
+
+func (runtime ContainerRuntime) isPodman() bool {
+	return runtime == RuntimePodman || runtime == ""
+}
+
+// userArgs run the build as the user owning the mounted sources.
+func (runtime ContainerRuntime) userArgs() []string {
+	if runtime.isPodman() {
+		return []string{"--userns=keep-id"}
+	}
+	return []string{fmt.Sprintf("--user=%d:%d", os.Getuid(), os.Getgid())}
+}
+
+// volume returns the option mounting hostDir, private to the container,
+// at containerDir. Podman and docker relabel the volume for SELinux,
+// nerdctl does not support the label.
+func (runtime ContainerRuntime) volume(hostDir, containerDir string) string {
+	return runtime.labeledVolume(hostDir, containerDir, "Z")
+}
+
+// sharedVolume returns the option mounting hostDir at containerDir, with
+// a label shared by the containers using hostDir at the same time.
+func (runtime ContainerRuntime) sharedVolume(hostDir, containerDir string) string {
+	return runtime.labeledVolume(hostDir, containerDir, "z")
+}
+
+func (runtime ContainerRuntime) labeledVolume(hostDir, containerDir, label string) string {
+	if runtime == RuntimeNerdctl {
+		return fmt.Sprintf("%s:%s", hostDir, containerDir)
+	}
+	return fmt.Sprintf("%s:%s:%s", hostDir, containerDir, label)
+}
+
+// listImagesArgs list the local images as repository:tag, one per line.
+func (runtime ContainerRuntime) listImagesArgs() []string {
+	args := []string{"images"}
+	if runtime.isPodman() {
+		// docker and nerdctl print no header with a custom format
+		args = append(args, "--noheading")
+	}
+	return append(args, "--format", "{{.Repository}}:{{.Tag}}")
+}
+
+// removeArgs force the removal of a container that may not exist anymore.
+func (runtime ContainerRuntime) removeArgs(containerName string) []string {
+	if runtime.isPodman() {
+		return []string{"rm", "--force", "--ignore", "--time", "0", containerName}
+	}
+	return []string{"rm", "--force", containerName}
+}
@@ -0,0 +1,135 @@
+package firmware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/edgetx/cloudbuild/buildlogs"
+)
+
+// simulatedFirmwareSize is the size of the fake firmware images.
+const simulatedFirmwareSize = 4096
+
+// SimulatedBuilder produces fake firmware without running any container,
+// for tests and local development. It is shared by the builds, which get
+// their own Builder from ForDir.
+type SimulatedBuilder struct {
+	// Delay is the duration of every build.
+	Delay time.Duration
+	// FailTargets lists the targets whose builds always fail.
+	FailTargets map[string]error
+
+	mu       sync.Mutex
+	failures []error
+	builds   int
+}
+
+func NewSimulatedBuilder(delay time.Duration) *SimulatedBuilder {
+	return &SimulatedBuilder{
+		Delay:       delay,
+		FailTargets: make(map[string]error),
+	}
+}
+
+// FailNext scripts the outcome of the next builds, in order.
+// A nil error lets the build succeed.
+func (simulator *SimulatedBuilder) FailNext(errs ...error) {
+	simulator.mu.Lock()
+	defer simulator.mu.Unlock()
+	simulator.failures = append(simulator.failures, errs...)
+}
+
+// Builds returns the number of builds started.
+func (simulator *SimulatedBuilder) Builds() int {
+	simulator.mu.Lock()
+	defer simulator.mu.Unlock()
+	return simulator.builds
+}
+
+// nextFailure counts a new build of target and returns its scripted failure.
+func (simulator *SimulatedBuilder) nextFailure(target string) error {
+	simulator.mu.Lock()
+	defer simulator.mu.Unlock()
+	simulator.builds++
+	if err, ok := simulator.FailTargets[target]; ok {
+		return err
+	}
+	if len(simulator.failures) == 0 {
+		return nil
+	}
+	err := simulator.failures[0]
+	simulator.failures = simulator.failures[1:]
+	return err
+}
+
+// ForDir returns the builder of a build whose sources are in workingDir.
+func (simulator *SimulatedBuilder) ForDir(workingDir string, recorder *buildlogs.Recorder) Builder {
+	return &simulatedBuild{
+		simulator:  simulator,
+		workingDir: workingDir,
+		recorder:   recorder,
+	}
+}
+
+type simulatedBuild struct {
+	simulator  *SimulatedBuilder
+	workingDir string
+	recorder   *buildlogs.Recorder
+}
+
+func (build *simulatedBuild) PullImage(ctx context.Context, buildContainer string) error {
+	build.recorder.AddStdOut(fmt.Sprintf("simulated pull of %s\n", buildContainer))
+	return nil
+}
+
+func (build *simulatedBuild) Build(
+	ctx context.Context,
+	buildContainer string,
+	target string,
+	versionTag string,
+	flags []BuildFlag,
+	rules []ArtifactRule,
+) ([]Artifact, error) {
+	build.recorder.AddStdOut(fmt.Sprintf(
+		"simulated build of %s %s with %s\n", target, versionTag, CmakeFlags(flags),
+	))
+	timer := time.NewTimer(build.simulator.Delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("build interrupted: %w", context.Cause(ctx))
+	case <-timer.C:
+	}
+	if err := build.simulator.nextFailure(target); err != nil {
+		return nil, fmt.Errorf("failed to build: %w", err)
+	}
+
+	data := SimulatedFirmware(buildContainer, target, versionTag, flags)
+	path := filepath.Join(build.workingDir, fmt.Sprintf("%s-%s.bin", target, versionTag))
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write firmware: %w", err)
+	}
+	return collectArtifacts(build.workingDir, rules)
+}
+
+// SimulatedFirmware returns the fake firmware built by SimulatedBuilder,
+// which only depends on the build parameters.
+func SimulatedFirmware(
+	buildContainer string, target string, versionTag string, flags []BuildFlag,
+) []byte {
+	header := fmt.Sprintf(
+		"simulated firmware %s %s %s %s\n", buildContainer, target, versionTag, CmakeFlags(flags),
+	)
+	sum := sha256.Sum256([]byte(header))
+	data := bytes.NewBufferString(header)
+	for data.Len() < simulatedFirmwareSize {
+		data.Write(sum[:])
+	}
+	return data.Bytes()[:simulatedFirmwareSize]
+}
@@ -0,0 +1,62 @@
+package firmware_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/edgetx/cloudbuild/buildlogs"
+	"github.com/edgetx/cloudbuild/firmware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatedBuilder(t *testing.T) {
+	simulator := firmware.NewSimulatedBuilder(0)
+	simulator.FailNext(errors.New("scripted"), nil)
+	flags := []firmware.BuildFlag{firmware.NewFlag("TRANSLATIONS", "FR")}
+	build := func() ([]firmware.Artifact, error) {
+		builder := simulator.ForDir(t.TempDir(), buildlogs.NewRecorder())
+		return builder.Build(context.Background(), "img", "t16", "v2.10.0", flags, nil)
+	}
+
+	_, err := build()
+	assert.ErrorContains(t, err, "scripted")
+
+	for i := 0; i < 2; i++ {
+		artifacts, err := build()
+		assert.Nil(t, err)
+		fw, err := firmware.FindArtifact(artifacts, firmware.FirmwareArtifact)
+		assert.Nil(t, err)
+		data, err := os.ReadFile(fw.Path)
+		assert.Nil(t, err)
+		assert.Equal(t, firmware.SimulatedFirmware("img", "t16", "v2.10.0", flags), data)
+	}
+	assert.Equal(t, 3, simulator.Builds())
+
+	simulator.FailTargets["t16"] = errors.New("broken target")
+	_, err = build()
+	assert.ErrorContains(t, err, "broken target")
+}
+
+func TestSimulatedBuilderIsDeterministic(t *testing.T) {
+	fr := firmware.SimulatedFirmware("img", "t16", "nightly", []firmware.BuildFlag{
+		firmware.NewFlag("TRANSLATIONS", "FR"),
+	})
+	cz := firmware.SimulatedFirmware("img", "t16", "nightly", []firmware.BuildFlag{
+		firmware.NewFlag("TRANSLATIONS", "CZ"),
+	})
+	assert.NotEqual(t, fr, cz)
+	assert.Len(t, fr, 4096)
+}
+
+func TestSimulatedBuilderCancellation(t *testing.T) {
+	simulator := firmware.NewSimulatedBuilder(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	builder := simulator.ForDir(t.TempDir(), buildlogs.NewRecorder())
+	_, err := builder.Build(ctx, "img", "t16", "nightly", nil, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, simulator.Builds())
+}
@@ -0,0 +1,58 @@
+package processor
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/edgetx/cloudbuild/artifactory"
+	"github.com/edgetx/cloudbuild/config"
+)
+
+// ParseLabels parses comma separated key=value pairs.
+func ParseLabels(labels string) (map[string]string, error) {
+	parsed := make(map[string]string)
+	for _, label := range strings.Split(labels, ",") {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(label, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid worker label %q", label)
+		}
+		parsed[key] = value
+	}
+	return parsed, nil
+}
+
+// NewCapabilities describes a worker running slots on this host.
+func NewCapabilities(slots []Slot, images []string) *artifactory.WorkerCapabilities {
+	caps := &artifactory.WorkerCapabilities{
+		Arch:   runtime.GOARCH,
+		Slots:  len(slots),
+		Images: images,
+	}
+	if len(slots) > 0 {
+		caps.MemoryMB = uint32(slots[0].Memory / (1024 * 1024))
+	}
+	return caps
+}
+
+// CapabilitiesFromConfig describes the worker, images being the container
+// images cached locally.
+func CapabilitiesFromConfig(
+	c *config.CloudbuildOpts, slots []Slot, images []string,
+) (*artifactory.WorkerCapabilities, error) {
+	caps := NewCapabilities(slots, images)
+	labels, err := ParseLabels(c.WorkerLabels)
+	if err != nil {
+		return nil, err
+	}
+	caps.Labels = labels
+	caps.Releases = c.WorkerReleases
+	if err := caps.ParseReleases(); err != nil {
+		return nil, err
+	}
+	return caps, nil
+}
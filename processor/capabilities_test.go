@@ -0,0 +1,38 @@
+package processor_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/edgetx/cloudbuild/config"
+	"github.com/edgetx/cloudbuild/processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLabels(t *testing.T) {
+	labels, err := processor.ParseLabels("zone=eu, disk=ssd,")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"zone": "eu", "disk": "ssd"}, labels)
+
+	_, err = processor.ParseLabels("zone")
+	assert.Error(t, err)
+}
+
+func TestCapabilitiesFromConfig(t *testing.T) {
+	opts := &config.CloudbuildOpts{
+		WorkerLabels:   "zone=eu",
+		WorkerReleases: ">= v2.10.0",
+	}
+	slots := processor.NewSlots(2, 8, 8*1024*1024*1024)
+	caps, err := processor.CapabilitiesFromConfig(opts, slots, []string{"builder:2.10"})
+	assert.Nil(t, err)
+	assert.Equal(t, runtime.GOARCH, caps.Arch)
+	assert.Equal(t, 2, caps.Slots)
+	assert.Equal(t, uint32(4096), caps.MemoryMB)
+	assert.Equal(t, []string{"builder:2.10"}, caps.Images)
+	assert.Equal(t, map[string]string{"zone": "eu"}, caps.Labels)
+
+	opts.WorkerReleases = "not a constraint"
+	_, err = processor.CapabilitiesFromConfig(opts, slots, nil)
+	assert.Error(t, err)
+}
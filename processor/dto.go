@@ -1,29 +1,63 @@
 package processor
 
 import (
+	"encoding/json"
 	"time"
+
+	"github.com/edgetx/cloudbuild/artifactory"
 )
 
 type WorkerDto struct {
-	ID        string    `json:"id"`
-	Hostname  string    `json:"hostname"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID           string                          `json:"id"`
+	Hostname     string                          `json:"hostname"`
+	Capabilities *artifactory.WorkerCapabilities `json:"capabilities"`
+	State        WorkerState                     `json:"state"`
+	// CurrentJobs are the IDs of the jobs being built.
+	CurrentJobs     []string  `json:"current_jobs"`
+	StartedAt       time.Time `json:"started_at"`
+	UptimeSeconds   int64     `json:"uptime_seconds"`
+	BuildsCompleted int64     `json:"builds_completed"`
+	BuildsFailed    int64     `json:"builds_failed"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
 }
 
-func WorkerDtoFromModel(model *WorkerModel) WorkerDto {
+func WorkerDtoFromModel(model *WorkerModel, currentJobs []string) WorkerDto {
+	var caps *artifactory.WorkerCapabilities
+	if model.Capabilities != nil {
+		// workers of older versions did not advertise capabilities
+		if err := json.Unmarshal(model.Capabilities, &caps); err != nil {
+			caps = nil
+		}
+	}
+	if currentJobs == nil {
+		currentJobs = []string{}
+	}
+	var uptime int64
+	if !model.StartedAt.IsZero() {
+		uptime = int64(time.Since(model.StartedAt).Seconds())
+	}
 	return WorkerDto{
-		ID:        model.ID.String(),
-		Hostname:  model.Hostname,
-		CreatedAt: model.CreatedAt,
-		UpdatedAt: model.UpdatedAt,
+		ID:              model.ID.String(),
+		Hostname:        model.Hostname,
+		Capabilities:    caps,
+		State:           model.State,
+		CurrentJobs:     currentJobs,
+		StartedAt:       model.StartedAt,
+		UptimeSeconds:   uptime,
+		BuildsCompleted: model.BuildsCompleted,
+		BuildsFailed:    model.BuildsFailed,
+		CreatedAt:       model.CreatedAt,
+		UpdatedAt:       model.UpdatedAt,
 	}
 }
 
-func WorkersDtoFromModels(models *[]WorkerModel) *[]WorkerDto {
+// WorkersDtoFromModels maps the workers with their current jobs by worker ID.
+func WorkersDtoFromModels(models *[]WorkerModel, currentJobs map[string][]string) *[]WorkerDto {
 	dtos := make([]WorkerDto, len(*models))
 	for i := range *models {
-		dtos[i] = WorkerDtoFromModel(&(*models)[i])
+		model := &(*models)[i]
+		dtos[i] = WorkerDtoFromModel(model, currentJobs[model.ID.String()])
 	}
 	return &dtos
 }
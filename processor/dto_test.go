@@ -0,0 +1,42 @@
+package processor_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/edgetx/cloudbuild/processor"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkersDtoFromModels(t *testing.T) {
+	busy := processor.WorkerModel{
+		ID:              uuid.NewV4(),
+		Hostname:        "busy",
+		Capabilities:    []byte(`{"arch":"amd64","slots":2,"memory_mb":0}`),
+		State:           processor.WorkerActive,
+		StartedAt:       time.Now().Add(-time.Hour),
+		BuildsCompleted: 12,
+		BuildsFailed:    2,
+	}
+	idle := processor.WorkerModel{
+		ID:       uuid.NewV4(),
+		Hostname: "idle",
+		State:    processor.WorkerPaused,
+	}
+	jobID := uuid.NewV4().String()
+
+	dtos := *processor.WorkersDtoFromModels(
+		&[]processor.WorkerModel{busy, idle},
+		map[string][]string{busy.ID.String(): {jobID}},
+	)
+	assert.Equal(t, []string{jobID}, dtos[0].CurrentJobs)
+	assert.InDelta(t, 3600, dtos[0].UptimeSeconds, 5)
+	assert.Equal(t, int64(12), dtos[0].BuildsCompleted)
+	assert.Equal(t, int64(2), dtos[0].BuildsFailed)
+	assert.Equal(t, 2, dtos[0].Capabilities.Slots)
+
+	assert.Equal(t, []string{}, dtos[1].CurrentJobs)
+	assert.Equal(t, processor.WorkerPaused, dtos[1].State)
+	assert.Nil(t, dtos[1].Capabilities)
+}
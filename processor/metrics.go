@@ -0,0 +1,26 @@
+package processor
+
+import (
+	"net/http"
+
+	"github.com/edgetx/cloudbuild/artifactory"
+	"github.com/edgetx/cloudbuild/firmware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// ServeMetrics exposes the metrics of the builds run by this worker
+// on listen at /metrics.
+func ServeMetrics(listen string) {
+	r := prometheus.NewRegistry()
+	artifactory.RegisterBuildMetrics(r)
+	firmware.RegisterCompilerCacheMetrics(r)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(r, promhttp.HandlerOpts{}))
+	log.Infof("serving worker metrics on %s", listen)
+	if err := http.ListenAndServe(listen, mux); err != nil { //nolint:gosec
+		log.Errorf("failed to serve worker metrics: %s", err)
+	}
+}
@@ -2,13 +2,17 @@ package processor
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"os"
 	"time"
 
+	"github.com/edgetx/cloudbuild/artifactory"
 	"github.com/edgetx/cloudbuild/config"
 	"github.com/edgetx/cloudbuild/database"
 	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -17,11 +21,38 @@ const (
 	Timeout           = time.Second * 30
 )
 
+var (
+	ErrWorkerNotFound     = errors.New("worker not found")
+	ErrInvalidWorkerState = errors.New("invalid worker state")
+)
+
+type WorkerState string
+
+const (
+	// WorkerActive workers take new jobs.
+	WorkerActive WorkerState = "ACTIVE"
+	// WorkerPaused workers finish their jobs and wait to be resumed.
+	WorkerPaused WorkerState = "PAUSED"
+	// WorkerDraining workers finish their jobs and stop.
+	WorkerDraining WorkerState = "DRAINING"
+	// WorkerDrained workers stopped after draining.
+	WorkerDrained WorkerState = "DRAINED"
+)
+
 type WorkerModel struct {
-	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
-	Hostname  string    `gorm:"index:worker_hostname_idx"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID       uuid.UUID `gorm:"type:uuid;primary_key;"`
+	Hostname string    `gorm:"index:worker_hostname_idx"`
+	// Capabilities are the artifactory.WorkerCapabilities of the worker.
+	Capabilities datatypes.JSON
+	State        WorkerState `gorm:"not null;default:ACTIVE"`
+	// StartedAt is when the worker process started, the build counters
+	// are reset then.
+	StartedAt time.Time
+	// BuildsCompleted counts the finished builds, BuildsFailed those failed.
+	BuildsCompleted int64 `gorm:"not null;default:0"`
+	BuildsFailed    int64 `gorm:"not null;default:0"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
 }
 
 func (WorkerModel) TableName() string {
@@ -29,7 +60,10 @@ func (WorkerModel) TableName() string {
 }
 
 func (base *WorkerModel) BeforeCreate(db *gorm.DB) error {
-	base.ID = uuid.NewV4()
+	// a worker removed by GarbageCollector comes back with its ID
+	if base.ID == uuid.Nil {
+		base.ID = uuid.NewV4()
+	}
 	return nil
 }
 
@@ -41,52 +75,156 @@ func NewWorkerDB(c *config.CloudbuildOpts) *WorkerDB {
 	return &WorkerDB{db: newDB(c)}
 }
 
+func NewWorkerDBFromDB(db *gorm.DB) *WorkerDB {
+	return &WorkerDB{db: db}
+}
+
 func (w *WorkerDB) List() (*[]WorkerModel, error) {
 	var workers []WorkerModel
 	err := w.db.Find(&workers).Error
 	return &workers, err
 }
 
-func newDB(c *config.CloudbuildOpts) *gorm.DB {
-	db, err := database.New(c.DatabaseDSN)
+func (w *WorkerDB) Find(id string) (*WorkerModel, error) {
+	uid, err := uuid.FromString(id)
 	if err != nil {
-		panic(err)
+		return nil, ErrWorkerNotFound
 	}
-	return db
+	var worker WorkerModel
+	err = w.db.First(&worker, "id = ?", uid).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrWorkerNotFound
+	}
+	return &worker, err
 }
 
-func Heartbeat(c *config.CloudbuildOpts) {
-	var workerModel WorkerModel
-	hostname, err := os.Hostname()
+// CurrentJobs returns the jobs being built by the workers, by worker ID.
+func (w *WorkerDB) CurrentJobs() (map[string][]string, error) {
+	var jobs []artifactory.BuildJobModel
+	err := w.db.Select("id", "worker_id").
+		Where("status = ? AND worker_id <> ''", artifactory.BuildInProgress).
+		Find(&jobs).Error
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	current := make(map[string][]string)
+	for _, job := range jobs {
+		current[job.WorkerID] = append(current[job.WorkerID], job.ID.String())
+	}
+	return current, nil
+}
 
-	db := newDB(c)
-	err = db.Where(&WorkerModel{
-		Hostname: hostname,
-	}).First(&workerModel).Error
-
+// Register records a worker starting on hostname,
+// keeping the ID of a previous worker on the same host.
+func (w *WorkerDB) Register(
+	hostname string, caps *artifactory.WorkerCapabilities,
+) (*WorkerModel, error) {
+	capsJSON, err := json.Marshal(caps)
+	if err != nil {
+		return nil, err
+	}
+	var worker WorkerModel
+	err = w.db.Where(&WorkerModel{Hostname: hostname}).First(&worker).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	worker.Hostname = hostname
+	worker.Capabilities = capsJSON
+	worker.State = WorkerActive
+	worker.StartedAt = time.Now()
+	worker.BuildsCompleted = 0
+	worker.BuildsFailed = 0
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		workerModel.Hostname = hostname
-		if err := db.Create(&workerModel).Error; err != nil {
-			panic(err)
+		err = w.db.Create(&worker).Error
+	} else {
+		err = w.db.Save(&worker).Error
+	}
+	return &worker, err
+}
+
+// Beat marks the worker alive and returns its state, which is changed
+// through SetState. A worker removed by GarbageCollector is recorded again.
+func (w *WorkerDB) Beat(worker *WorkerModel) (WorkerState, error) {
+	res := w.db.Model(&WorkerModel{}).
+		Where("id = ?", worker.ID).
+		Update("updated_at", time.Now())
+	if res.Error != nil {
+		return "", res.Error
+	}
+	if res.RowsAffected == 0 {
+		if err := w.db.Create(worker).Error; err != nil {
+			return "", err
 		}
 	}
+	var state WorkerState
+	err := w.db.Model(&WorkerModel{}).Select("state").
+		Where("id = ?", worker.ID).Scan(&state).Error
+	return state, err
+}
 
-	for {
-		db.Save(&workerModel)
-		time.Sleep(HeartbeatInterval)
+// SetState changes the state of a worker, which applies it on its next beat.
+func (w *WorkerDB) SetState(id string, state WorkerState) (*WorkerModel, error) {
+	switch state {
+	case WorkerActive, WorkerPaused, WorkerDraining:
+	default:
+		return nil, ErrInvalidWorkerState
+	}
+	worker, err := w.Find(id)
+	if err != nil {
+		return nil, err
+	}
+	worker.State = state
+	err = w.db.Model(worker).Update("state", state).Error
+	return worker, err
+}
+
+// MarkDrained records that a draining worker stopped.
+func (w *WorkerDB) MarkDrained(worker *WorkerModel) error {
+	return w.db.Model(worker).Update("state", WorkerDrained).Error
+}
+
+// RecordBuild counts a finished build of the worker.
+func (w *WorkerDB) RecordBuild(worker *WorkerModel, failed bool) error {
+	counters := map[string]interface{}{
+		"builds_completed": gorm.Expr("builds_completed + 1"),
 	}
+	if failed {
+		counters["builds_failed"] = gorm.Expr("builds_failed + 1")
+	}
+	return w.db.Model(&WorkerModel{}).
+		Where("id = ?", worker.ID).
+		UpdateColumns(counters).Error
 }
 
-func GarbageCollector(c *config.CloudbuildOpts) {
+func newDB(c *config.CloudbuildOpts) *gorm.DB {
+	db, err := database.New(c.DatabaseDSN)
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// Hostname identifies the host of the worker.
+func Hostname() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		panic(err)
+	}
+	return hostname
+}
+
+// GarbageCollector removes the workers that stopped beating,
+// and requeues the jobs they were building.
+func GarbageCollector(c *config.CloudbuildOpts, art *artifactory.Artifactory) {
 	db := newDB(c)
 	for {
 		db.Where(
 			"updated_at < @updatedAt",
 			sql.Named("updatedAt", time.Now().Add(-Timeout)),
 		).Delete(&WorkerModel{})
+		if err := art.RequeueOrphanedJobs(); err != nil {
+			log.Warnf("failed to requeue orphaned jobs: %s", err)
+		}
 		time.Sleep(HeartbeatInterval)
 	}
 }
@@ -0,0 +1,38 @@
+package processor
+
+import (
+	"runtime"
+
+	"github.com/edgetx/cloudbuild/config"
+)
+
+// Slot is the share of the host resources given to one concurrent build.
+type Slot struct {
+	CPUs   int
+	Memory int // bytes, 0 means no limit
+}
+
+// NewSlots splits cpus and memory evenly between count slots.
+// Every slot gets at least one CPU.
+func NewSlots(count int, cpus int, memory int) []Slot {
+	if count < 1 {
+		count = 1
+	}
+	slot := Slot{
+		CPUs:   max(cpus/count, 1),
+		Memory: memory / count,
+	}
+	slots := make([]Slot, count)
+	for i := range slots {
+		slots[i] = slot
+	}
+	return slots
+}
+
+func SlotsFromConfig(c *config.CloudbuildOpts) []Slot {
+	cpus := int(c.WorkerCPUs)
+	if cpus == 0 {
+		cpus = runtime.NumCPU()
+	}
+	return NewSlots(int(c.WorkerSlots), cpus, int(c.WorkerMemoryMB)*1024*1024)
+}
@@ -0,0 +1,25 @@
+package processor_test
+
+import (
+	"testing"
+
+	"github.com/edgetx/cloudbuild/processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSlotsSharesResources(t *testing.T) {
+	slots := processor.NewSlots(4, 32, 8*1024)
+	assert.Len(t, slots, 4)
+	for _, slot := range slots {
+		assert.Equal(t, 8, slot.CPUs)
+		assert.Equal(t, 2*1024, slot.Memory)
+	}
+
+	// every slot gets at least one CPU
+	slots = processor.NewSlots(3, 2, 0)
+	assert.Len(t, slots, 3)
+	assert.Equal(t, 1, slots[2].CPUs)
+	assert.Equal(t, 0, slots[2].Memory)
+
+	assert.Len(t, processor.NewSlots(0, 2, 0), 1)
+}
@@ -2,8 +2,11 @@ package processor
 
 import (
 	"context"
+	"io"
 	"os"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/edgetx/cloudbuild/artifactory"
@@ -14,54 +17,268 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// cancelPollInterval is how often a running job is checked for cancellation.
+const cancelPollInterval = 2 * time.Second
+
 type Worker struct {
 	artifactory *artifactory.Artifactory
-	running     bool
-	inProgress  bool
+	slots       []Slot
+	// Capabilities select the jobs built by the worker, any job when nil.
+	Capabilities *artifactory.WorkerCapabilities
+	// Mirrors are used to fetch the sources when set.
+	Mirrors *source.Mirrors
+	// Runtime runs the build containers.
+	Runtime firmware.ContainerRuntime
+	// CompilerCache is used by the builds when set.
+	CompilerCache *firmware.CompilerCache
+	// NewDownloader and NewBuilder replace the git downloader and the
+	// container builder when set, e.g. by the simulated ones in tests.
+	NewDownloader func(workingDir string, recorder *buildlogs.Recorder) source.Downloader
+	NewBuilder    func(workingDir string, recorder *buildlogs.Recorder, slot Slot) firmware.Builder
+	running       atomic.Bool
+	slotsDone     sync.WaitGroup
+	// busy counts the slots reserving or building a job, see watchDrain.
+	busy atomic.Int32
+	// registry and model are set once registered, see Register.
+	registry *WorkerDB
+	model    *WorkerModel
+	state    atomic.Value // WorkerState
+	drained  chan struct{}
+	jobsMu   sync.Mutex
+	jobs     map[*runningJob]struct{}
+}
+
+// runningJob wraps the firmware builder of a job to know whether
+// it started compiling, so that a stopping worker can hand it back.
+type runningJob struct {
+	firmware.Builder
+	mu        sync.Mutex
+	compiling bool
+	stopping  bool
+	cancel    context.CancelCauseFunc
+}
+
+func (job *runningJob) Build(
+	ctx context.Context,
+	buildContainer string,
+	target string,
+	versionTag string,
+	flags []firmware.BuildFlag,
+	rules []firmware.ArtifactRule,
+) ([]firmware.Artifact, error) {
+	job.mu.Lock()
+	if job.stopping {
+		job.mu.Unlock()
+		return nil, artifactory.ErrWorkerStopping
+	}
+	job.compiling = true
+	job.mu.Unlock()
+	return job.Builder.Build(ctx, buildContainer, target, versionTag, flags, rules)
+}
+
+// handBack interrupts the job if it has not started compiling yet,
+// the job is then requeued.
+func (job *runningJob) handBack() bool {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.compiling {
+		return false
+	}
+	job.stopping = true
+	job.cancel(artifactory.ErrWorkerStopping)
+	return true
 }
 
-func New(artifactory *artifactory.Artifactory) *Worker {
-	return &Worker{
+func New(artifactory *artifactory.Artifactory, slots []Slot) *Worker {
+	if len(slots) == 0 {
+		slots = NewSlots(1, runtime.NumCPU(), 0)
+	}
+	worker := &Worker{
 		artifactory: artifactory,
-		running:     false,
-		inProgress:  false,
+		slots:       slots,
+		drained:     make(chan struct{}),
+		jobs:        make(map[*runningJob]struct{}),
+	}
+	worker.state.Store(WorkerActive)
+	return worker
+}
+
+// Register records the worker, so that its jobs and state are tracked.
+// The jobs of a previous process on the same host are requeued, as it
+// keeps the same ID and is never considered gone.
+func (worker *Worker) Register(registry *WorkerDB) error {
+	model, err := registry.Register(Hostname(), worker.Capabilities)
+	if err != nil {
+		return err
 	}
+	if err := worker.artifactory.RequeueWorkerJobs(model.ID.String()); err != nil {
+		return errors.Wrap(err, "failed to requeue the jobs of the previous worker")
+	}
+	worker.registry = registry
+	worker.model = model
+	return nil
+}
+
+// Heartbeat keeps the registered worker alive and applies the state
+// requested through the API.
+func (worker *Worker) Heartbeat() {
+	for {
+		state, err := worker.registry.Beat(worker.model)
+		if err != nil {
+			log.Errorf("worker heartbeat failed: %s", err)
+		} else if state != worker.State() {
+			log.Infof("worker state changed to %s", state)
+			worker.SetState(state)
+		}
+		time.Sleep(HeartbeatInterval)
+	}
+}
+
+// SetState applies a state requested for the worker. A draining worker
+// builds again once set back to WorkerActive.
+func (worker *Worker) SetState(state WorkerState) {
+	worker.state.Store(state)
+}
+
+func (worker *Worker) State() WorkerState {
+	return worker.state.Load().(WorkerState)
+}
+
+// Drained is closed once a draining worker has finished its jobs.
+func (worker *Worker) Drained() <-chan struct{} {
+	return worker.drained
+}
+
+func (worker *Worker) buildWorker() *artifactory.BuildWorker {
+	buildWorker := &artifactory.BuildWorker{Capabilities: worker.Capabilities}
+	if worker.model != nil {
+		buildWorker.ID = worker.model.ID.String()
+		buildWorker.Hostname = worker.model.Hostname
+	}
+	return buildWorker
 }
 
 func (worker *Worker) build(
 	ctx context.Context,
 	job *artifactory.BuildJobModel,
+	slot Slot,
+	running *runningJob,
 ) (*artifactory.BuildJobModel, error) {
 	sourceDir, err := os.MkdirTemp("/tmp", "source")
 	if err != nil {
 		log.Fatalf("failed to create tmp dir: %s", err)
 	}
-	defer os.RemoveAll(sourceDir)
+	recorder := buildlogs.NewRecorderWithSink(worker.artifactory.NewLogSink(job.ID))
+	downloader := worker.newDownloader(sourceDir, recorder)
+	defer func() {
+		_ = os.RemoveAll(sourceDir)
+		// the sources may borrow objects from the git mirrors until removed
+		if closer, ok := downloader.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}()
+	running.Builder = worker.newBuilder(sourceDir, recorder, slot)
 
-	recorder := buildlogs.NewRecorder()
-	gitDownloader := source.NewGitDownloader(sourceDir, recorder)
-	firmwareBuilder := firmware.NewPodmanBuilder(sourceDir, recorder, runtime.NumCPU(), 2*1024*1024*1024)
+	publishCtx, stopPublishing := context.WithCancel(ctx)
+	publishDone := make(chan struct{})
+	go func() {
+		if err := recorder.Publish(publishCtx, buildlogs.DefaultPublishInterval); err != nil {
+			log.Warnf("failed to publish build logs: %s", err)
+		}
+		close(publishDone)
+	}()
+	defer func() {
+		stopPublishing()
+		<-publishDone
+	}()
 
 	return worker.artifactory.Build(
-		ctx, job, recorder, gitDownloader, firmwareBuilder,
+		ctx, job, recorder, downloader, running,
+	)
+}
+
+func (worker *Worker) newDownloader(workingDir string, recorder *buildlogs.Recorder) source.Downloader {
+	if worker.NewDownloader != nil {
+		return worker.NewDownloader(workingDir, recorder)
+	}
+	gitDownloader := source.NewGitDownloader(workingDir, recorder)
+	gitDownloader.Mirrors = worker.Mirrors
+	return gitDownloader
+}
+
+func (worker *Worker) newBuilder(workingDir string, recorder *buildlogs.Recorder, slot Slot) firmware.Builder {
+	if worker.NewBuilder != nil {
+		return worker.NewBuilder(workingDir, recorder, slot)
+	}
+	firmwareBuilder := firmware.NewContainerBuilder(
+		worker.Runtime, workingDir, recorder, slot.CPUs, slot.Memory,
 	)
+	firmwareBuilder.Cache = worker.CompilerCache
+	return firmwareBuilder
 }
 
-func (worker *Worker) executeJob(job *artifactory.BuildJobModel) {
+// watchLease cancels the build context with ErrBuildCancelled once the job
+// is cancelled, or with ErrLeaseLost once it was requeued, until ctx is done.
+func (worker *Worker) watchLease(
+	ctx context.Context, job *artifactory.BuildJobModel, cancel context.CancelCauseFunc,
+) {
+	ticker := time.NewTicker(cancelPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := worker.artifactory.CheckLease(job)
+			switch {
+			case errors.Is(err, artifactory.ErrBuildCancelled),
+				errors.Is(err, artifactory.ErrLeaseLost):
+				log.Infof("job %s: %s, stopping build", job.ID, err)
+				cancel(err)
+				return
+			case err != nil:
+				log.Warnf("failed to check job %s lease: %s", job.ID, err)
+			}
+		}
+	}
+}
+
+func (worker *Worker) executeJob(job *artifactory.BuildJobModel, slot Slot) {
 	log.Debugf("starting %s job, result: %s", job.ID, job.Status)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*15)
-	defer cancel()
+	timeoutCtx, cancelTimeout := context.WithTimeout(context.Background(), time.Minute*15)
+	defer cancelTimeout()
+	ctx, cancel := context.WithCancelCause(timeoutCtx)
+	defer cancel(nil)
+	go worker.watchLease(ctx, job, cancel)
+
+	running := &runningJob{cancel: cancel}
+	worker.jobsMu.Lock()
+	worker.jobs[running] = struct{}{}
+	worker.jobsMu.Unlock()
+	defer func() {
+		worker.jobsMu.Lock()
+		delete(worker.jobs, running)
+		worker.jobsMu.Unlock()
+	}()
 
 	waitCh := make(chan struct{})
 	go func() {
-		if _, err := worker.build(ctx, job); err != nil {
+		_, err := worker.build(ctx, job, slot, running)
+		if err != nil && !isInterruption(err) {
 			log.Errorf("failed to process next build job: %s", err)
 		}
+		worker.recordBuild(err)
 		close(waitCh)
 	}()
 
 	select {
-	case <-ctx.Done(): // timeout
+	case <-ctx.Done(): // timeout or interruption
+		if cause := context.Cause(ctx); isInterruption(cause) {
+			// wait for the container to be removed
+			<-waitCh
+			log.Infof("job %s interrupted: %s", job.ID, cause)
+			return
+		}
 		log.Errorf("job %s timed out! (status: %s)", job.ID, job.Status)
 
 	case <-waitCh: // finished normally
@@ -74,7 +291,9 @@ func (worker *Worker) PullImage(ctx context.Context, buildImage string) error {
 		We do this so actual build process is faster because of the cached build image
 	*/
 	recorder := buildlogs.NewRecorder()
-	firmwareBuilder := firmware.NewPodmanBuilder("/tmp", recorder, runtime.NumCPU(), 1024*1024*1024)
+	firmwareBuilder := firmware.NewContainerBuilder(
+		worker.Runtime, "/tmp", recorder, runtime.NumCPU(), 1024*1024*1024,
+	)
 	ctx, cancel := context.WithTimeout(ctx, artifactory.MaxBuildDuration)
 	defer cancel()
 
@@ -86,36 +305,111 @@ func (worker *Worker) PullImage(ctx context.Context, buildImage string) error {
 	return err
 }
 
+// CachedImages lists the container images available locally to the builds.
+func (worker *Worker) CachedImages(ctx context.Context) ([]string, error) {
+	firmwareBuilder := firmware.NewContainerBuilder(
+		worker.Runtime, "/tmp", buildlogs.NewRecorder(), runtime.NumCPU(), 0,
+	)
+	return firmwareBuilder.ListImages(ctx)
+}
+
+// isInterruption returns true if the build was stopped on purpose.
+func isInterruption(err error) bool {
+	return errors.Is(err, artifactory.ErrBuildCancelled) ||
+		errors.Is(err, artifactory.ErrLeaseLost) ||
+		errors.Is(err, artifactory.ErrWorkerStopping)
+}
+
+func (worker *Worker) recordBuild(err error) {
+	// requeued jobs are built again
+	if worker.registry == nil ||
+		errors.Is(err, artifactory.ErrLeaseLost) ||
+		errors.Is(err, artifactory.ErrWorkerStopping) {
+		return
+	}
+	failed := err != nil && !errors.Is(err, artifactory.ErrBuildCancelled)
+	if err := worker.registry.RecordBuild(worker.model, failed); err != nil {
+		log.Warnf("failed to record build: %s", err)
+	}
+}
+
+// Run starts one build loop per slot, each reserving jobs on its own.
 func (worker *Worker) Run() {
-	worker.running = true
-	for worker.running {
-		worker.inProgress = true
-		job, err := worker.artifactory.ReservePendingBuild()
-		if err != nil {
-			log.Errorf("failed to reserve next build job: %s", err)
-			time.Sleep(time.Second * 1)
-			continue
+	worker.running.Store(true)
+	for i, slot := range worker.slots {
+		log.Infof("starting worker slot %d (cpus: %d, memory: %d)", i, slot.CPUs, slot.Memory)
+		worker.slotsDone.Add(1)
+		go func() {
+			defer worker.slotsDone.Done()
+			worker.runSlot(slot)
+		}()
+	}
+	go worker.watchDrain()
+}
+
+// watchDrain closes Drained once the worker is draining and none of
+// its slots is reserving or building a job.
+func (worker *Worker) watchDrain() {
+	for worker.running.Load() {
+		if worker.State() == WorkerDraining && worker.busy.Load() == 0 {
+			if worker.registry != nil {
+				if err := worker.registry.MarkDrained(worker.model); err != nil {
+					log.Warnf("failed to record drained worker: %s", err)
+				}
+			}
+			close(worker.drained)
+			return
 		}
+		time.Sleep(time.Second * 1)
+	}
+}
 
-		if job != nil {
-			worker.executeJob(job)
-		} else {
+func (worker *Worker) runSlot(slot Slot) {
+	for worker.running.Load() {
+		if !worker.buildNext(slot) {
 			time.Sleep(time.Second * 1)
 		}
+	}
+}
 
-		worker.inProgress = false
+// buildNext reserves and builds a job unless the worker is paused or
+// draining, it returns false if there was nothing to build.
+func (worker *Worker) buildNext(slot Slot) bool {
+	// counted before checking the state, so that watchDrain cannot
+	// miss a job reserved while the worker starts draining
+	worker.busy.Add(1)
+	defer worker.busy.Add(-1)
+	if state := worker.State(); state == WorkerDraining || state == WorkerPaused {
+		return false
+	}
+	job, err := worker.artifactory.ReservePendingBuild(worker.buildWorker())
+	if err != nil {
+		log.Errorf("failed to reserve next build job: %s", err)
+		return false
+	}
+	if job == nil {
+		return false
 	}
+	worker.executeJob(job, slot)
+	return true
 }
 
+// Stop waits for the jobs being compiled to finish,
+// and hands back those that did not start compiling yet.
 func (worker *Worker) Stop(ctx context.Context) error {
-	worker.running = false
+	worker.running.Store(false)
+	worker.jobsMu.Lock()
+	for job := range worker.jobs {
+		if job.handBack() {
+			log.Info("handing back a job not compiling yet")
+		}
+	}
+	worker.jobsMu.Unlock()
 
 	shutdownDone := make(chan bool)
 	go func() {
-		for worker.inProgress {
-			time.Sleep(time.Second * 1)
-			log.Info("Waiting for processor shutdown...")
-		}
+		log.Info("Waiting for processor shutdown...")
+		worker.slotsDone.Wait()
 		shutdownDone <- true
 	}()
 
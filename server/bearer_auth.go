@@ -36,29 +36,38 @@ func extractBearerToken(header string) (string, string, error) {
 	return splitAuthToken(bearerToken[1])
 }
 
+// authenticate checks the bearer token of the request and returns its
+// access key. The request is aborted if the token is invalid.
+func authenticate(auth *auth.AuthTokenDB, c *gin.Context) (string, bool) {
+	authHdr := c.GetHeader("Authorization")
+	if authHdr == "" {
+		c.AbortWithStatus(
+			http.StatusUnauthorized,
+		)
+		return "", false
+	}
+	accessKey, secretKey, err := extractBearerToken(authHdr)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrorResponse(err.Error()),
+		)
+		return "", false
+	}
+	err = auth.Authenticate(accessKey, secretKey)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrorResponse(err.Error()),
+		)
+		return "", false
+	}
+	return accessKey, true
+}
+
 func BearerAuth(auth *auth.AuthTokenDB, handler gin.HandlerFunc) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHdr := c.GetHeader("Authorization")
-		if authHdr == "" {
-			c.AbortWithStatus(
-				http.StatusUnauthorized,
-			)
-			return
-		}
-		accessKey, secretKey, err := extractBearerToken(authHdr)
-		if err != nil {
-			c.AbortWithStatusJSON(
-				http.StatusBadRequest,
-				NewErrorResponse(err.Error()),
-			)
-			return
-		}
-		err = auth.Authenticate(accessKey, secretKey)
-		if err != nil {
-			c.AbortWithStatusJSON(
-				http.StatusBadRequest,
-				NewErrorResponse(err.Error()),
-			)
+		if _, ok := authenticate(auth, c); !ok {
 			return
 		}
 		handler(c)
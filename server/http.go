@@ -1,10 +1,15 @@
 package server
 
 import (
+	"encoding/base64"
 	"errors"
+	"io"
+	"mime"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -13,6 +18,7 @@ import (
 	"github.com/edgetx/cloudbuild/config"
 	"github.com/edgetx/cloudbuild/processor"
 	"github.com/edgetx/cloudbuild/targets"
+	"github.com/gin-contrib/sse"
 	"github.com/gin-contrib/static"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
@@ -22,13 +28,15 @@ import (
 )
 
 const (
-	staticContentDir = "./static"
-	defaultFile      = "./static/index.html"
+	staticContentDir      = "./static"
+	defaultFile           = "./static/index.html"
+	logStreamPollInterval = time.Second
 )
 
 var (
 	ErrInvalidRequest = errors.New("invalid request")
 	ErrNotFound       = errors.New("object not found")
+	ErrRateLimited    = errors.New("too many requests")
 )
 
 type Application struct {
@@ -112,7 +120,14 @@ func (app *Application) deleteBuildJob(c *gin.Context) {
 		BadRequestResponse(c, ErrInvalidRequest)
 		return
 	}
-	err := app.artifactory.DeleteJob(jobID)
+	err := app.artifactory.DeleteJob(c.Request.Context(), jobID)
+	if errors.Is(err, artifactory.ErrBuildNotFound) {
+		c.AbortWithStatusJSON(
+			http.StatusNotFound,
+			NewErrorResponse("job not found"),
+		)
+		return
+	}
 	if err != nil {
 		ServiceUnavailableResponse(c, err)
 		return
@@ -120,6 +135,34 @@ func (app *Application) deleteBuildJob(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "ok"})
 }
 
+func (app *Application) cancelBuildJob(c *gin.Context) {
+	jobID := c.Param("id")
+	if jobID == "" {
+		BadRequestResponse(c, ErrInvalidRequest)
+		return
+	}
+	job, err := app.artifactory.CancelJob(c.ClientIP(), jobID)
+	if errors.Is(err, artifactory.ErrBuildNotFound) {
+		c.AbortWithStatusJSON(
+			http.StatusNotFound,
+			NewErrorResponse("job not found"),
+		)
+		return
+	}
+	if errors.Is(err, artifactory.ErrBuildNotCancellable) {
+		c.AbortWithStatusJSON(
+			http.StatusConflict,
+			NewErrorResponse("job is not queued or in progress"),
+		)
+		return
+	}
+	if err != nil {
+		ServiceUnavailableResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
 func (app *Application) getBuildJobLogs(c *gin.Context) {
 	jobID := c.Param("id")
 	if jobID == "" {
@@ -141,13 +184,118 @@ func (app *Application) getBuildJobLogs(c *gin.Context) {
 	c.JSON(http.StatusOK, logs)
 }
 
+func (app *Application) streamBuildJobLogs(c *gin.Context) {
+	jobID := c.Param("id")
+	if jobID == "" {
+		BadRequestResponse(c, ErrInvalidRequest)
+		return
+	}
+
+	// resume after the last chunk received by a reconnecting client
+	var lastSeq int64
+	if lastEventID := c.GetHeader("Last-Event-ID"); lastEventID != "" {
+		seq, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil {
+			BadRequestResponse(c, ErrInvalidRequest)
+			return
+		}
+		lastSeq = seq
+	}
+
+	logs, err := app.artifactory.GetLiveLogs(jobID, lastSeq)
+	if errors.Is(err, artifactory.ErrBuildNotFound) {
+		c.AbortWithStatusJSON(
+			http.StatusNotFound,
+			NewErrorResponse("job not found"),
+		)
+		return
+	}
+	if err != nil {
+		ServiceUnavailableResponse(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	ticker := time.NewTicker(logStreamPollInterval)
+	defer ticker.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		for _, chunk := range logs.Chunks {
+			c.Render(-1, sse.Event{
+				Event: "log",
+				Id:    strconv.FormatInt(chunk.Seq, 10),
+				Data:  chunk,
+			})
+			lastSeq = chunk.Seq
+		}
+		if !logs.Status.IsPending() {
+			c.SSEvent("status", gin.H{"status": logs.Status})
+			return false
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ticker.C:
+		}
+
+		logs, err = app.artifactory.GetLiveLogs(jobID, lastSeq)
+		if err != nil {
+			c.SSEvent("error", NewErrorResponse(err.Error()))
+			return false
+		}
+		return true
+	})
+}
+
 func (app *Application) listWorkers(c *gin.Context) {
 	workers, err := app.workers.List()
 	if err != nil {
 		ServiceUnavailableResponse(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, processor.WorkersDtoFromModels(workers))
+	currentJobs, err := app.workers.CurrentJobs()
+	if err != nil {
+		ServiceUnavailableResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, processor.WorkersDtoFromModels(workers, currentJobs))
+}
+
+type workerStateRequest struct {
+	State processor.WorkerState `json:"state" binding:"required"`
+}
+
+func (app *Application) setWorkerState(c *gin.Context) {
+	var req workerStateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		UnprocessableEntityResponse(c, err.Error())
+		return
+	}
+	worker, err := app.workers.SetState(c.Param("id"), req.State)
+	if errors.Is(err, processor.ErrWorkerNotFound) {
+		c.AbortWithStatusJSON(
+			http.StatusNotFound,
+			NewErrorResponse("worker not found"),
+		)
+		return
+	}
+	if errors.Is(err, processor.ErrInvalidWorkerState) {
+		UnprocessableEntityResponse(c, err.Error())
+		return
+	}
+	if err != nil {
+		ServiceUnavailableResponse(c, err)
+		return
+	}
+	currentJobs, err := app.workers.CurrentJobs()
+	if err != nil {
+		ServiceUnavailableResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, processor.WorkerDtoFromModel(worker, currentJobs[worker.ID.String()]))
 }
 
 func (app *Application) writeTargets(c *gin.Context) {
@@ -166,7 +314,26 @@ func (app *Application) createBuildJob(c *gin.Context) {
 		return
 	}
 
-	job, err := app.artifactory.CreateBuildJob(c.ClientIP(), req)
+	// authentication is optional, but required to set a priority
+	accessKey, ok := app.requestAccessKey(c)
+	if !ok {
+		return
+	}
+	requester := artifactory.Requester{IP: c.ClientIP(), AccessKey: accessKey}
+
+	job, err := app.artifactory.CreateBuildJob(requester, req)
+	if errors.Is(err, artifactory.ErrPriorityNotAllowed) {
+		c.AbortWithStatusJSON(http.StatusForbidden, NewErrorResponse(err.Error()))
+		return
+	}
+	if errors.Is(err, artifactory.ErrTooManyQueuedJobs) {
+		TooManyRequestsResponse(c, artifactory.QueuedJobsRetryAfter, err)
+		return
+	}
+	if errors.Is(err, artifactory.ErrCallbacksDisabled) {
+		UnprocessableEntityResponse(c, err.Error())
+		return
+	}
 	if err != nil {
 		ServiceUnavailableResponse(c, err)
 		return
@@ -200,6 +367,66 @@ func (app *Application) buildJobStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, job)
 }
 
+func (app *Application) getManifestKey(c *gin.Context) {
+	publicKey := app.artifactory.SigningPublicKey()
+	if publicKey == nil {
+		c.AbortWithStatusJSON(
+			http.StatusNotFound,
+			NewErrorResponse("manifests are not signed"),
+		)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"algorithm":  "ed25519",
+		"public_key": base64.StdEncoding.EncodeToString(publicKey),
+	})
+}
+
+func (app *Application) downloadSignedArtifact(c *gin.Context) {
+	id := c.Param("id")
+	err := app.artifactory.VerifyDownload(id, c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, NewErrorResponse(err.Error()))
+		return
+	}
+	download, err := app.artifactory.OpenArtifact(c.Request.Context(), id)
+	app.serveArtifact(c, download, err, "private, max-age=3600")
+}
+
+func (app *Application) downloadArtifactFile(c *gin.Context) {
+	// private artifacts are only reachable with a signed URL
+	if !app.artifactory.PublicDownloads() {
+		c.AbortWithStatusJSON(http.StatusNotFound, NewErrorResponse("no such artifact"))
+		return
+	}
+	download, err := app.artifactory.OpenArtifactFile(c.Request.Context(), c.Param("filename"))
+	app.serveArtifact(c, download, err, "public, max-age=86400")
+}
+
+func (app *Application) serveArtifact(
+	c *gin.Context, download *artifactory.ArtifactDownload, err error, cacheControl string,
+) {
+	if errors.Is(err, artifactory.ErrArtifactNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, NewErrorResponse("no such artifact"))
+		return
+	}
+	if err != nil {
+		ServiceUnavailableResponse(c, err)
+		return
+	}
+	defer download.Close()
+	c.Header("Content-Type", download.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType(
+		"attachment", map[string]string{"filename": download.FileName},
+	))
+	c.Header("Cache-Control", cacheControl)
+	if download.ETag != "" {
+		c.Header("ETag", download.ETag)
+	}
+	// handles Range, If-None-Match and If-Modified-Since
+	http.ServeContent(c.Writer, c.Request, download.FileName, download.ModifiedAt, download)
+}
+
 func (app *Application) getTargets(c *gin.Context) {
 	c.JSON(http.StatusOK, targets.GetTargets())
 }
@@ -208,17 +435,28 @@ func (app *Application) authenticated(handler gin.HandlerFunc) gin.HandlerFunc {
 	return BearerAuth(app.auth, handler)
 }
 
-func (app *Application) addAPIRoutes(rg *gin.RouterGroup) {
+func (app *Application) addAPIRoutes(rg *gin.RouterGroup, limits *RateLimits) {
 	// authenticated endpoints
 	rg.GET("/jobs", app.authenticated(app.listBuildJobs))
 	rg.DELETE("/job/:id", app.authenticated(app.deleteBuildJob))
 	rg.GET("/logs/:id", app.authenticated(app.getBuildJobLogs))
+	rg.GET("/jobs/:id/stream", app.authenticated(app.streamBuildJobLogs))
+	rg.POST("/jobs/:id/cancel", app.authenticated(app.cancelBuildJob))
+	rg.GET("/jobs/:id/deliveries", app.authenticated(app.listJobDeliveries))
+	rg.GET("/webhooks", app.authenticated(app.listWebhooks))
+	rg.POST("/webhooks", app.authenticated(app.createWebhook))
+	rg.DELETE("/webhooks/:id", app.authenticated(app.deleteWebhook))
+	rg.GET("/webhooks/:id/deliveries", app.authenticated(app.listWebhookDeliveries))
 	rg.GET("/workers", app.authenticated(app.listWorkers))
+	rg.POST("/workers/:id/state", app.authenticated(app.setWorkerState))
 	rg.PUT("/targets", app.authenticated(app.writeTargets))
 	// public
-	rg.POST("/jobs", app.createBuildJob)
-	rg.POST("/status", app.buildJobStatus)
+	rg.POST("/jobs", app.rateLimited(limits.Jobs), app.createBuildJob)
+	rg.POST("/status", app.rateLimited(limits.Status), app.buildJobStatus)
 	rg.GET("/targets", app.getTargets)
+	rg.GET("/manifest-key", app.getManifestKey)
+	rg.GET("/artifacts/:id/download", app.downloadSignedArtifact)
+	rg.GET("/download/:filename", app.downloadArtifactFile)
 }
 
 func debugRoutes(method, path, _ string, _ int) {
@@ -228,7 +466,13 @@ func debugRoutes(method, path, _ string, _ int) {
 	}).Debugf("endpoint")
 }
 
-func (app *Application) Start(listen string, opts *config.CloudbuildOpts) error {
+// Router returns the HTTP handler of the application.
+func (app *Application) Router(opts *config.CloudbuildOpts) (*gin.Engine, error) {
+	limits, err := RateLimitsFromConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	gin.DebugPrintRouteFunc = debugRoutes
 	router := gin.New()
 	router.Use(ginlogrus.Logger(log.New()))
@@ -249,7 +493,7 @@ func (app *Application) Start(listen string, opts *config.CloudbuildOpts) error
 	api.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 	})
-	app.addAPIRoutes(api)
+	app.addAPIRoutes(api, limits)
 
 	// catch-all route to serve the UI
 	router.NoRoute(func(c *gin.Context) {
@@ -263,6 +507,14 @@ func (app *Application) Start(listen string, opts *config.CloudbuildOpts) error
 			c.File(defaultFile)
 		}
 	})
+	return router, nil
+}
+
+func (app *Application) Start(listen string, opts *config.CloudbuildOpts) error {
+	router, err := app.Router(opts)
+	if err != nil {
+		return err
+	}
 
 	var network string
 
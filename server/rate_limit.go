@@ -0,0 +1,189 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/edgetx/cloudbuild/config"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	accessKeyContextKey = "accessKey"
+	// buckets unused for that long are forgotten.
+	rateLimitIdleTimeout = 10 * time.Minute
+)
+
+var (
+	ErrBadRateLimit = errors.New("invalid rate limit (expected e.g. 30/m)")
+)
+
+// RateLimit allows Burst requests at once, refilled at Rate per second.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseRateLimit parses "<requests>/<s|m|h>", the burst being the number
+// of requests. An empty string or "0" disables the limit (nil).
+func ParseRateLimit(limit string) (*RateLimit, error) {
+	if limit == "" || limit == "0" {
+		return nil, nil
+	}
+	count, period, found := strings.Cut(limit, "/")
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrBadRateLimit, limit)
+	}
+	requests, err := strconv.Atoi(count)
+	if err != nil || requests <= 0 {
+		return nil, fmt.Errorf("%w: %s", ErrBadRateLimit, limit)
+	}
+	var duration time.Duration
+	switch period {
+	case "s":
+		duration = time.Second
+	case "m":
+		duration = time.Minute
+	case "h":
+		duration = time.Hour
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrBadRateLimit, limit)
+	}
+	return &RateLimit{
+		Rate:  float64(requests) / duration.Seconds(),
+		Burst: requests,
+	}, nil
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// RateLimiter is a token bucket rate limiter keyed by client.
+type RateLimiter struct {
+	mu      sync.Mutex
+	limit   RateLimit
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	return &RateLimiter{
+		limit:   limit,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of key. If none is left,
+// it returns false and how long to wait for the next token.
+func (limiter *RateLimiter) Allow(key string) (bool, time.Duration) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	now := limiter.now()
+	limiter.sweep(now)
+	b, ok := limiter.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limiter.limit.Burst), updated: now}
+		limiter.buckets[key] = b
+	}
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = math.Min(float64(limiter.limit.Burst), b.tokens+elapsed*limiter.limit.Rate)
+	b.updated = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / limiter.limit.Rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+func (limiter *RateLimiter) sweep(now time.Time) {
+	if now.Sub(limiter.swept) < rateLimitIdleTimeout {
+		return
+	}
+	for key, b := range limiter.buckets {
+		if now.Sub(b.updated) > rateLimitIdleTimeout {
+			delete(limiter.buckets, key)
+		}
+	}
+	limiter.swept = now
+}
+
+// RateLimits are the per route limiters, nil means unlimited.
+type RateLimits struct {
+	Jobs   *RateLimiter
+	Status *RateLimiter
+}
+
+func RateLimitsFromConfig(c *config.CloudbuildOpts) (*RateLimits, error) {
+	newLimiter := func(limit string) (*RateLimiter, error) {
+		rateLimit, err := ParseRateLimit(limit)
+		if err != nil || rateLimit == nil {
+			return nil, err
+		}
+		return NewRateLimiter(*rateLimit), nil
+	}
+	jobs, err := newLimiter(c.RateLimitJobs)
+	if err != nil {
+		return nil, err
+	}
+	status, err := newLimiter(c.RateLimitStatus)
+	if err != nil {
+		return nil, err
+	}
+	return &RateLimits{Jobs: jobs, Status: status}, nil
+}
+
+// retryAfterSeconds rounds up, as Retry-After only supports seconds.
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(math.Max(wait.Seconds(), 1))))
+}
+
+func TooManyRequestsResponse(c *gin.Context, retryAfter time.Duration, err error) {
+	c.Header("Retry-After", retryAfterSeconds(retryAfter))
+	errorResponse(c, http.StatusTooManyRequests, err)
+}
+
+// rateLimited limits requests by bearer token if one is given,
+// or by client IP otherwise.
+func (app *Application) rateLimited(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			return
+		}
+		key := "ip:" + c.ClientIP()
+		if c.GetHeader("Authorization") != "" {
+			accessKey, ok := authenticate(app.auth, c)
+			if !ok {
+				return
+			}
+			c.Set(accessKeyContextKey, accessKey)
+			key = "token:" + accessKey
+		}
+		if ok, retryAfter := limiter.Allow(key); !ok {
+			TooManyRequestsResponse(c, retryAfter, ErrRateLimited)
+		}
+	}
+}
+
+// requestAccessKey returns the access key of an authenticated request,
+// or an empty string for anonymous requests.
+func (app *Application) requestAccessKey(c *gin.Context) (string, bool) {
+	if accessKey := c.GetString(accessKeyContextKey); accessKey != "" {
+		return accessKey, true
+	}
+	if c.GetHeader("Authorization") == "" {
+		return "", true
+	}
+	return authenticate(app.auth, c)
+}
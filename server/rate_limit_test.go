@@ -0,0 +1,50 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	limit, err := ParseRateLimit("30/m")
+	assert.Nil(t, err)
+	assert.Equal(t, 30, limit.Burst)
+	assert.InDelta(t, 0.5, limit.Rate, 1e-9)
+
+	limit, err = ParseRateLimit("0")
+	assert.Nil(t, err)
+	assert.Nil(t, limit)
+
+	for _, bad := range []string{"30", "x/m", "-1/s", "10/d"} {
+		_, err = ParseRateLimit(bad)
+		assert.ErrorIs(t, err, ErrBadRateLimit, bad)
+	}
+}
+
+func TestRateLimiterTokenBucket(t *testing.T) {
+	now := time.Now()
+	limiter := NewRateLimiter(RateLimit{Rate: 1, Burst: 2})
+	limiter.now = func() time.Time { return now }
+
+	ok, _ := limiter.Allow("ip:1")
+	assert.True(t, ok)
+	ok, _ = limiter.Allow("ip:1")
+	assert.True(t, ok)
+	ok, retryAfter := limiter.Allow("ip:1")
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, retryAfter)
+	assert.Equal(t, "1", retryAfterSeconds(retryAfter))
+
+	// other clients have their own bucket
+	ok, _ = limiter.Allow("ip:2")
+	assert.True(t, ok)
+
+	now = now.Add(1500 * time.Millisecond)
+	ok, _ = limiter.Allow("ip:1")
+	assert.True(t, ok)
+	ok, retryAfter = limiter.Allow("ip:1")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+}
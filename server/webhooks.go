@@ -0,0 +1,79 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/edgetx/cloudbuild/artifactory"
+	"github.com/gin-gonic/gin"
+)
+
+type createWebhookRequest struct {
+	URL      string                    `json:"url" binding:"required"`
+	Statuses []artifactory.BuildStatus `json:"statuses"`
+}
+
+func (app *Application) listWebhooks(c *gin.Context) {
+	webhooks, err := app.artifactory.ListWebhooks()
+	if err != nil {
+		ServiceUnavailableResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, webhooks)
+}
+
+func (app *Application) createWebhook(c *gin.Context) {
+	var req createWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		UnprocessableEntityResponse(c, err.Error())
+		return
+	}
+	webhook, err := app.artifactory.CreateWebhook(req.URL, req.Statuses)
+	if errors.Is(err, artifactory.ErrInvalidWebhookURL) ||
+		errors.Is(err, artifactory.ErrInvalidWebhookStatus) {
+		UnprocessableEntityResponse(c, err.Error())
+		return
+	}
+	if err != nil {
+		ServiceUnavailableResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, webhook)
+}
+
+func (app *Application) deleteWebhook(c *gin.Context) {
+	err := app.artifactory.DeleteWebhook(c.Param("id"))
+	if errors.Is(err, artifactory.ErrWebhookNotFound) {
+		c.AbortWithStatusJSON(
+			http.StatusNotFound,
+			NewErrorResponse("webhook not found"),
+		)
+		return
+	}
+	if err != nil {
+		ServiceUnavailableResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
+
+func (app *Application) listWebhookDeliveries(c *gin.Context) {
+	app.listDeliveries(c, &artifactory.WebhookDeliveryQuery{
+		SubscriptionID: c.Param("id"),
+	})
+}
+
+func (app *Application) listJobDeliveries(c *gin.Context) {
+	app.listDeliveries(c, &artifactory.WebhookDeliveryQuery{
+		BuildJobID: c.Param("id"),
+	})
+}
+
+func (app *Application) listDeliveries(c *gin.Context, query *artifactory.WebhookDeliveryQuery) {
+	deliveries, err := app.artifactory.ListWebhookDeliveries(query)
+	if err != nil {
+		ServiceUnavailableResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
@@ -1,10 +1,17 @@
 package source
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
+	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/edgetx/cloudbuild/buildlogs"
 	"github.com/ldez/go-git-cmd-wrapper/v2/checkout"
@@ -16,19 +23,30 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// ErrSubmodules is returned when the sources are fetched, but not their submodules.
+var ErrSubmodules = errors.New("failed to fetch git submodules")
+
 type GitDownloader struct {
 	GitExecutor types.Executor
-	stdOutput   *buildlogs.Recorder
+	// Mirrors are used to fetch the sources when set.
+	Mirrors    *Mirrors
+	workingDir string
+	stdOutput  *buildlogs.Recorder
+	// releases free the mirrors borrowed by the sources, see Close.
+	releases []func()
 }
 
 func NewGitDownloader(workingDir string, stdOutput *buildlogs.Recorder) *GitDownloader {
 	return &GitDownloader{
-		GitExecutor: DefaultGitExecutor(workingDir),
+		GitExecutor: DefaultGitExecutor(workingDir, stdOutput),
+		workingDir:  workingDir,
 		stdOutput:   stdOutput,
 	}
 }
 
-func DefaultGitExecutor(workingDir string) types.Executor {
+// DefaultGitExecutor runs git and copies its output to stdOutput
+// while the command is running.
+func DefaultGitExecutor(workingDir string, stdOutput io.Writer) types.Executor {
 	return func(ctx context.Context, name string, debug bool, args ...string) (string, error) {
 		log.Tracef("git cmd: %s %s", name, args)
 		cmd := exec.CommandContext(ctx, name, args...)
@@ -39,8 +57,11 @@ func DefaultGitExecutor(workingDir string) types.Executor {
 				fmt.Sprintf("GIT_DIR=%s", path.Join(workingDir, ".git")),
 			}
 		}
-		output, err := cmd.CombinedOutput()
-		return string(output), err
+		var output bytes.Buffer
+		cmd.Stdout = io.MultiWriter(&output, stdOutput)
+		cmd.Stderr = cmd.Stdout
+		err := cmd.Run()
+		return output.String(), err
 	}
 }
 
@@ -50,7 +71,6 @@ func (downloader *GitDownloader) init(ctx context.Context) error {
 		git.CmdExecutor(downloader.GitExecutor),
 		ginit.Directory("."),
 	)
-	downloader.stdOutput.AddStdOut(output)
 	log.Debugf("git init output: %s", output)
 	return err
 }
@@ -61,7 +81,6 @@ func (downloader *GitDownloader) addRemote(ctx context.Context, repository strin
 		git.CmdExecutor(downloader.GitExecutor),
 		remote.Add("origin", repository),
 	)
-	downloader.stdOutput.AddStdOut(output)
 	log.Debugf("git init output: %s", output)
 	return err
 }
@@ -78,7 +97,6 @@ func (downloader *GitDownloader) fetch(ctx context.Context, ref string) error {
 		fetch.Remote("origin"),
 		fetch.RefSpec(ref),
 	)
-	downloader.stdOutput.AddStdOut(output)
 	log.Debugf("git fetch output: %s", output)
 	return err
 }
@@ -89,7 +107,6 @@ func (downloader *GitDownloader) checkout(ctx context.Context, ref string) error
 		git.CmdExecutor(downloader.GitExecutor),
 		checkout.TreeIsh(ref),
 	)
-	downloader.stdOutput.AddStdOut(output)
 	if err != nil {
 		return fmt.Errorf("failed to checkout commit: %w", err)
 	}
@@ -104,15 +121,29 @@ func (downloader *GitDownloader) updateSubmodules(ctx context.Context) error {
 		g.AddOptions("--recursive")
 		g.AddOptions("--depth=1")
 	}, git.CmdExecutor(downloader.GitExecutor), git.Debugger(true))
-	downloader.stdOutput.AddStdOut(output)
 	log.Debugf("git submodules update output: %s", output)
 	if err != nil {
-		return fmt.Errorf("failed to fetch git submodules: %w", err)
+		return fmt.Errorf("%w: %w", ErrSubmodules, err)
 	}
 	return nil
 }
 
 func (downloader *GitDownloader) Download(ctx context.Context, repository string, commitID string) error {
+	if downloader.Mirrors != nil {
+		err := downloader.downloadFromMirror(ctx, repository, commitID)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		log.Warnf("failed to download from mirror, fetching %s directly: %s", repository, err)
+		if err := downloader.clean(); err != nil {
+			return err
+		}
+		_ = downloader.Close()
+	}
+	return downloader.download(ctx, repository, commitID)
+}
+
+func (downloader *GitDownloader) download(ctx context.Context, repository string, commitID string) error {
 	err := downloader.init(ctx)
 	if err != nil {
 		return err
@@ -140,3 +171,116 @@ func (downloader *GitDownloader) Download(ctx context.Context, repository string
 
 	return nil
 }
+
+// downloadFromMirror checks out commitID with objects borrowed from the mirror
+// of repository, and the submodules cloned from their own mirrors.
+func (downloader *GitDownloader) downloadFromMirror(
+	ctx context.Context, repository string, commitID string,
+) error {
+	mirror, release, err := downloader.Mirrors.Update(ctx, repository, commitID, downloader.stdOutput)
+	if err != nil {
+		return err
+	}
+	downloader.releases = append(downloader.releases, release)
+	if err := downloader.init(ctx); err != nil {
+		return err
+	}
+	if err := downloader.addRemote(ctx, repository); err != nil {
+		return err
+	}
+	alternates := filepath.Join(downloader.workingDir, ".git", "objects", "info", "alternates")
+	err = os.WriteFile(alternates, []byte(filepath.Join(mirror, "objects")+"\n"), 0o644)
+	if err != nil {
+		return err
+	}
+	output, err := downloader.GitExecutor(ctx, "git", false, "fetch", "--no-tags", mirror, commitID)
+	log.Debugf("git fetch output: %s", output)
+	if err != nil {
+		return fmt.Errorf("failed to fetch from mirror: %w", err)
+	}
+	if err := downloader.checkout(ctx, "FETCH_HEAD"); err != nil {
+		return err
+	}
+	return downloader.updateSubmodulesFromMirrors(ctx, downloader.workingDir, repository)
+}
+
+// updateSubmodulesFromMirrors clones the submodules of dir, recursively,
+// from their mirrors. repository is the URL of dir, to which submodule
+// URLs may be relative.
+func (downloader *GitDownloader) updateSubmodulesFromMirrors(
+	ctx context.Context, dir string, repository string,
+) error {
+	submodules, err := listSubmodules(ctx, dir)
+	if err != nil {
+		return err
+	}
+	for _, sub := range submodules {
+		subURL := resolveSubmoduleURL(repository, sub.url)
+		commitID, err := submoduleCommit(ctx, dir, sub.path)
+		if err != nil {
+			return err
+		}
+		mirror, release, err := downloader.Mirrors.Update(ctx, subURL, commitID, downloader.stdOutput)
+		if err != nil {
+			return fmt.Errorf("failed to mirror submodule %s: %w", sub.name, err)
+		}
+		downloader.releases = append(downloader.releases, release)
+		// submodule init keeps the URL already configured
+		err = runGit(ctx, dir, downloader.stdOutput,
+			"config", fmt.Sprintf("submodule.%s.url", sub.name), mirror,
+		)
+		if err != nil {
+			return err
+		}
+		err = runGit(ctx, dir, downloader.stdOutput,
+			"-c", "protocol.file.allow=always",
+			"submodule", "update", "--init", "--", sub.path,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to clone submodule %s: %w", sub.name, err)
+		}
+		err = downloader.updateSubmodulesFromMirrors(ctx, filepath.Join(dir, sub.path), subURL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases the mirrors the downloaded sources borrow objects from,
+// once the sources are removed.
+func (downloader *GitDownloader) Close() error {
+	for _, release := range downloader.releases {
+		release()
+	}
+	downloader.releases = nil
+	return nil
+}
+
+// resolveSubmoduleURL resolves a submodule URL relative to the URL
+// of its parent repository, as git does.
+func resolveSubmoduleURL(repository string, subURL string) string {
+	if !strings.HasPrefix(subURL, "./") && !strings.HasPrefix(subURL, "../") {
+		return subURL
+	}
+	base, err := url.Parse(repository)
+	if err != nil {
+		return subURL
+	}
+	base.Path = path.Join(base.Path, subURL)
+	return base.String()
+}
+
+// clean removes everything from the working directory.
+func (downloader *GitDownloader) clean() error {
+	entries, err := os.ReadDir(downloader.workingDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(downloader.workingDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/edgetx/cloudbuild/buildlogs"
+)
+
+// LocalDownloader copies the sources from a local fixture directory,
+// whatever the repository and commit, for tests and local development.
+type LocalDownloader struct {
+	fixtureDir string
+	workingDir string
+	stdOutput  *buildlogs.Recorder
+}
+
+func NewLocalDownloader(fixtureDir string, workingDir string, stdOutput *buildlogs.Recorder) *LocalDownloader {
+	return &LocalDownloader{
+		fixtureDir: fixtureDir,
+		workingDir: workingDir,
+		stdOutput:  stdOutput,
+	}
+}
+
+func (downloader *LocalDownloader) Download(ctx context.Context, repository string, commitID string) error {
+	downloader.stdOutput.AddStdOut(fmt.Sprintf(
+		"using %s as %s@%s\n", downloader.fixtureDir, repository, commitID,
+	))
+	return filepath.WalkDir(downloader.fixtureDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(downloader.fixtureDir, path)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		dst := filepath.Join(downloader.workingDir, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(dst, 0o755)
+		}
+		return copyFile(path, dst)
+	})
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
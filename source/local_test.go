@@ -0,0 +1,32 @@
+package source_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/edgetx/cloudbuild/buildlogs"
+	"github.com/edgetx/cloudbuild/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalDownloader(t *testing.T) {
+	fixture := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(fixture, "tools"), 0o755))
+	assert.Nil(t, os.MkdirAll(filepath.Join(fixture, ".git"), 0o755))
+	assert.Nil(t, os.WriteFile(filepath.Join(fixture, "tools", "build-gh.sh"), []byte("#!/bin/sh"), 0o755))
+	assert.Nil(t, os.WriteFile(filepath.Join(fixture, ".git", "HEAD"), []byte("ref"), 0o644))
+
+	workingDir := t.TempDir()
+	recorder := buildlogs.NewRecorder()
+	downloader := source.NewLocalDownloader(fixture, workingDir, recorder)
+	err := downloader.Download(context.Background(), "https://github.com/EdgeTX/edgetx.git", "main")
+	assert.Nil(t, err)
+
+	info, err := os.Stat(filepath.Join(workingDir, "tools", "build-gh.sh"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+	assert.NoDirExists(t, filepath.Join(workingDir, ".git"))
+	assert.Contains(t, recorder.Logs(), "edgetx.git@main")
+}
@@ -0,0 +1,268 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Mirrors keeps a bare mirror of every repository fetched by the worker,
+// so that builds only download what changed since the previous build.
+// The mirrors are locked while they are refreshed, and while the sources
+// of a build borrow their objects, also against other processes sharing
+// the same directory.
+type Mirrors struct {
+	dir   string
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func NewMirrors(dir string) (*Mirrors, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mirrors directory: %w", err)
+	}
+	return &Mirrors{
+		dir:   dir,
+		locks: make(map[string]*sync.Mutex),
+	}, nil
+}
+
+// Path returns the directory of the mirror of repository.
+func (mirrors *Mirrors) Path(repository string) string {
+	sum := sha256.Sum256([]byte(repository))
+	return filepath.Join(mirrors.dir, hex.EncodeToString(sum[:8])+".git")
+}
+
+// lock serializes the updates of the mirror at dir, and returns its unlock function.
+func (mirrors *Mirrors) lock(dir string) (func(), error) {
+	mirrors.mu.Lock()
+	mu, ok := mirrors.locks[dir]
+	if !ok {
+		mu = &sync.Mutex{}
+		mirrors.locks[dir] = mu
+	}
+	mirrors.mu.Unlock()
+
+	mu.Lock()
+	unlock, err := lockFile(dir+".lock", syscall.LOCK_EX)
+	if err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		unlock()
+		mu.Unlock()
+	}, nil
+}
+
+// lockFile locks the file at path with flock, and returns its unlock function.
+// The locks of different open files conflict, even within the same process.
+func lockFile(path string, how int) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), how); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+// Update refreshes the mirror of repository until it contains commitID,
+// and returns its directory with the function releasing it. The mirror is
+// not removed until released, as the sources cloned from it borrow its objects.
+// A corrupt mirror is removed, unless borrowed, so that the next update
+// starts from scratch; a mirror that failed to fetch is kept.
+func (mirrors *Mirrors) Update(
+	ctx context.Context, repository string, commitID string, output io.Writer,
+) (string, func(), error) {
+	dir := mirrors.Path(repository)
+	unlock, err := mirrors.lock(dir)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to lock mirror: %w", err)
+	}
+	defer unlock()
+
+	err = updateMirror(ctx, dir, repository, commitID, output)
+	if err != nil {
+		if ctx.Err() == nil && isCorrupt(ctx, dir) {
+			log.Warnf("removing corrupt mirror of %s: %s", repository, err)
+			if removeErr := removeMirror(dir); removeErr != nil {
+				log.Warnf("failed to remove mirror of %s: %s", repository, removeErr)
+			}
+		}
+		return dir, nil, err
+	}
+	release, err := lockFile(dir+".use", syscall.LOCK_SH)
+	if err != nil {
+		return dir, nil, fmt.Errorf("failed to lock mirror: %w", err)
+	}
+	return dir, release, nil
+}
+
+// isCorrupt returns true if the mirror at dir exists but git cannot use it.
+func isCorrupt(ctx context.Context, dir string) bool {
+	if _, err := os.Stat(dir); err != nil {
+		return false
+	}
+	if runGit(ctx, "", io.Discard, "--git-dir", dir, "rev-parse", "--git-dir") != nil {
+		return true
+	}
+	return runGit(ctx, "", io.Discard, "--git-dir", dir, "fsck", "--connectivity-only", "--no-dangling") != nil
+}
+
+// removeMirror removes the mirror at dir, unless sources still borrow its objects.
+func removeMirror(dir string) error {
+	unlock, err := lockFile(dir+".use", syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		return fmt.Errorf("mirror in use: %w", err)
+	}
+	defer unlock()
+	return os.RemoveAll(dir)
+}
+
+func updateMirror(
+	ctx context.Context, dir string, repository string, commitID string, output io.Writer,
+) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := createMirror(ctx, dir, repository, output); err != nil {
+			// nothing borrows from a mirror being created
+			_ = os.RemoveAll(dir)
+			return fmt.Errorf("failed to create mirror: %w", err)
+		}
+	}
+	if hasCommit(ctx, dir, commitID) {
+		return nil
+	}
+	err := runGit(ctx, dir, output,
+		"fetch", "--prune", "--progress", "origin",
+		"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*",
+	)
+	if err != nil {
+		return fmt.Errorf("failed to fetch mirror: %w", err)
+	}
+	if hasCommit(ctx, dir, commitID) {
+		return nil
+	}
+	// commits that are not on a branch (e.g. pinned submodules) are kept
+	// under their own ref, so that local clones of the mirror get them
+	err = runGit(ctx, dir, output,
+		"fetch", "--progress", "origin",
+		fmt.Sprintf("+%s:refs/pinned/%s", commitID, commitID),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to fetch commit %s: %w", commitID, err)
+	}
+	return nil
+}
+
+func createMirror(ctx context.Context, dir string, repository string, output io.Writer) error {
+	if err := runGit(ctx, "", output, "init", "--bare", dir); err != nil {
+		return err
+	}
+	// the builds borrow objects from the mirror, which must never lose them
+	if err := runGit(ctx, dir, output, "config", "gc.auto", "0"); err != nil {
+		return err
+	}
+	return runGit(ctx, dir, output, "remote", "add", "origin", repository)
+}
+
+func hasCommit(ctx context.Context, dir string, commitID string) bool {
+	return runGit(ctx, dir, io.Discard, "cat-file", "-e", commitID+"^{commit}") == nil
+}
+
+// runGit runs git in dir, or in the current directory when dir is empty.
+func runGit(ctx context.Context, dir string, output io.Writer, args ...string) error {
+	log.Tracef("git cmd: %s", args)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = output
+	cmd.Stderr = output
+	return cmd.Run()
+}
+
+// gitOutput runs git in dir and returns its standard output.
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &out
+	err := cmd.Run()
+	return out.String(), err
+}
+
+type submodule struct {
+	name string
+	path string
+	url  string
+}
+
+// listSubmodules returns the submodules declared in the .gitmodules of dir.
+func listSubmodules(ctx context.Context, dir string) ([]submodule, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".gitmodules")); os.IsNotExist(err) {
+		return nil, nil
+	}
+	out, err := gitOutput(ctx, dir,
+		"config", "--file", ".gitmodules", "--get-regexp", `^submodule\..*\.(path|url)$`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .gitmodules: %w", err)
+	}
+	var names []string
+	byName := make(map[string]*submodule)
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), " ")
+		if !found {
+			continue
+		}
+		key = strings.TrimPrefix(key, "submodule.")
+		dot := strings.LastIndexByte(key, '.')
+		name, field := key[:dot], key[dot+1:]
+		sub, ok := byName[name]
+		if !ok {
+			sub = &submodule{name: name}
+			byName[name] = sub
+			names = append(names, name)
+		}
+		if field == "path" {
+			sub.path = value
+		} else {
+			sub.url = value
+		}
+	}
+	submodules := make([]submodule, 0, len(names))
+	for _, name := range names {
+		submodules = append(submodules, *byName[name])
+	}
+	return submodules, nil
+}
+
+// submoduleCommit returns the commit a submodule is pinned to.
+func submoduleCommit(ctx context.Context, dir string, path string) (string, error) {
+	out, err := gitOutput(ctx, dir, "ls-tree", "HEAD", path)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(out)
+	if len(fields) < 3 || fields[1] != "commit" {
+		return "", fmt.Errorf("submodule %s not found in tree", path)
+	}
+	return fields[2], nil
+}
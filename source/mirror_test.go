@@ -0,0 +1,155 @@
+package source_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/edgetx/cloudbuild/buildlogs"
+	"github.com/edgetx/cloudbuild/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func gitRun(t *testing.T, dir string, args ...string) string {
+	args = append([]string{
+		"-c", "user.name=test", "-c", "user.email=test@example.com",
+		"-c", "protocol.file.allow=always", "-c", "init.defaultBranch=main",
+	}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	assert.Nil(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+func commitFile(t *testing.T, dir, name, content string) string {
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	gitRun(t, dir, "add", ".")
+	gitRun(t, dir, "commit", "-m", name)
+	return gitRun(t, dir, "rev-parse", "HEAD")
+}
+
+func newRepository(t *testing.T) string {
+	dir := t.TempDir()
+	gitRun(t, dir, "init", ".")
+	return dir
+}
+
+func download(t *testing.T, mirrors *source.Mirrors, repository, commitID string) (string, error) {
+	dir := t.TempDir()
+	downloader := source.NewGitDownloader(dir, buildlogs.NewRecorder())
+	downloader.Mirrors = mirrors
+	t.Cleanup(func() { _ = downloader.Close() })
+	return dir, downloader.Download(context.Background(), repository, commitID)
+}
+
+func TestDownloadFromMirror(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	lib := newRepository(t)
+	commitFile(t, lib, "lib.h", "v1")
+	repo := newRepository(t)
+	commitFile(t, repo, "main.c", "v1")
+	gitRun(t, repo, "submodule", "add", lib, "lib")
+	gitRun(t, repo, "commit", "-m", "add lib")
+	first := gitRun(t, repo, "rev-parse", "HEAD")
+
+	mirrors, err := source.NewMirrors(t.TempDir())
+	assert.Nil(t, err)
+	dir, err := download(t, mirrors, repo, first)
+	assert.Nil(t, err)
+	assert.FileExists(t, filepath.Join(dir, "main.c"))
+	assert.FileExists(t, filepath.Join(dir, "lib", "lib.h"))
+	assert.DirExists(t, mirrors.Path(repo))
+	assert.DirExists(t, mirrors.Path(lib))
+
+	// the mirror is refreshed with the new commits
+	second := commitFile(t, repo, "main.c", "v2")
+	dir, err = download(t, mirrors, repo, second)
+	assert.Nil(t, err)
+	content, err := os.ReadFile(filepath.Join(dir, "main.c"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", string(content))
+	assert.FileExists(t, filepath.Join(dir, "lib", "lib.h"))
+}
+
+func TestDownloadWithCorruptMirror(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo := newRepository(t)
+	commitID := commitFile(t, repo, "main.c", "v1")
+	repository := "file://" + repo
+
+	mirrors, err := source.NewMirrors(t.TempDir())
+	assert.Nil(t, err)
+	assert.Nil(t, os.MkdirAll(mirrors.Path(repository), 0o755))
+	assert.Nil(t, os.WriteFile(filepath.Join(mirrors.Path(repository), "HEAD"), []byte("garbage"), 0o644))
+
+	// the sources are fetched directly, and the mirror is removed
+	dir, err := download(t, mirrors, repository, commitID)
+	assert.Nil(t, err)
+	assert.FileExists(t, filepath.Join(dir, "main.c"))
+	assert.NoDirExists(t, mirrors.Path(repository))
+
+	// and created again on the next download
+	_, err = download(t, mirrors, repository, commitID)
+	assert.Nil(t, err)
+	assert.DirExists(t, mirrors.Path(repository))
+}
+
+func TestDownloadKeepsMirrorOnFetchError(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo := newRepository(t)
+	commitID := commitFile(t, repo, "main.c", "v1")
+	repository := "file://" + repo
+
+	mirrors, err := source.NewMirrors(t.TempDir())
+	assert.Nil(t, err)
+	_, err = download(t, mirrors, repository, commitID)
+	assert.Nil(t, err)
+
+	// the repository is unreachable, the mirror is kept for the next builds
+	assert.Nil(t, os.Rename(repo, repo+".moved"))
+	_, err = download(t, mirrors, repository, strings.Repeat("0", 40))
+	assert.Error(t, err)
+	assert.DirExists(t, mirrors.Path(repository))
+
+	assert.Nil(t, os.Rename(repo+".moved", repo))
+	_, err = download(t, mirrors, repository, commitID)
+	assert.Nil(t, err)
+}
+
+func TestCorruptMirrorKeptWhileBorrowed(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo := newRepository(t)
+	first := commitFile(t, repo, "main.c", "v1")
+	repository := "file://" + repo
+
+	mirrors, err := source.NewMirrors(t.TempDir())
+	assert.Nil(t, err)
+	borrower := source.NewGitDownloader(t.TempDir(), buildlogs.NewRecorder())
+	borrower.Mirrors = mirrors
+	assert.Nil(t, borrower.Download(context.Background(), repository, first))
+
+	// the sources of the first download still borrow objects from the mirror
+	second := commitFile(t, repo, "main.c", "v2")
+	mirrorHead := filepath.Join(mirrors.Path(repository), "HEAD")
+	assert.Nil(t, os.WriteFile(mirrorHead, []byte("garbage"), 0o644))
+	_, err = download(t, mirrors, repository, second)
+	assert.Nil(t, err)
+	assert.DirExists(t, mirrors.Path(repository))
+
+	assert.Nil(t, borrower.Close())
+	_, err = download(t, mirrors, repository, second)
+	assert.Nil(t, err)
+	assert.NoDirExists(t, mirrors.Path(repository))
+}
@@ -2,8 +2,14 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
 	"os"
 	"path"
+	"strings"
 )
 
 type FileSystemStorage struct {
@@ -16,6 +22,94 @@ func NewLocalStorage(storageFolder string) *FileSystemStorage {
 	}
 }
 
-func (storage *FileSystemStorage) Upload(ctx context.Context, data []byte, fileName string) error {
-	return os.WriteFile(path.Join(storage.storageFolder, fileName), data, 0o600)
+// Upload writes data to a temporary file first and renames it once
+// complete, so that a partially written object is never visible.
+func (storage *FileSystemStorage) Upload(
+	ctx context.Context, data io.Reader, size int64, contentType string, fileName string,
+) error {
+	tmpFile, err := os.CreateTemp(storage.storageFolder, "."+fileName+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpName := tmpFile.Name()
+	defer os.Remove(tmpName)
+
+	written, err := io.Copy(tmpFile, data)
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("%w: wrote %d of %d bytes", ErrShortWrite, written, size)
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpName, path.Join(storage.storageFolder, fileName))
+}
+
+func (storage *FileSystemStorage) Delete(ctx context.Context, fileName string) error {
+	err := os.Remove(path.Join(storage.storageFolder, fileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (storage *FileSystemStorage) List(ctx context.Context) ([]ObjectInfo, error) {
+	entries, err := os.ReadDir(storage.storageFolder)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]ObjectInfo, 0, len(entries))
+	for _, entry := range entries {
+		// skip directories and uploads in progress
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		objects = append(objects, ObjectInfo{
+			Name:       entry.Name(),
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime(),
+		})
+	}
+	return objects, nil
+}
+
+func (storage *FileSystemStorage) Open(ctx context.Context, fileName string) (*Object, error) {
+	if fileName == "" || strings.HasPrefix(fileName, ".") || strings.ContainsRune(fileName, '/') {
+		return nil, ErrObjectNotFound
+	}
+	file, err := os.Open(path.Join(storage.storageFolder, fileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err == nil && !info.Mode().IsRegular() {
+		err = ErrObjectNotFound
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	contentType := mime.TypeByExtension(path.Ext(fileName))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &Object{
+		ReadSeekCloser: file,
+		ObjectInfo: ObjectInfo{
+			Name:       fileName,
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime(),
+		},
+		ContentType: contentType,
+	}, nil
 }
@@ -1,7 +1,9 @@
 package storage_test
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"os"
 	"path"
 	"testing"
@@ -11,15 +13,80 @@ import (
 )
 
 func TestFileSystemStorage(t *testing.T) {
-	storageFolder := "/tmp"
+	storageFolder := t.TempDir()
 	artifactStorage := storage.NewLocalStorage(storageFolder)
-
 	fileName := "f79982d9968ef7fe4c5c23d9b9e9b200f30e38c28f68601973b98cf702c952e9.bin"
 	data := []byte("bob")
-	err := artifactStorage.Upload(context.Background(), data, fileName)
+	err := artifactStorage.Upload(
+		context.Background(), bytes.NewReader(data), int64(len(data)),
+		"application/octet-stream", fileName,
+	)
 	assert.Nil(t, err)
 
 	fileInfo, err := os.Stat(path.Join(storageFolder, fileName))
 	assert.Nil(t, err)
 	assert.Equal(t, int64(len(data)), fileInfo.Size())
+
+	// no temporary file left behind
+	entries, err := os.ReadDir(storageFolder)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+
+	stored, err := artifactStorage.Open(context.Background(), fileName)
+	assert.Nil(t, err)
+	defer stored.Close()
+	assert.Equal(t, int64(len(data)), stored.Size)
+	assert.Equal(t, "application/octet-stream", stored.ContentType)
+	content, err := io.ReadAll(stored)
+	assert.Nil(t, err)
+	assert.Equal(t, data, content)
+
+	_, err = artifactStorage.Open(context.Background(), "missing.bin")
+	assert.ErrorIs(t, err, storage.ErrObjectNotFound)
+	_, err = artifactStorage.Open(context.Background(), "..")
+	assert.ErrorIs(t, err, storage.ErrObjectNotFound)
+}
+
+func TestFileSystemStorageShortWrite(t *testing.T) {
+	storageFolder := t.TempDir()
+	artifactStorage := storage.NewLocalStorage(storageFolder)
+	fileName := "short.bin"
+	err := artifactStorage.Upload(
+		context.Background(), bytes.NewReader([]byte("bob")), 10,
+		"application/octet-stream", fileName,
+	)
+	assert.ErrorIs(t, err, storage.ErrShortWrite)
+
+	_, err = os.Stat(path.Join(storageFolder, fileName))
+	assert.True(t, os.IsNotExist(err))
+	entries, err := os.ReadDir(storageFolder)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 0)
+}
+
+func TestFileSystemStorageListAndDelete(t *testing.T) {
+	storageFolder := t.TempDir()
+	artifactStorage := storage.NewLocalStorage(storageFolder)
+	ctx := context.Background()
+	for _, fileName := range []string{"a.bin", "b.bin"} {
+		err := artifactStorage.Upload(
+			ctx, bytes.NewReader([]byte("bob")), 3, "application/octet-stream", fileName,
+		)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, os.Mkdir(path.Join(storageFolder, "subdir"), 0o700))
+
+	objects, err := artifactStorage.List(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, objects, 2)
+	assert.Equal(t, "a.bin", objects[0].Name)
+	assert.Equal(t, int64(3), objects[0].Size)
+
+	assert.Nil(t, artifactStorage.Delete(ctx, "a.bin"))
+	assert.Nil(t, artifactStorage.Delete(ctx, "a.bin"))
+
+	objects, err = artifactStorage.List(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, objects, 1)
+	assert.Equal(t, "b.bin", objects[0].Name)
 }
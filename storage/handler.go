@@ -2,6 +2,9 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"io"
+	"time"
 
 	"github.com/edgetx/cloudbuild/config"
 )
@@ -11,8 +14,52 @@ const (
 	StorageTypeLFS = "FILE_SYSTEM_STORAGE"
 )
 
+var (
+	ErrShortWrite     = errors.New("short write")
+	ErrNoPresigner    = errors.New("storage cannot presign URLs")
+	ErrObjectNotFound = errors.New("object not found")
+	ErrInvalidOffset  = errors.New("invalid offset")
+)
+
 type Handler interface {
-	Upload(context context.Context, data []byte, fileName string) error
+	// Upload stores size bytes read from data under fileName.
+	// A negative size means unknown.
+	Upload(
+		context context.Context,
+		data io.Reader,
+		size int64,
+		contentType string,
+		fileName string,
+	) error
+	// Delete removes fileName, it is not an error if it does not exist.
+	Delete(ctx context.Context, fileName string) error
+	// List returns all stored objects.
+	List(ctx context.Context) ([]ObjectInfo, error)
+	// Open returns a seekable reader on fileName, or ErrObjectNotFound.
+	Open(ctx context.Context, fileName string) (*Object, error)
+}
+
+// Presigner is implemented by storages able to issue
+// time-limited download URLs. The file is saved as downloadName.
+type Presigner interface {
+	PresignURL(
+		ctx context.Context, fileName string, downloadName string, expires time.Duration,
+	) (string, error)
+}
+
+type ObjectInfo struct {
+	Name       string
+	Size       int64
+	ModifiedAt time.Time
+}
+
+// Object is an opened stored object.
+type Object struct {
+	io.ReadSeekCloser
+	ObjectInfo
+	ContentType string
+	// ETag is empty when the storage does not provide one.
+	ETag string
 }
 
 func NewFromConfig(ctx context.Context, c *config.CloudbuildOpts) Handler {
@@ -3,35 +3,107 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	awsCfg "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/edgetx/cloudbuild/config"
 	log "github.com/sirupsen/logrus"
 )
 
-type PutObjectToS3 interface {
+const (
+	// objects larger than this are sent with a multipart upload.
+	s3MultipartThreshold = 16 * 1024 * 1024
+	s3PartSize           = 8 * 1024 * 1024
+)
+
+type S3Client interface {
 	PutObject(
 		ctx context.Context,
 		params *s3.PutObjectInput,
 		optFns ...func(*s3.Options),
 	) (*s3.PutObjectOutput, error)
+	CreateMultipartUpload(
+		ctx context.Context,
+		params *s3.CreateMultipartUploadInput,
+		optFns ...func(*s3.Options),
+	) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(
+		ctx context.Context,
+		params *s3.UploadPartInput,
+		optFns ...func(*s3.Options),
+	) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(
+		ctx context.Context,
+		params *s3.CompleteMultipartUploadInput,
+		optFns ...func(*s3.Options),
+	) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(
+		ctx context.Context,
+		params *s3.AbortMultipartUploadInput,
+		optFns ...func(*s3.Options),
+	) (*s3.AbortMultipartUploadOutput, error)
+	DeleteObject(
+		ctx context.Context,
+		params *s3.DeleteObjectInput,
+		optFns ...func(*s3.Options),
+	) (*s3.DeleteObjectOutput, error)
+	ListObjectsV2(
+		ctx context.Context,
+		params *s3.ListObjectsV2Input,
+		optFns ...func(*s3.Options),
+	) (*s3.ListObjectsV2Output, error)
+	HeadObject(
+		ctx context.Context,
+		params *s3.HeadObjectInput,
+		optFns ...func(*s3.Options),
+	) (*s3.HeadObjectOutput, error)
+	GetObject(
+		ctx context.Context,
+		params *s3.GetObjectInput,
+		optFns ...func(*s3.Options),
+	) (*s3.GetObjectOutput, error)
+}
+
+type S3Presigner interface {
+	PresignGetObject(
+		ctx context.Context,
+		params *s3.GetObjectInput,
+		optFns ...func(*s3.PresignOptions),
+	) (*v4.PresignedHTTPRequest, error)
 }
 
 type S3ArtifactStorage struct {
-	bucket string
-	s3     PutObjectToS3
+	bucket    string
+	s3        S3Client
+	acl       types.ObjectCannedACL
+	presigner S3Presigner
 }
 
-func NewS3ArtifactStorage(bucket string, s3 PutObjectToS3) *S3ArtifactStorage {
+func NewS3ArtifactStorage(bucket string, s3 S3Client) *S3ArtifactStorage {
 	return &S3ArtifactStorage{
 		bucket: bucket,
 		s3:     s3,
+		acl:    types.ObjectCannedACLPublicRead,
 	}
 }
 
+// WithPrivateACL stores new objects with a private ACL, they can then
+// only be downloaded with presigned URLs.
+func (storage *S3ArtifactStorage) WithPrivateACL(presigner S3Presigner) *S3ArtifactStorage {
+	storage.acl = types.ObjectCannedACLPrivate
+	storage.presigner = presigner
+	return storage
+}
+
 func NewS3ArtifactStorageFromConfig(
 	ctx context.Context, c *config.CloudbuildOpts,
 ) *S3ArtifactStorage {
@@ -58,17 +130,258 @@ func NewS3ArtifactStorageFromConfig(
 	}
 	s3Client := s3.NewFromConfig(cfg)
 
-	return NewS3ArtifactStorage(c.StorageS3Bucket, s3Client)
+	artifactStorage := NewS3ArtifactStorage(c.StorageS3Bucket, s3Client)
+	if c.DownloadMode != config.DownloadModePublic {
+		artifactStorage.WithPrivateACL(s3.NewPresignClient(s3Client))
+	}
+	return artifactStorage
+}
+
+func (storage *S3ArtifactStorage) Upload(
+	ctx context.Context, data io.Reader, size int64, contentType string, fileName string,
+) error {
+	if size >= 0 && size <= s3MultipartThreshold {
+		return storage.putObject(ctx, data, size, contentType, fileName)
+	}
+	return storage.multipartUpload(ctx, data, contentType, fileName)
 }
 
-func (storage *S3ArtifactStorage) Upload(ctx context.Context, data []byte, fileName string) error {
+func (storage *S3ArtifactStorage) putObject(
+	ctx context.Context, data io.Reader, size int64, contentType string, fileName string,
+) error {
 	input := &s3.PutObjectInput{
+		Bucket:        aws.String(storage.bucket),
+		Key:           aws.String(fileName),
+		Body:          data,
+		ContentLength: size,
+		ContentType:   aws.String(contentType),
+		ACL:           storage.acl,
+	}
+	var optFns []func(*s3.Options)
+	if _, ok := data.(io.ReadSeeker); !ok {
+		// signing the payload would need to read it twice:
+		// stream it unsigned instead of buffering it
+		optFns = append(optFns, s3.WithAPIOptions(v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware))
+	}
+	_, err := storage.s3.PutObject(ctx, input, optFns...)
+	return err
+}
+
+func (storage *S3ArtifactStorage) multipartUpload(
+	ctx context.Context, data io.Reader, contentType string, fileName string,
+) error {
+	upload, err := storage.s3.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(storage.bucket),
+		Key:         aws.String(fileName),
+		ContentType: aws.String(contentType),
+		ACL:         storage.acl,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+
+	parts, err := storage.uploadParts(ctx, data, fileName, upload.UploadId)
+	if err == nil {
+		_, err = storage.s3.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(storage.bucket),
+			Key:             aws.String(fileName),
+			UploadId:        upload.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+	if err != nil {
+		_, abortErr := storage.s3.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(storage.bucket),
+			Key:      aws.String(fileName),
+			UploadId: upload.UploadId,
+		})
+		if abortErr != nil {
+			log.Errorf("failed to abort multipart upload of %s: %s", fileName, abortErr)
+		}
+		return fmt.Errorf("failed multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (storage *S3ArtifactStorage) uploadParts(
+	ctx context.Context, data io.Reader, fileName string, uploadID *string,
+) ([]types.CompletedPart, error) {
+	var parts []types.CompletedPart
+	buf := make([]byte, s3PartSize)
+	for partNumber := int32(1); ; partNumber++ {
+		n, readErr := io.ReadFull(data, buf)
+		if errors.Is(readErr, io.EOF) && partNumber > 1 {
+			return parts, nil
+		}
+		if readErr != nil && !errors.Is(readErr, io.EOF) && !errors.Is(readErr, io.ErrUnexpectedEOF) {
+			return nil, readErr
+		}
+
+		part, err := storage.s3.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        aws.String(storage.bucket),
+			Key:           aws.String(fileName),
+			UploadId:      uploadID,
+			PartNumber:    partNumber,
+			Body:          bytes.NewReader(buf[:n]),
+			ContentLength: int64(n),
+		})
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, types.CompletedPart{
+			ETag:       part.ETag,
+			PartNumber: partNumber,
+		})
+
+		if readErr != nil {
+			// last (short) part
+			return parts, nil
+		}
+	}
+}
+
+func (storage *S3ArtifactStorage) PresignURL(
+	ctx context.Context, fileName string, downloadName string, expires time.Duration,
+) (string, error) {
+	if storage.presigner == nil {
+		return "", ErrNoPresigner
+	}
+	input := &s3.GetObjectInput{
 		Bucket: aws.String(storage.bucket),
 		Key:    aws.String(fileName),
-		Body:   bytes.NewReader(data),
-		ACL:    "public-read",
 	}
+	if downloadName != "" {
+		input.ResponseContentDisposition = aws.String(mime.FormatMediaType(
+			"attachment", map[string]string{"filename": downloadName},
+		))
+	}
+	req, err := storage.presigner.PresignGetObject(ctx, input, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign %s: %w", fileName, err)
+	}
+	return req.URL, nil
+}
 
-	_, err := storage.s3.PutObject(ctx, input)
+func (storage *S3ArtifactStorage) Delete(ctx context.Context, fileName string) error {
+	_, err := storage.s3.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(storage.bucket),
+		Key:    aws.String(fileName),
+	})
 	return err
 }
+
+func (storage *S3ArtifactStorage) List(ctx context.Context) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	paginator := s3.NewListObjectsV2Paginator(storage.s3, &s3.ListObjectsV2Input{
+		Bucket: aws.String(storage.bucket),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		for _, object := range page.Contents {
+			info := ObjectInfo{
+				Name: aws.ToString(object.Key),
+				Size: object.Size,
+			}
+			if object.LastModified != nil {
+				info.ModifiedAt = *object.LastModified
+			}
+			objects = append(objects, info)
+		}
+	}
+	return objects, nil
+}
+
+func (storage *S3ArtifactStorage) Open(ctx context.Context, fileName string) (*Object, error) {
+	head, err := storage.s3.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(storage.bucket),
+		Key:    aws.String(fileName),
+	})
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", fileName, err)
+	}
+	object := &Object{
+		ReadSeekCloser: &s3ObjectReader{
+			ctx:     ctx,
+			storage: storage,
+			key:     fileName,
+			size:    head.ContentLength,
+		},
+		ObjectInfo: ObjectInfo{
+			Name: fileName,
+			Size: head.ContentLength,
+		},
+		ContentType: aws.ToString(head.ContentType),
+		ETag:        aws.ToString(head.ETag),
+	}
+	if head.LastModified != nil {
+		object.ModifiedAt = *head.LastModified
+	}
+	return object, nil
+}
+
+// s3ObjectReader fetches the object lazily from the current offset,
+// so that seeking (e.g. to serve a range) does not download everything.
+type s3ObjectReader struct {
+	ctx     context.Context
+	storage *S3ArtifactStorage
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (reader *s3ObjectReader) Read(p []byte) (int, error) {
+	if reader.offset >= reader.size {
+		return 0, io.EOF
+	}
+	if reader.body == nil {
+		out, err := reader.storage.s3.GetObject(reader.ctx, &s3.GetObjectInput{
+			Bucket: aws.String(reader.storage.bucket),
+			Key:    aws.String(reader.key),
+			Range:  aws.String(fmt.Sprintf("bytes=%d-", reader.offset)),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to get %s: %w", reader.key, err)
+		}
+		reader.body = out.Body
+	}
+	n, err := reader.body.Read(p)
+	reader.offset += int64(n)
+	return n, err
+}
+
+func (reader *s3ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += reader.offset
+	case io.SeekEnd:
+		offset += reader.size
+	}
+	if offset < 0 {
+		return 0, ErrInvalidOffset
+	}
+	if offset != reader.offset {
+		reader.closeBody()
+		reader.offset = offset
+	}
+	return offset, nil
+}
+
+func (reader *s3ObjectReader) closeBody() {
+	if reader.body != nil {
+		reader.body.Close()
+		reader.body = nil
+	}
+}
+
+func (reader *s3ObjectReader) Close() error {
+	reader.closeBody()
+	return nil
+}
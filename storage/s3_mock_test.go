@@ -3,6 +3,7 @@ package storage_test
 import (
 	"context"
 
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/stretchr/testify/mock"
 )
@@ -23,3 +24,124 @@ func (s3MockClient *S3MockClient) PutObject(
 	}
 	return out, args.Error(1)
 }
+
+func (s3MockClient *S3MockClient) CreateMultipartUpload(
+	ctx context.Context,
+	params *s3.CreateMultipartUploadInput,
+	optFns ...func(*s3.Options),
+) (*s3.CreateMultipartUploadOutput, error) {
+	args := s3MockClient.Called(ctx, params, optFns)
+	out, ok := args.Get(0).(*s3.CreateMultipartUploadOutput)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return out, args.Error(1)
+}
+
+func (s3MockClient *S3MockClient) UploadPart(
+	ctx context.Context,
+	params *s3.UploadPartInput,
+	optFns ...func(*s3.Options),
+) (*s3.UploadPartOutput, error) {
+	args := s3MockClient.Called(ctx, params, optFns)
+	out, ok := args.Get(0).(*s3.UploadPartOutput)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return out, args.Error(1)
+}
+
+func (s3MockClient *S3MockClient) CompleteMultipartUpload(
+	ctx context.Context,
+	params *s3.CompleteMultipartUploadInput,
+	optFns ...func(*s3.Options),
+) (*s3.CompleteMultipartUploadOutput, error) {
+	args := s3MockClient.Called(ctx, params, optFns)
+	out, ok := args.Get(0).(*s3.CompleteMultipartUploadOutput)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return out, args.Error(1)
+}
+
+func (s3MockClient *S3MockClient) AbortMultipartUpload(
+	ctx context.Context,
+	params *s3.AbortMultipartUploadInput,
+	optFns ...func(*s3.Options),
+) (*s3.AbortMultipartUploadOutput, error) {
+	args := s3MockClient.Called(ctx, params, optFns)
+	out, ok := args.Get(0).(*s3.AbortMultipartUploadOutput)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return out, args.Error(1)
+}
+
+func (s3MockClient *S3MockClient) DeleteObject(
+	ctx context.Context,
+	params *s3.DeleteObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.DeleteObjectOutput, error) {
+	args := s3MockClient.Called(ctx, params, optFns)
+	out, ok := args.Get(0).(*s3.DeleteObjectOutput)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return out, args.Error(1)
+}
+
+func (s3MockClient *S3MockClient) ListObjectsV2(
+	ctx context.Context,
+	params *s3.ListObjectsV2Input,
+	optFns ...func(*s3.Options),
+) (*s3.ListObjectsV2Output, error) {
+	args := s3MockClient.Called(ctx, params, optFns)
+	out, ok := args.Get(0).(*s3.ListObjectsV2Output)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return out, args.Error(1)
+}
+
+type S3MockPresigner struct {
+	mock.Mock
+}
+
+func (s3MockPresigner *S3MockPresigner) PresignGetObject(
+	ctx context.Context,
+	params *s3.GetObjectInput,
+	optFns ...func(*s3.PresignOptions),
+) (*v4.PresignedHTTPRequest, error) {
+	args := s3MockPresigner.Called(ctx, params, optFns)
+	out, ok := args.Get(0).(*v4.PresignedHTTPRequest)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return out, args.Error(1)
+}
+
+func (s3MockClient *S3MockClient) HeadObject(
+	ctx context.Context,
+	params *s3.HeadObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.HeadObjectOutput, error) {
+	args := s3MockClient.Called(ctx, params, optFns)
+	out, ok := args.Get(0).(*s3.HeadObjectOutput)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return out, args.Error(1)
+}
+
+func (s3MockClient *S3MockClient) GetObject(
+	ctx context.Context,
+	params *s3.GetObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.GetObjectOutput, error) {
+	args := s3MockClient.Called(ctx, params, optFns)
+	out, ok := args.Get(0).(*s3.GetObjectOutput)
+	if !ok {
+		return nil, args.Error(1)
+	}
+	return out, args.Error(1)
+}
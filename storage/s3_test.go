@@ -1,10 +1,17 @@
 package storage_test
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/edgetx/cloudbuild/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -14,10 +21,148 @@ func TestS3Upload(t *testing.T) {
 	s3Mock := &S3MockClient{}
 	s3Mock.On("PutObject", mock.Anything, mock.Anything, mock.Anything).
 		Return(&s3.PutObjectOutput{}, nil)
-
 	artifactStorage := storage.NewS3ArtifactStorage("test-bucket", s3Mock)
 	fileName := "f79982d9968ef7fe4c5c23d9b9e9b200f30e38c28f68601973b98cf702c952e9.bin"
+	err := artifactStorage.Upload(
+		context.Background(), bytes.NewReader([]byte("bob")), 3,
+		"application/octet-stream", fileName,
+	)
+	assert.Nil(t, err)
+	s3Mock.AssertNumberOfCalls(t, "PutObject", 1)
+}
+
+func TestS3UploadStreamsUnseekableData(t *testing.T) {
+	s3Mock := &S3MockClient{}
+	s3Mock.On("PutObject", mock.Anything, mock.MatchedBy(func(in *s3.PutObjectInput) bool {
+		_, seekable := in.Body.(io.Seeker)
+		return !seekable && in.ContentLength == 3
+	}), mock.MatchedBy(func(optFns []func(*s3.Options)) bool {
+		return len(optFns) == 1
+	})).Return(&s3.PutObjectOutput{}, nil)
+	artifactStorage := storage.NewS3ArtifactStorage("test-bucket", s3Mock)
 
-	err := artifactStorage.Upload(context.Background(), []byte("bob"), fileName)
+	// the checksums of the artifacts are computed through a TeeReader
+	var hashed bytes.Buffer
+	err := artifactStorage.Upload(
+		context.Background(), io.TeeReader(strings.NewReader("bob"), &hashed), 3,
+		"application/octet-stream", "firmware.bin",
+	)
 	assert.Nil(t, err)
+	s3Mock.AssertNumberOfCalls(t, "PutObject", 1)
+}
+
+func TestS3MultipartUpload(t *testing.T) {
+	s3Mock := &S3MockClient{}
+	s3Mock.On("CreateMultipartUpload", mock.Anything, mock.Anything, mock.Anything).
+		Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("upload")}, nil)
+	s3Mock.On("UploadPart", mock.Anything, mock.Anything, mock.Anything).
+		Return(&s3.UploadPartOutput{ETag: aws.String("etag")}, nil)
+	s3Mock.On("CompleteMultipartUpload", mock.Anything, mock.Anything, mock.Anything).
+		Return(&s3.CompleteMultipartUploadOutput{}, nil)
+	artifactStorage := storage.NewS3ArtifactStorage("test-bucket", s3Mock)
+
+	// unknown size with 2.5 parts of data
+	data := bytes.Repeat([]byte("x"), 20*1024*1024)
+	err := artifactStorage.Upload(
+		context.Background(), bytes.NewBuffer(data), -1,
+		"application/octet-stream", "firmware.elf",
+	)
+	assert.Nil(t, err)
+	s3Mock.AssertNumberOfCalls(t, "UploadPart", 3)
+	s3Mock.AssertNumberOfCalls(t, "CompleteMultipartUpload", 1)
+	s3Mock.AssertNotCalled(t, "AbortMultipartUpload", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestS3List(t *testing.T) {
+	s3Mock := &S3MockClient{}
+	s3Mock.On("ListObjectsV2", mock.Anything, mock.Anything, mock.Anything).
+		Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{
+				{Key: aws.String("a.bin"), Size: 3},
+				{Key: aws.String("b.bin"), Size: 4},
+			},
+		}, nil)
+	artifactStorage := storage.NewS3ArtifactStorage("test-bucket", s3Mock)
+
+	objects, err := artifactStorage.List(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []storage.ObjectInfo{
+		{Name: "a.bin", Size: 3},
+		{Name: "b.bin", Size: 4},
+	}, objects)
+}
+
+func TestS3PrivateUploadAndPresign(t *testing.T) {
+	s3Mock := &S3MockClient{}
+	s3Mock.On("PutObject", mock.Anything, mock.MatchedBy(func(in *s3.PutObjectInput) bool {
+		return in.ACL == types.ObjectCannedACLPrivate
+	}), mock.Anything).Return(&s3.PutObjectOutput{}, nil)
+	presigner := &S3MockPresigner{}
+	presigner.On("PresignGetObject", mock.Anything, mock.MatchedBy(func(in *s3.GetObjectInput) bool {
+		return aws.ToString(in.Bucket) == "test-bucket" && aws.ToString(in.Key) == "firmware.bin" &&
+			aws.ToString(in.ResponseContentDisposition) == "attachment; filename=tx16s.bin"
+	}), mock.Anything).Return(&v4.PresignedHTTPRequest{URL: "https://s3/firmware.bin?X-Amz-Signature=abc"}, nil)
+
+	artifactStorage := storage.NewS3ArtifactStorage("test-bucket", s3Mock).WithPrivateACL(presigner)
+	err := artifactStorage.Upload(
+		context.Background(), bytes.NewReader([]byte("bob")), 3,
+		"application/octet-stream", "firmware.bin",
+	)
+	assert.Nil(t, err)
+	s3Mock.AssertNumberOfCalls(t, "PutObject", 1)
+
+	url, err := artifactStorage.PresignURL(
+		context.Background(), "firmware.bin", "tx16s.bin", time.Hour,
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://s3/firmware.bin?X-Amz-Signature=abc", url)
+}
+
+func TestS3PresignWithoutPresigner(t *testing.T) {
+	artifactStorage := storage.NewS3ArtifactStorage("test-bucket", &S3MockClient{})
+	_, err := artifactStorage.PresignURL(
+		context.Background(), "firmware.bin", "tx16s.bin", time.Hour,
+	)
+	assert.ErrorIs(t, err, storage.ErrNoPresigner)
+}
+
+func TestS3OpenReadsFromOffset(t *testing.T) {
+	s3Mock := &S3MockClient{}
+	s3Mock.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).
+		Return(&s3.HeadObjectOutput{
+			ContentLength: 10,
+			ContentType:   aws.String("application/octet-stream"),
+			ETag:          aws.String(`"abc"`),
+		}, nil)
+	s3Mock.On("GetObject", mock.Anything, mock.MatchedBy(func(in *s3.GetObjectInput) bool {
+		return aws.ToString(in.Range) == "bytes=6-"
+	}), mock.Anything).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(strings.NewReader("6789")),
+	}, nil)
+
+	artifactStorage := storage.NewS3ArtifactStorage("test-bucket", s3Mock)
+	object, err := artifactStorage.Open(context.Background(), "firmware.bin")
+	assert.Nil(t, err)
+	defer object.Close()
+	assert.Equal(t, int64(10), object.Size)
+	assert.Equal(t, `"abc"`, object.ETag)
+
+	end, err := object.Seek(0, io.SeekEnd)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), end)
+	_, err = object.Seek(6, io.SeekStart)
+	assert.Nil(t, err)
+	content, err := io.ReadAll(object)
+	assert.Nil(t, err)
+	assert.Equal(t, "6789", string(content))
+	s3Mock.AssertNumberOfCalls(t, "GetObject", 1)
+}
+
+func TestS3OpenMissingObject(t *testing.T) {
+	s3Mock := &S3MockClient{}
+	s3Mock.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, &types.NotFound{})
+	artifactStorage := storage.NewS3ArtifactStorage("test-bucket", s3Mock)
+	_, err := artifactStorage.Open(context.Background(), "firmware.bin")
+	assert.ErrorIs(t, err, storage.ErrObjectNotFound)
 }
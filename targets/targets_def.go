@@ -42,6 +42,7 @@ type Release struct {
 	ExcludeTargets []string `json:"exclude_targets,omitempty"`
 	BuildContainer string   `json:"build_container,omitempty"`
 	SemVer         string   `json:"sem_ver,omitempty"`
+	Platforms      []string `json:"platforms,omitempty"`
 	update         bool
 	version        *semver.Version
 }
@@ -53,17 +54,28 @@ type OptionFlag struct {
 
 type BuildFlags map[string]string
 
+type ArtifactRule struct {
+	Slug     string   `json:"slug"`
+	Patterns []string `json:"patterns"`
+	Optional bool     `json:"optional,omitempty"`
+}
+
 type Target struct {
 	Description      string             `json:"description"`
 	Tags             []string           `json:"tags,omitempty"`
 	BuildFlags       BuildFlags         `json:"build_flags,omitempty"`
+	Artifacts        []ArtifactRule     `json:"artifacts,omitempty"`
 	VersionSupported semver.Constraints `json:"version_supported,omitempty"`
+	// MinMemoryMB is the memory needed by a build of the target.
+	MinMemoryMB uint32 `json:"min_memory_mb,omitempty"`
 }
 
 type OptionFlags map[string]OptionFlag
 
 type TagDef struct {
 	Flags OptionFlags `json:"flags"`
+	// MinMemoryMB is the memory needed by a build of the tagged targets.
+	MinMemoryMB uint32 `json:"min_memory_mb,omitempty"`
 }
 
 type VersionRef struct {
@@ -75,6 +87,7 @@ type TargetsDef struct {
 	OptionFlags OptionFlags             `json:"flags"`
 	Tags        map[string]TagDef       `json:"tags"`
 	Targets     map[string]*Target      `json:"targets"`
+	Artifacts   []ArtifactRule          `json:"artifacts,omitempty"`
 	sourceURL   string
 	update      bool
 }
@@ -321,6 +334,15 @@ func (def *TargetsDef) GetTargetBuildFlags(target string) *BuildFlags {
 	return nil
 }
 
+// GetTargetArtifacts returns the artifact rules of the target,
+// or the default rules if the target does not define any.
+func (def *TargetsDef) GetTargetArtifacts(target string) []ArtifactRule {
+	if t, ok := def.Targets[target]; ok && len(t.Artifacts) > 0 {
+		return t.Artifacts
+	}
+	return def.Artifacts
+}
+
 func (def *TargetsDef) GetOptionBuildFlag(target, name string) string {
 	if opt, ok := def.OptionFlags[name]; ok {
 		return opt.BuildFlag
@@ -352,6 +374,36 @@ func (def *TargetsDef) GetBuildContainer(ref string) string {
 	return release.BuildContainer
 }
 
+// GetReleasePlatforms returns the platforms supported by the build container
+// of the release, any platform being supported when empty.
+func (def *TargetsDef) GetReleasePlatforms(ref string) []string {
+	v, err := NewVersionRef(ref)
+	if err != nil {
+		return nil
+	}
+	release, ok := def.Releases[*v]
+	if !ok {
+		return nil
+	}
+	return release.Platforms
+}
+
+// GetTargetMinMemory returns the memory in MiB needed to build the target,
+// the highest of the target and its tags requirements.
+func (def *TargetsDef) GetTargetMinMemory(target string) uint32 {
+	t, ok := def.Targets[target]
+	if !ok {
+		return 0
+	}
+	minMemory := t.MinMemoryMB
+	for _, tag := range t.Tags {
+		if tagDef, ok := def.Tags[tag]; ok {
+			minMemory = max(minMemory, tagDef.MinMemoryMB)
+		}
+	}
+	return minMemory
+}
+
 func (def *TargetsDef) ExcludeTargetsFromRef(ref string) ([]string, error) {
 	v, err := NewVersionRef(ref)
 	if err != nil {
@@ -124,3 +124,51 @@ func TestExcludeTargets(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, []string{"t123", "x123"}, excl)
 }
+
+func TestTargetArtifacts(t *testing.T) {
+	defs, err := targets.ReadTargetsDefFromBytes([]byte(`{
+	  "releases": { "v1.2.3": { "sha": "345" } },
+	  "artifacts": [ { "slug": "firmware", "patterns": ["*.bin"] } ],
+	  "targets": {
+	    "t1": { "description": "Default artifacts" },
+	    "t2": {
+	      "description": "Custom artifacts",
+	      "artifacts": [
+	        { "slug": "firmware", "patterns": ["*.uf2"] },
+	        { "slug": "elf", "patterns": ["build/*.elf"], "optional": true }
+	      ]
+	    }
+	  }
+	}`), "")
+	assert.Nil(t, err)
+
+	assert.Equal(t, []targets.ArtifactRule{
+		{Slug: "firmware", Patterns: []string{"*.bin"}},
+	}, defs.GetTargetArtifacts("t1"))
+	assert.Equal(t, []targets.ArtifactRule{
+		{Slug: "firmware", Patterns: []string{"*.uf2"}},
+		{Slug: "elf", Patterns: []string{"build/*.elf"}, Optional: true},
+	}, defs.GetTargetArtifacts("t2"))
+}
+
+func TestBuildRequirements(t *testing.T) {
+	defs, err := targets.ReadTargetsDefFromBytes([]byte(`{
+	  "releases": {
+	    "v1.2.3": { "sha": "345", "platforms": ["amd64"] },
+	    "v1.3.0": { "sha": "567" }
+	  },
+	  "tags": { "colorlcd": { "flags": {}, "min_memory_mb": 4096 } },
+	  "targets": {
+	    "t1": { "description": "B&W radio" },
+	    "t2": { "description": "Color radio", "tags": ["colorlcd"], "min_memory_mb": 2048 },
+	    "t3": { "description": "Big radio", "tags": ["colorlcd"], "min_memory_mb": 8192 }
+	  }
+	}`), "")
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"amd64"}, defs.GetReleasePlatforms("v1.2.3"))
+	assert.Empty(t, defs.GetReleasePlatforms("v1.3.0"))
+	assert.Equal(t, uint32(0), defs.GetTargetMinMemory("t1"))
+	assert.Equal(t, uint32(4096), defs.GetTargetMinMemory("t2"))
+	assert.Equal(t, uint32(8192), defs.GetTargetMinMemory("t3"))
+}
@@ -44,6 +44,14 @@ function JobDetail({ job }: Props) {
         <Descriptions.Item label="Target" children={job.target} />
         <Descriptions.Item label="Status" children={job.status} />
         <Descriptions.Item label="Attempts" children={job.build_attempts} />
+        {job.error_type && (
+          <Descriptions.Item label="Error" children={job.error_type} />
+        )}
+        {job.error_excerpt && (
+          <Descriptions.Item label="Error excerpt">
+            <Text code children={job.error_excerpt} />
+          </Descriptions.Item>
+        )}
         <Descriptions.Item label="Flags">
           <JobFlags flags={job.flags ?? []} />
         </Descriptions.Item>
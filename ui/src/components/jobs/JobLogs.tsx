@@ -47,15 +47,19 @@ function JobLogs({ job }: Props) {
   }
 
   data?.sort((a, b) => (a.created_at < b.created_at ? -1 : 1));
-  const items = data?.map((logs, i) => ({
-    label: STATUS_MAP[logs.from],
-    key: logs.id,
-    showArrow: logs.std_out.length > 0,
-    collapsible:
-      logs.std_out.length > 0 ? undefined : ("icon" as CollapsibleType),
-    extra: getStepDuration(data, i),
-    children: <TerminalOutput logs={logs.std_out} />,
-  }));
+  const items = data?.map((logs, i) => {
+    const output = logs.reason
+      ? `${logs.reason}\n${logs.std_out}`
+      : logs.std_out;
+    return {
+      label: STATUS_MAP[logs.from],
+      key: logs.id,
+      showArrow: output.length > 0,
+      collapsible: output.length > 0 ? undefined : ("icon" as CollapsibleType),
+      extra: getStepDuration(data, i),
+      children: <TerminalOutput logs={output} />,
+    };
+  });
 
   return (
     <Collapse
@@ -9,6 +9,7 @@ interface LogsData {
   to: JobStatus;
   created_at: string;
   updated_at: string;
+  reason?: string;
   std_out: string;
 }
 
@@ -36,6 +36,8 @@ interface Job {
   artifacts?: Artifact[];
   container_image: string;
   build_flags_hash: string;
+  error_type?: string;
+  error_excerpt?: string;
   build_started_at: string;
   build_ended_at: string;
   created_at: string;
@@ -48,6 +50,7 @@ type JobStatusQuery =
   | "error"
   | "queued"
   | "building"
+  | "cancelled"
   | "in-progress";
 
 type JobSortQuery =
@@ -9,6 +9,7 @@ const JOB_STATUS_OPTIONS: Record<string, JobStatusQuery> = {
   "Successful": "success",
   "In progress": "in-progress",
   "Failed": "error",
+  "Cancelled": "cancelled",
 };
 
 function Jobs() {